@@ -2,38 +2,72 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/iscoreyagain/GoCask/internal"
 	"github.com/iscoreyagain/GoCask/internal/config"
+	"github.com/iscoreyagain/GoCask/internal/core"
 )
 
+// commandInfo is one command of a COMMAND DOCS reply.
+type commandInfo struct {
+	Name    string
+	Arity   int
+	Summary string
+}
+
 type Client struct {
 	conn   net.Conn
 	reader *bufio.Reader
 	writer *bufio.Writer
 	addr   string
+	// framed connections exchange length-delimited frames, see
+	// core.FrameHandshake
+	framed bool
+	// body reads the reply being decoded: the connection itself, or the
+	// frame holding the whole reply on a framed connection
+	body *bufio.Reader
 }
 
-func NewClient(addr string) (*Client, error) {
+func NewClient(addr string, framed bool) (*Client, error) {
 	conn, err := net.Dial(config.Protocol, addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
 
-	return &Client{
+	c := &Client{
 		conn:   conn,
 		reader: bufio.NewReader(conn),
 		writer: bufio.NewWriter(conn),
 		addr:   addr,
-	}, nil
+		framed: framed,
+	}
+	c.body = c.reader
+
+	if framed {
+		if err := c.writer.WriteByte(core.FrameHandshake); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
 func (c *Client) SendCommand(cmd string) (string, error) {
+	if c.framed {
+		return c.sendFramed(cmd)
+	}
+
 	// Send command
 	_, err := c.writer.WriteString(cmd + "\r\n")
 	if err != nil {
@@ -57,6 +91,35 @@ func (c *Client) SendCommand(cmd string) (string, error) {
 	return response, nil
 }
 
+// sendFramed sends cmd, split into arguments like the server splits inline
+// commands, as one frame and reads the reply frame. The rest of the reply
+// is then decoded from the frame.
+func (c *Client) sendFramed(cmd string) (string, error) {
+	parsed, err := core.ParseCommand(cmd)
+	if err != nil {
+		return "", err
+	}
+	payload := core.EncodeCommand(append([]string{parsed.Cmd}, parsed.Args...)...)
+	if err := core.WriteFrame(c.writer, payload); err != nil {
+		return "", err
+	}
+	if err := c.writer.Flush(); err != nil {
+		return "", err
+	}
+
+	reply, err := core.ReadFrame(c.reader, math.MaxUint32)
+	if err != nil {
+		return "", err
+	}
+	c.body = bufio.NewReader(bytes.NewReader(append(reply, '\r', '\n')))
+
+	response, err := c.body.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(response, "\r\n"), nil
+}
+
 func (c *Client) ReadBulkString(firstLine string) (string, error) {
 	if !strings.HasPrefix(firstLine, "$") {
 		return firstLine, nil
@@ -67,14 +130,109 @@ func (c *Client) ReadBulkString(firstLine string) (string, error) {
 	if lengthStr == "-1" {
 		return "(nil)", nil
 	}
+	length, err := strconv.Atoi(lengthStr)
+	if err != nil || length < 0 {
+		return "", fmt.Errorf("invalid bulk length %q", lengthStr)
+	}
+
+	// Read exactly length bytes plus the trailing \r\n, the value itself
+	// may contain newlines
+	content := make([]byte, length+2)
+	if _, err := io.ReadFull(c.body, content); err != nil {
+		return "", err
+	}
+
+	return string(content[:length]), nil
+}
+
+// DumpAll fetches a dump of the whole keyspace with DUMPALL and copies it to
+// w. The dump is checked while it is copied, so a truncated or damaged
+// transfer is reported as an error.
+func (c *Client) DumpAll(w io.Writer) (int, error) {
+	response, err := c.SendCommand("DUMPALL")
+	if err != nil {
+		return 0, err
+	}
+	if strings.HasPrefix(response, "-") {
+		return 0, errors.New(strings.TrimPrefix(response, "-"))
+	}
+	length, err := strconv.ParseInt(strings.TrimPrefix(response, "$"), 10, 64)
+	if err != nil || !strings.HasPrefix(response, "$") {
+		return 0, fmt.Errorf("unexpected reply %q", response)
+	}
+
+	body := io.TeeReader(io.LimitReader(c.body, length), w)
+	keys := 0
+	err = internal.ReadDump(body, func(key, value string, expireAt int64) error {
+		keys++
+		return nil
+	})
+	if err != nil {
+		return keys, err
+	}
+
+	// Trailing \r\n of the bulk string
+	if _, err := c.body.Discard(2); err != nil {
+		return keys, err
+	}
+	return keys, nil
+}
+
+// CommandDocs lists the commands of the server with COMMAND DOCS.
+func (c *Client) CommandDocs() ([]commandInfo, error) {
+	response, err := c.SendCommand("COMMAND DOCS")
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(response, "-") {
+		return nil, errors.New(strings.TrimPrefix(response, "-"))
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(response, "*"))
+	if err != nil || !strings.HasPrefix(response, "*") {
+		return nil, fmt.Errorf("unexpected reply %q", response)
+	}
+
+	docs := make([]commandInfo, 0, n)
+	for i := 0; i < n; i++ {
+		var doc commandInfo
+		if line, err := c.readBodyLine(); err != nil || line != "*3" {
+			return nil, fmt.Errorf("unexpected command entry %q: %v", line, err)
+		}
+		if doc.Name, err = c.readBodyBulk(); err != nil {
+			return nil, err
+		}
+		line, err := c.readBodyLine()
+		if err != nil {
+			return nil, err
+		}
+		if doc.Arity, err = strconv.Atoi(strings.TrimPrefix(line, ":")); err != nil {
+			return nil, fmt.Errorf("invalid arity %q", line)
+		}
+		if doc.Summary, err = c.readBodyBulk(); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
 
-	// Read actual content
-	content, err := c.reader.ReadString('\n')
+func (c *Client) readBodyLine() (string, error) {
+	line, err := c.body.ReadString('\n')
 	if err != nil {
 		return "", err
 	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
 
-	return strings.TrimSpace(content), nil
+func (c *Client) readBodyBulk() (string, error) {
+	line, err := c.readBodyLine()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "$") {
+		return "", fmt.Errorf("expected a bulk string, got %q", line)
+	}
+	return c.ReadBulkString(line)
 }
 
 func (c *Client) ReadArray(firstLine string) ([]string, error) {
@@ -93,7 +251,7 @@ func (c *Client) ReadArray(firstLine string) ([]string, error) {
 
 	results := make([]string, 0, size)
 	for i := 0; i < size; i++ {
-		line, err := c.reader.ReadString('\n')
+		line, err := c.body.ReadString('\n')
 		if err != nil {
 			return nil, err
 		}
@@ -123,6 +281,9 @@ func (c *Client) FormatResponse(response string) string {
 		return strings.TrimPrefix(response, ":")
 	case '$': // Bulk string
 		value, _ := c.ReadBulkString(response)
+		if response == "$0" {
+			return `""`
+		}
 		return value
 	case '*': // Array
 		values, _ := c.ReadArray(response)
@@ -145,34 +306,52 @@ func (c *Client) Close() error {
 
 func main() {
 	addr := flag.String("h", "localhost:8080", "Server address (host:port)")
+	framed := flag.Bool("framed", false, "Use length-delimited framing, safe for any binary data")
 	flag.Parse()
 
-	client, err := NewClient(*addr)
+	client, err := NewClient(*addr, *framed)
 	if err != nil {
 		fmt.Printf("Could not connect to BitCask at %s: %v\n", *addr, err)
 		os.Exit(1)
 	}
 	defer client.Close()
 
+	// Servers without COMMAND DOCS get the built-in help and no completion
+	docs, _ := client.CommandDocs()
+
 	fmt.Printf("Connected to BitCask at %s\n", *addr)
 	fmt.Println("Type 'help' for available commands, 'quit' to exit")
 
-	scanner := bufio.NewScanner(os.Stdin)
+	readLine := newLineReader(docs)
+	defer readLine.close()
 
 	for {
-		fmt.Print("\nbitcask> ")
-
-		if !scanner.Scan() {
+		line, err := readLine.read("\nbitcask> ")
+		if errors.Is(err, errInterrupted) {
+			continue
+		}
+		if err != nil {
 			break
 		}
 
-		input := strings.TrimSpace(scanner.Text())
+		input := strings.TrimSpace(line)
 		if input == "" {
 			continue
 		}
 
 		if strings.ToLower(input) == "help" {
-			printHelp()
+			if docs != nil {
+				printCommandDocs(docs)
+			} else {
+				printHelp()
+			}
+			continue
+		}
+
+		if fields := strings.Fields(input); len(fields) == 2 && strings.ToLower(fields[0]) == "dumpall" {
+			if err := dumpToFile(client, fields[1]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 			continue
 		}
 
@@ -196,18 +375,158 @@ func main() {
 	}
 }
 
+// lineReader reads the commands typed by the user: through a lineEditor
+// with TAB completion when stdin is a terminal, line by line otherwise.
+type lineReader struct {
+	editor  *lineEditor
+	scanner *bufio.Scanner
+	restore func()
+}
+
+func newLineReader(docs []commandInfo) *lineReader {
+	if docs == nil {
+		return &lineReader{scanner: bufio.NewScanner(os.Stdin)}
+	}
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return &lineReader{scanner: bufio.NewScanner(os.Stdin)}
+	}
+
+	names := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		names = append(names, doc.Name)
+	}
+	names = append(names, "HELP", "QUIT", "EXIT")
+
+	return &lineReader{
+		editor: &lineEditor{
+			in:    bufio.NewReader(os.Stdin),
+			out:   os.Stdout,
+			words: func() []string { return names },
+		},
+		restore: restore,
+	}
+}
+
+func (r *lineReader) read(prompt string) (string, error) {
+	if r.editor != nil {
+		return r.editor.readLine(prompt)
+	}
+
+	fmt.Print(prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *lineReader) close() {
+	if r.restore != nil {
+		r.restore()
+	}
+}
+
+// printCommandDocs lists the commands as the server describes them.
+func printCommandDocs(docs []commandInfo) {
+	fmt.Println("\nAvailable Commands:")
+	const format = "  %-14s %-9s %s\n"
+	for _, doc := range docs {
+		fmt.Printf(format, doc.Name, arityHint(doc.Arity), doc.Summary)
+	}
+	fmt.Printf(format, "QUIT", "", "Close the connection")
+	fmt.Println("\nPress TAB to complete a command name.")
+}
+
+// arityHint describes how many arguments a command of the given arity takes.
+func arityHint(arity int) string {
+	switch {
+	case arity == 2:
+		return "1 arg"
+	case arity > 0:
+		return fmt.Sprintf("%d args", arity-1)
+	case arity == -1:
+		return "any args"
+	default:
+		return fmt.Sprintf("%d+ args", -arity-1)
+	}
+}
+
+// dumpToFile saves a DUMPALL of the server to path.
+func dumpToFile(client *Client, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	keys, err := client.DumpAll(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	fmt.Printf("Dumped %d keys to %s\n", keys, path)
+	return nil
+}
+
 func printHelp() {
 	help := `
 Available Commands:
-  SET key value       Set a key to hold a string value
+  SET key value [NX|XX] [EX s|PX ms] [GET] [META n]  Set a key to hold a string value
   GET key            Get the value of a key
+  SETNX key value    Set a key only if it does not exist
+  GETSET key value   Set a key and return its old value
+  GETDEL key         Get the value of a key and delete it
+  MGET key [key ...] Get the values of several keys
+  MSET key value [key value ...]  Set several keys at once
   DEL key            Delete a key
-  EXISTS key         Check if a key exists (returns 1 or 0)
-  KEYS pattern       Get all keys (pattern not implemented yet)
+  SECUREDEL key      Delete a key and zero its value on disk
+  SWAP key1 key2     Exchange the values of two keys
+  CAS key expected new  Set a key only if it holds the expected value
+  APPEND key value   Append a value to the string stored at key
+  GETRANGE key start end  Get a substring of the value stored at key
+  SETRANGE key offset value  Overwrite part of the value stored at key
+  INCR key           Increment the integer stored at key by one
+  DECR key           Decrement the integer stored at key by one
+  INCRBY key n       Add an integer to the number stored at key
+  DECRBY key n       Subtract an integer from the number stored at key
+  INCRBYFLOAT key n  Add a float to the number stored at key
+  EXISTS key [key ...] Count how many of the keys exist
+  TYPE key           Get the type of the value stored at key
+  STRLEN key         Get the length of the value stored at key
+  KEYS [pattern]     Get the keys matching a glob pattern (*, ?, [abc]), all without one
   DBSIZE             Return the number of keys
+  SCAN prefix        List the keys starting with prefix, sorted
+  SCANEXPIRE secs    List keys expiring within the next secs seconds
+  TTL key            Get the remaining time to live of a key in seconds
+  PERSIST key        Remove the expiry of a key
+  REBUILDHINTS       Regenerate hint files of sealed data files
+  DUMPALL file       Save a consistent dump of all keys to a local file
+  MERGE              Compact sealed data files and report the space freed
+  ROLL               Seal the active data file and start a new one
   SYNC               Force sync to disk
+  FLUSH              Write buffered entries to the OS without fsync
+  FLUSHDB            Delete every key and its data files
+  WARMUP             Read all values once to pull them into the OS cache
   PING               Ping the server
-  INFO               Get server information
+  INFO [JSON]        Get server information, optionally as JSON
+  MEMORY STATS       Compare KeyDir memory with the data kept on disk
+  HEALTH [RESET]     Check the engine can write (RESET clears degraded mode)
+  OBJECT FREQ key    Get the LFU access counter of a key
+  OBJECT VERSION key Get the write version of a key
+  OBJECT META key    Get the metadata flags stored with a key
+  CONFIG GET name    Get a server parameter (rate-limit, client-output-buffer-limit)
+  CONFIG SET name v  Set a server parameter
+  DEBUG FILES        Show per-file size and live/dead bytes (-debug only)
+  DEBUG FILES id     List the live keys stored in data file id (-debug only)
+  DEBUG CRC key      Check the on-disk checksum of a key's entry (-debug only)
+  DEBUG TAIL count   List the last count entries written, newest first (-debug only)
+  DEBUG POPULATE count [prefix] [size]  Create test keys prefix:N (-debug only)
   QUIT               Close the connection
 
 Examples:
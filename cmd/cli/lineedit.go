@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// errInterrupted is returned by readLine when the line is abandoned with
+// Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines from a terminal in raw mode, echoing them itself,
+// so TAB can complete the command name being typed. It only knows backspace,
+// Ctrl-C and Ctrl-D besides; cursor keys are ignored.
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	// words returns the command names to complete from, in upper case
+	words func() []string
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+
+	var line []byte
+	for {
+		b, err := e.in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case b == '\r' || b == '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+
+		case b == 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+
+		case b == 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+
+		case b == 127 || b == 8: // Backspace
+			if len(line) > 0 {
+				_, size := utf8.DecodeLastRune(line)
+				line = line[:len(line)-size]
+				fmt.Fprint(e.out, "\b \b")
+			}
+
+		case b == '\t':
+			completed, candidates := completeCommand(string(line), e.words())
+			if len(candidates) > 1 && completed == string(line) {
+				fmt.Fprintf(e.out, "\r\n%s\r\n%s%s", strings.Join(candidates, "  "), prompt, line)
+				continue
+			}
+			fmt.Fprint(e.out, completed[len(line):])
+			line = []byte(completed)
+
+		case b == 27: // Escape sequence, e.g. a cursor key
+			e.skipEscape()
+
+		case b >= 32:
+			line = append(line, b)
+			e.out.Write([]byte{b})
+		}
+	}
+}
+
+// skipEscape drops the rest of a CSI sequence such as ESC [ A.
+func (e *lineEditor) skipEscape() {
+	if b, err := e.in.ReadByte(); err != nil || b != '[' {
+		return
+	}
+	for {
+		b, err := e.in.ReadByte()
+		if err != nil || (b >= 0x40 && b <= 0x7E) {
+			return
+		}
+	}
+}
+
+// completeCommand completes the command name at the start of line against
+// words. It returns the line extended as far as all matches agree, with a
+// trailing space once a single match is left, and the matching words. The
+// completion keeps to the case the user started typing in. Arguments are
+// not completed.
+func completeCommand(line string, words []string) (string, []string) {
+	if strings.ContainsAny(line, " \t") {
+		return line, nil
+	}
+
+	prefix := strings.ToUpper(line)
+	var matches []string
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			matches = append(matches, word)
+		}
+	}
+	sort.Strings(matches)
+
+	switch len(matches) {
+	case 0:
+		return line, nil
+	case 1:
+		return line + matchCase(line, matches[0][len(line):]) + " ", matches
+	}
+
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	return line + matchCase(line, common[len(line):]), matches
+}
+
+// matchCase returns the upper-case completion rest in lower case if the
+// user typed the start of the command in lower case.
+func matchCase(typed, rest string) string {
+	if typed != "" && typed == strings.ToLower(typed) {
+		return strings.ToLower(rest)
+	}
+	return rest
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// makeRaw is only implemented for Linux; elsewhere the CLI reads whole lines
+// without completion.
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode not supported on this platform")
+}
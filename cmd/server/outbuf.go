@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/iscoreyagain/GoCask/internal/config"
+	"github.com/iscoreyagain/GoCask/internal/core"
+)
+
+// replyWriter sends replies to one connection and enforces the output buffer
+// limits. Replies are built in memory in full before they are flushed, so
+// the bytes queued for the client are the size of the reply being sent.
+// Streamed replies, see writeStream, are never held in memory and so are
+// not subject to the limits.
+type replyWriter struct {
+	w         *bufio.Writer
+	softSince time.Time
+	// framed sends every reply as a length-delimited frame, see
+	// core.FrameHandshake, instead of terminating it with \r\n
+	framed bool
+}
+
+func newReplyWriter(w io.Writer) *replyWriter {
+	return &replyWriter{w: bufio.NewWriter(w)}
+}
+
+// write sends reply followed by \r\n, or as a frame. It fails without sending anything when
+// the reply would break the output buffer limits; the caller must then
+// close the connection.
+func (rw *replyWriter) write(reply string, now time.Time) error {
+	overhead := 2 // \r\n, or the length of a frame
+	if rw.framed {
+		overhead = 4
+	}
+	queued := int64(len(reply) + overhead)
+
+	hard, soft, softSeconds := config.OutputBufferLimit()
+	if hard > 0 && queued > hard {
+		return fmt.Errorf("output buffer of %d bytes exceeds the hard limit of %d", queued, hard)
+	}
+	if soft > 0 && queued > soft {
+		if rw.softSince.IsZero() {
+			rw.softSince = now
+		} else if now.Sub(rw.softSince) > time.Duration(softSeconds)*time.Second {
+			return fmt.Errorf("output buffer above the soft limit of %d for more than %ds", soft, softSeconds)
+		}
+	} else {
+		rw.softSince = time.Time{}
+	}
+
+	if rw.framed {
+		if err := core.WriteFrame(rw.w, []byte(reply)); err != nil {
+			return err
+		}
+	} else {
+		rw.w.WriteString(reply)
+		rw.w.WriteString("\r\n")
+	}
+	return rw.w.Flush()
+}
+
+// writeStream sends a streamed bulk string reply, as a frame when framed.
+// Nothing is queued beyond the bufio buffer, so the output buffer limits do
+// not apply. If the stream fails partway the client has already been sent
+// part of the reply; the caller must then close the connection.
+func (rw *replyWriter) writeStream(stream *core.StreamReply) error {
+	header := fmt.Sprintf("$%d\r\n", stream.Size)
+	if rw.framed {
+		// The frame carries the reply without its final \r\n
+		size := int64(len(header)) + stream.Size
+		if size > math.MaxUint32 {
+			return rw.write(fmt.Sprintf("-ERR reply of %d bytes is too large for a frame", size), time.Now())
+		}
+		var hdr [4]byte
+		binary.BigEndian.PutUint32(hdr[:], uint32(size))
+		rw.w.Write(hdr[:])
+	}
+	rw.w.WriteString(header)
+
+	cw := &countingWriter{w: rw.w}
+	if err := stream.WriteTo(cw); err != nil {
+		return err
+	}
+	if cw.n != stream.Size {
+		return fmt.Errorf("streamed %d bytes of a %d byte reply", cw.n, stream.Size)
+	}
+	if !rw.framed {
+		rw.w.WriteString("\r\n")
+	}
+	return rw.w.Flush()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,36 @@
+package main
+
+import "time"
+
+// tokenBucket throttles the commands of a single connection. The bucket holds
+// at most one second worth of tokens and refills continuously at the
+// configured rate, so short bursts are fine but sustained floods are not.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow reports whether one more command fits in the budget of rate
+// commands/sec. A rate <= 0 means the limit is disabled.
+func (tb *tokenBucket) allow(now time.Time, rate int64) bool {
+	if rate <= 0 {
+		return true
+	}
+
+	limit := float64(rate)
+	if tb.last.IsZero() {
+		tb.tokens = limit
+	} else {
+		tb.tokens += now.Sub(tb.last).Seconds() * limit
+		if tb.tokens > limit {
+			tb.tokens = limit
+		}
+	}
+	tb.last = now
+
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
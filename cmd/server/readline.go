@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/iscoreyagain/GoCask/internal/core"
+)
+
+var errLineTooLong = errors.New("line too long")
+
+// readLine reads one \n or \r\n terminated line of at most max bytes. A
+// longer line is consumed in full and reported as errLineTooLong, leaving
+// the reader at the start of the next command, so the connection survives.
+// The last line may end at EOF without a terminator.
+func readLine(r *bufio.Reader, max int) (string, error) {
+	var line []byte
+	tooLong := false
+
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			// Allow for the \r\n that is stripped below
+			if len(line)+len(chunk) > max+2 {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	if tooLong || len(line) > max {
+		return "", errLineTooLong
+	}
+	return string(line), nil
+}
+
+var errProtocol = errors.New("Protocol error")
+
+// readRequest reads the next command in whichever form the client sent it:
+// a length-delimited frame on a framed connection, otherwise a RESP array
+// or an inline command. Errors other than errLineTooLong and errProtocol
+// are fatal for the connection. closeAfter is set when the stream can't be
+// trusted past a malformed request, so the connection must be closed after
+// the error reply. An inline command that doesn't parse is logged and
+// returned as nil, which ExecuteAndResponse rejects.
+func readRequest(r *bufio.Reader, framed bool, max int) (cmd *core.Command, closeAfter bool, err error) {
+	if framed {
+		payload, err := core.ReadFrame(r, max)
+		if errors.Is(err, core.ErrFrameTooLarge) {
+			return nil, false, errLineTooLong
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		// The frame was read in full, so the stream is still in sync
+		if cmd, err = core.DecodeCommand(payload); err != nil {
+			return nil, false, fmt.Errorf("%w: %v", errProtocol, err)
+		}
+		return cmd, false, nil
+	}
+
+	line, err := readLine(r, max)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// A request in RESP array form carries binary safe arguments
+	if strings.HasPrefix(line, "*") {
+		cmd, err = readMultiBulk(r, line, max)
+		return cmd, err != nil, err
+	}
+
+	cmd, err = core.ParseCommand(line)
+	if err != nil {
+		log.Printf("Error parsing command: %v", err)
+	}
+	return cmd, false, nil
+}
+
+// readMultiBulk reads the arguments of a RESP array request whose "*<count>"
+// header line was already read. Every argument is a "$<len>" bulk string
+// read as exactly len bytes, so unlike inline commands it may hold \r, \n or
+// any other byte. No argument may be longer than max.
+func readMultiBulk(r *bufio.Reader, header string, max int) (*core.Command, error) {
+	count, err := strconv.Atoi(header[1:])
+	if err != nil || count < 1 || count > max {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err := readLine(r, max)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got %q", errProtocol, line)
+		}
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+		if n > max {
+			return nil, errLineTooLong
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[n] != '\r' || buf[n+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+		}
+		args = append(args, string(buf[:n]))
+	}
+
+	return &core.Command{Cmd: args[0], Args: args[1:]}, nil
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/iscoreyagain/GoCask/internal"
 	"github.com/iscoreyagain/GoCask/internal/config"
@@ -21,8 +24,8 @@ type Server struct {
 	address  string
 }
 
-func NewServer(dataDir string) (*Server, error) {
-	bc, err := internal.Open(dataDir)
+func NewServer(dataDir string, opts ...internal.Option) (*Server, error) {
+	bc, err := internal.Open(dataDir, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to open bitcask: %v", err)
 	}
@@ -78,28 +81,70 @@ func (s *Server) handleConnection(conn net.Conn) {
 	clientAddr := conn.RemoteAddr().String()
 	log.Printf("New client connected: %s", clientAddr)
 
-	scanner := bufio.NewScanner(conn)
-	writer := bufio.NewWriter(conn)
+	reader := bufio.NewReader(conn)
+	writer := newReplyWriter(conn)
+	maxLineLength := config.MaxLineLength
+	var limiter tokenBucket
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		cmd, err := core.ParseCommand(line)
-		if err != nil {
-			log.Printf("Error parsing command: %v", err)
+	// A client opts in to length-delimited framing with its first byte
+	framed := false
+	if b, err := reader.Peek(1); err == nil && b[0] == core.FrameHandshake {
+		reader.ReadByte()
+		framed, writer.framed = true, true
+	}
+
+	for {
+		cmd, closeAfter, err := readRequest(reader, framed, maxLineLength)
+		if err != nil && !errors.Is(err, errLineTooLong) && !errors.Is(err, errProtocol) {
+			if !isDisconnect(err) {
+				log.Printf("Warning: client %s error: %v", clientAddr, err)
+			}
+			break
 		}
-		response := core.ExecuteAndResponse(cmd)
 
-		writer.WriteString(response + "\r\n")
-		writer.Flush()
-	}
+		var response string
+		var stream *core.StreamReply
+		switch {
+		case errors.Is(err, errLineTooLong):
+			response = "-ERR value too large"
+		case err != nil:
+			response = "-ERR " + err.Error()
+		case !limiter.allow(time.Now(), config.RateLimit()):
+			response = "-ERR rate limit exceeded"
+		default:
+			response, stream = core.Execute(cmd)
+		}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Client %s error: %v", clientAddr, err)
+		if stream != nil {
+			err = writer.writeStream(stream)
+			stream.Close()
+		} else {
+			err = writer.write(response, time.Now())
+		}
+		if err != nil {
+			if !isDisconnect(err) {
+				log.Printf("Closing client %s: %v", clientAddr, err)
+			}
+			break
+		}
+		if closeAfter {
+			break
+		}
 	}
 
 	log.Printf("Client disconnected: %s", clientAddr)
 }
 
+// isDisconnect reports whether err is the client going away, cleanly or in
+// the middle of a command, rather than a fault worth logging.
+func isDisconnect(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
 func (s *Server) Close() error {
 	if s.listener != nil {
 		s.listener.Close()
@@ -112,9 +157,45 @@ func (s *Server) Close() error {
 
 func main() {
 	dataDir := flag.String("data", "./data", "Data directory")
+	checksum := flag.String("checksum", "crc32c", "Entry checksum: crc32c, xxhash or none")
+	shards := flag.Int("shards", 1, "Number of active files, keys are routed to one by hash")
+	shardKeyDelimiter := flag.String("shard-key-delimiter", "", "Route keys by the part before this delimiter")
+	maxFileAge := flag.Duration("max-file-age", 0, "Seal the active data file once it is this old, 0 for size-based rolling only")
+	syncPolicy := flag.String("sync", "interval", "When writes are fsynced: interval, always or never")
+	syncInterval := flag.Duration("sync-interval", time.Second, "How often the background sync fsyncs the active data files")
+	idleFlush := flag.Duration("idle-flush", 0, "Flush buffered entries once writes pause for this long, 0 to leave them to the background sync")
+	retention := flag.Duration("retention", 0, "Delete sealed data files whose newest entry is older than this, 0 to keep everything")
+	expireOnRead := flag.Bool("expire-on-read", false, "Delete expired keys when a GET finds them")
+	lazyIndex := flag.Bool("lazy-index", false, "Experimental: keep keys of hinted sealed files on disk instead of in memory")
+	recoverCorrupt := flag.Bool("recover-corrupt", false, "Skip corrupt entries at startup instead of stopping at them")
+	validateOnLoad := flag.Bool("validate-on-load", false, "Report keys duplicated across data files at startup")
+	statsLogInterval := flag.Duration("stats-log-interval", 0, "Log a stats summary this often, 0 to disable")
+	flag.BoolVar(&config.Debug, "debug", false, "Enable DEBUG commands")
+	flag.IntVar(&config.MaxLineLength, "max-line-length", config.MaxLineLength, "Longest inline command in bytes")
 	flag.Parse()
 
-	server, err := NewServer(*dataDir)
+	checksumType, err := internal.ParseChecksumType(*checksum)
+	if err != nil {
+		log.Fatalf("Invalid -checksum: %v", err)
+	}
+	syncPolicyType, err := internal.ParseSyncPolicy(*syncPolicy)
+	if err != nil {
+		log.Fatalf("Invalid -sync: %v", err)
+	}
+
+	server, err := NewServer(*dataDir,
+		internal.WithChecksum(checksumType),
+		internal.WithShards(*shards, *shardKeyDelimiter),
+		internal.WithMaxActiveFileAge(*maxFileAge),
+		internal.WithSyncPolicy(syncPolicyType),
+		internal.WithSyncInterval(*syncInterval),
+		internal.WithIdleFlush(*idleFlush),
+		internal.WithRetentionAge(*retention),
+		internal.WithStatsLogInterval(*statsLogInterval),
+		internal.WithExpireOnRead(*expireOnRead),
+		internal.WithLazyIndex(*lazyIndex),
+		internal.WithValidateOnLoad(*validateOnLoad),
+		internal.WithRecoverCorrupt(*recoverCorrupt))
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
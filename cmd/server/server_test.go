@@ -0,0 +1,927 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/iscoreyagain/GoCask/internal"
+	"github.com/iscoreyagain/GoCask/internal/config"
+	"github.com/iscoreyagain/GoCask/internal/core"
+)
+
+// newTestConn starts a server on a fresh data dir and returns the client side
+// of an in-memory connection served by handleConnection.
+func newTestConn(t *testing.T) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	server, err := NewServer(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	core.SetBitCask(server.bc)
+
+	client, conn := net.Pipe()
+	go server.handleConnection(conn)
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	return client, bufio.NewReader(client)
+}
+
+func TestRateLimitThrottlesFlood(t *testing.T) {
+	config.SetRateLimit(5)
+	defer config.SetRateLimit(0)
+
+	client, reader := newTestConn(t)
+
+	const total = 50
+	go func() {
+		for i := 0; i < total; i++ {
+			client.Write([]byte("PING\r\n"))
+		}
+	}()
+
+	ok, limited := 0, 0
+	for i := 0; i < total; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		switch strings.TrimSpace(line) {
+		case "+PONG":
+			ok++
+		case "-ERR rate limit exceeded":
+			limited++
+		default:
+			t.Fatalf("unexpected reply %q", line)
+		}
+	}
+
+	if limited == 0 {
+		t.Fatalf("expected some commands to be throttled, got %d ok", ok)
+	}
+	if ok > 6 {
+		t.Fatalf("expected at most a burst of 5 commands, got %d", ok)
+	}
+}
+
+func TestRateLimitDisabledByDefault(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			client.Write([]byte("PING\r\n"))
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if strings.TrimSpace(line) != "+PONG" {
+			t.Fatalf("unexpected reply %q", line)
+		}
+	}
+}
+
+func TestPanickingCommandKeepsConnection(t *testing.T) {
+	core.RegisterCommand("PANICNOW", func(args []string) string {
+		var s []string
+		return s[len(args)+1]
+	})
+
+	client, reader := newTestConn(t)
+
+	for _, tc := range []struct{ cmd, want string }{
+		{"PANICNOW", "-ERR internal error"},
+		{"PING", "+PONG"},
+	} {
+		if _, err := client.Write([]byte(tc.cmd + "\r\n")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("connection dropped after %s: %v", tc.cmd, err)
+		}
+		if got := strings.TrimSpace(line); got != tc.want {
+			t.Fatalf("%s: got %q, want %q", tc.cmd, got, tc.want)
+		}
+	}
+}
+
+func TestEmptyValueRoundTrip(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	for _, tc := range []struct {
+		cmd  string
+		want []string
+	}{
+		{`SET key ""`, []string{"+OK"}},
+		{"GET key", []string{"$0", ""}},
+		{"EXISTS key", []string{":1"}},
+		{"GET missing", []string{"$-1"}},
+		{"EXISTS missing", []string{":0"}},
+		{`SET spaced "a  b"`, []string{"+OK"}},
+		{"GET spaced", []string{"$4", "a  b"}},
+	} {
+		if _, err := client.Write([]byte(tc.cmd + "\r\n")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		for _, want := range tc.want {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("%s: read failed: %v", tc.cmd, err)
+			}
+			if got := strings.TrimSuffix(line, "\r\n"); got != want {
+				t.Fatalf("%s: got %q, want %q", tc.cmd, got, want)
+			}
+		}
+	}
+}
+
+// exchange sends cmd and checks the reply lines. net.Pipe is unbuffered, so
+// the write runs concurrently with the server reading it.
+func exchange(t *testing.T, client net.Conn, reader *bufio.Reader, cmd string, want ...string) {
+	t.Helper()
+
+	go client.Write([]byte(cmd + "\r\n"))
+	for _, w := range want {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if got := strings.TrimSuffix(line, "\r\n"); got != w {
+			if len(got) > 40 {
+				got = got[:40] + "..."
+			}
+			t.Fatalf("got %q, want %q", got, w)
+		}
+	}
+}
+
+func TestLargeValue(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	big := strings.Repeat("x", 100*1024)
+	exchange(t, client, reader, "SET big "+big, "+OK")
+	exchange(t, client, reader, "GET big", "$102400", big)
+
+	// Well past the 64KB a default bufio.Scanner would stop at, with a
+	// pattern so a corrupted or truncated reply shows
+	huge := strings.Repeat("0123456789abcdef", 200*1024/16)
+	exchange(t, client, reader, "SET huge "+huge, "+OK")
+	exchange(t, client, reader, "GET huge", "$204800", huge)
+	exchange(t, client, reader, "PING", "+PONG")
+}
+
+func TestLineLengthLimit(t *testing.T) {
+	defer func(max int) { config.MaxLineLength = max }(config.MaxLineLength)
+	config.MaxLineLength = 64 * 1024
+
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET big "+strings.Repeat("x", 100*1024), "-ERR value too large")
+	exchange(t, client, reader, "PING", "+PONG")
+}
+
+func TestExistsCountsKeys(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET a 1", "+OK")
+	exchange(t, client, reader, "SET b 2", "+OK")
+
+	exchange(t, client, reader, "EXISTS a", ":1")
+	exchange(t, client, reader, "EXISTS missing", ":0")
+	exchange(t, client, reader, "EXISTS a b", ":2")
+	exchange(t, client, reader, "EXISTS a a b", ":3")
+	exchange(t, client, reader, "EXISTS a missing b missing", ":2")
+	exchange(t, client, reader, "EXISTS", "-ERR wrong number of arguments for 'EXISTS' command")
+}
+
+func TestKeysFraming(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	// A reply must not leave a stray blank line behind for the next one
+	exchange(t, client, reader, "KEYS", "*0")
+	exchange(t, client, reader, "PING", "+PONG")
+
+	exchange(t, client, reader, "SET a 1", "+OK")
+	exchange(t, client, reader, "KEYS", "*1", "$1", "a")
+	exchange(t, client, reader, "PING", "+PONG")
+}
+
+func TestMGetMSet(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "MSET a 1 b 2", "+OK")
+	exchange(t, client, reader, "MGET a missing b", "*3", "$1", "1", "$-1", "$1", "2")
+	exchange(t, client, reader, "MSET a 1 b", "-ERR wrong number of arguments for 'MSET' command")
+	exchange(t, client, reader, "MGET", "-ERR wrong number of arguments for 'MGET' command")
+}
+
+func TestKeysPattern(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET user:1 a", "+OK")
+	exchange(t, client, reader, "SET order:1 b", "+OK")
+
+	exchange(t, client, reader, "KEYS user:*", "*1", "$6", "user:1")
+	exchange(t, client, reader, "KEYS ?ser:[0-9]", "*1", "$6", "user:1")
+	exchange(t, client, reader, "KEYS nope*", "*0")
+	exchange(t, client, reader, "KEYS user[", "-ERR invalid pattern: unterminated '[' in pattern")
+}
+
+func TestKeysSkipsExpiredKeys(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET live a", "+OK")
+	exchange(t, client, reader, "SET gone b PX 1", "+OK")
+	time.Sleep(10 * time.Millisecond)
+
+	exchange(t, client, reader, "KEYS *", "*1", "$4", "live")
+	exchange(t, client, reader, "KEYS g*", "*0")
+}
+
+func TestKeysUnderLazyIndex(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := internal.Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	bc.Put("sealed", "v")
+	if err := bc.Roll(); err != nil {
+		t.Fatalf("Roll failed: %v", err)
+	}
+	if err := bc.RebuildHints(); err != nil {
+		t.Fatalf("RebuildHints failed: %v", err)
+	}
+	bc.Close()
+
+	server, err := NewServer(dir, internal.WithLazyIndex(true))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	core.SetBitCask(server.bc)
+	client, conn := net.Pipe()
+	go server.handleConnection(conn)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	reader := bufio.NewReader(client)
+
+	exchange(t, client, reader, "GET sealed", "$1", "v")
+	exchange(t, client, reader, "KEYS *", "-ERR "+internal.ErrLazyIndex.Error())
+}
+
+func TestScan(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET user:2 b", "+OK")
+	exchange(t, client, reader, "SET user:1 a", "+OK")
+	exchange(t, client, reader, "SET order:1 c", "+OK")
+
+	exchange(t, client, reader, "SCAN user:", "*2", "$6", "user:1", "$6", "user:2")
+	exchange(t, client, reader, "SCAN nope", "*0")
+	exchange(t, client, reader, "SCAN", "-ERR wrong number of arguments for 'SCAN' command")
+}
+
+func TestDebugPopulate(t *testing.T) {
+	defer func(debug bool) { config.Debug = debug }(config.Debug)
+	config.Debug = true
+
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET item:1 kept", "+OK")
+	exchange(t, client, reader, "DEBUG POPULATE 3 item 10", "+OK")
+	exchange(t, client, reader, "EXISTS item:0 item:1 item:2 item:3", ":3")
+	exchange(t, client, reader, "GET item:0", "$10", "value:0xxx")
+	exchange(t, client, reader, "GET item:1", "$4", "kept")
+	exchange(t, client, reader, "DEBUG POPULATE 2", "+OK")
+	exchange(t, client, reader, "GET key:1", "$7", "value:1")
+}
+
+func TestDebugPopulateUsesBatches(t *testing.T) {
+	defer func(debug bool) { config.Debug = debug }(config.Debug)
+	config.Debug = true
+
+	server, err := NewServer(t.TempDir(), internal.WithShards(2, ""), internal.WithMaxActiveFileSize(4096))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	core.SetBitCask(server.bc)
+	client, conn := net.Pipe()
+	go server.handleConnection(conn)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	reader := bufio.NewReader(client)
+
+	const n = 5000
+	exchange(t, client, reader, fmt.Sprintf("DEBUG POPULATE %d item 10", n), "+OK")
+
+	keys, err := server.bc.Scan("item:")
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(keys) != n {
+		t.Fatalf("got %d keys, want %d", len(keys), n)
+	}
+	exchange(t, client, reader, fmt.Sprintf("GET item:%d", n-1), "$10", "value:4999")
+
+	// Each shard rolls a new file once its batches outgrow the size limit
+	if files := server.bc.Stats().Files; files <= 2 {
+		t.Fatalf("got %d data files, want the shards to have rolled", files)
+	}
+}
+
+func TestDebugCRC(t *testing.T) {
+	defer func(debug bool) { config.Debug = debug }(config.Debug)
+	config.Debug = true
+
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "DEBUG CRC missing", "-ERR no such key")
+	exchange(t, client, reader, "SET key value", "+OK")
+
+	go client.Write([]byte("DEBUG CRC key\r\n"))
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !strings.HasPrefix(line, "checksum=crc32c ") || !strings.HasSuffix(line, " match=1\r\n") {
+		t.Fatalf("got %q, want a matching crc32c checksum", line)
+	}
+}
+
+func TestDebugTail(t *testing.T) {
+	defer func(debug bool) { config.Debug = debug }(config.Debug)
+	config.Debug = true
+
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET a 1", "+OK")
+	exchange(t, client, reader, "DEL a", ":1")
+	exchange(t, client, reader, "DEBUG TAIL x", "-ERR value is not an integer or out of range")
+
+	go client.Write([]byte("DEBUG TAIL 5\r\n"))
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	for _, want := range []string{`op=del key="a" value_size=0`, `op=set key="a" value_size=1`} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if !strings.Contains(line, want) {
+			t.Fatalf("got %q, want it to contain %q", line, want)
+		}
+	}
+}
+
+func TestOutputBufferHardLimitClosesConnection(t *testing.T) {
+	defer config.SetOutputBufferLimit(0, 0, 0)
+
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, `CONFIG SET client-output-buffer-limit "1024 0 0"`, "+OK")
+	exchange(t, client, reader, "CONFIG GET client-output-buffer-limit",
+		"*2", "$26", "client-output-buffer-limit", "$8", "1024 0 0")
+
+	exchange(t, client, reader, "SET big "+strings.Repeat("x", 2048), "+OK")
+	go client.Write([]byte("GET big\r\n"))
+	if line, err := reader.ReadString('\n'); err == nil {
+		t.Fatalf("expected the connection to be closed, got %q", line)
+	}
+}
+
+func TestOutputBufferSoftLimit(t *testing.T) {
+	config.SetOutputBufferLimit(0, 100, 2)
+	defer config.SetOutputBufferLimit(0, 0, 0)
+
+	var out strings.Builder
+	rw := newReplyWriter(&out)
+	big := strings.Repeat("x", 200)
+	start := time.Now()
+
+	for _, tc := range []struct {
+		reply   string
+		after   time.Duration
+		wantErr bool
+	}{
+		{big, 0, false},
+		{big, time.Second, false},
+		{"+OK", 2 * time.Second, false}, // drops below the soft limit, resets
+		{big, 3 * time.Second, false},
+		{big, 6 * time.Second, true},
+	} {
+		err := rw.write(tc.reply, start.Add(tc.after))
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("after %v: got error %v, want error %v", tc.after, err, tc.wantErr)
+		}
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	for _, tc := range []struct {
+		cmd  string
+		want []string
+	}{
+		{"SET k v1 NX", []string{"+OK"}},
+		{"SET k v2 NX", []string{"$-1"}},
+		{"GET k", []string{"$2", "v1"}},
+		{"SET k v3 XX", []string{"+OK"}},
+		{"SET missing v XX", []string{"$-1"}},
+		{"EXISTS missing", []string{":0"}},
+		{"SET k v4 GET", []string{"$2", "v3"}},
+		{"SET fresh v GET", []string{"$-1"}},
+		{"SET k v5 NX GET", []string{"$2", "v4"}},
+		{"GET k", []string{"$2", "v4"}},
+		{"SET k v6 XX GET", []string{"$2", "v4"}},
+		{"SET k v NX XX", []string{"-ERR syntax error"}},
+		{"SET k v EX 10 PX 100", []string{"-ERR syntax error"}},
+		{"SET k v EX", []string{"-ERR syntax error"}},
+		{"SET k v EX ten", []string{"-ERR value is not an integer or out of range"}},
+		{"SET k v EX 0", []string{"-ERR invalid expire time in 'set' command"}},
+		{"SET k a b EX 10", []string{"-ERR syntax error"}},
+		{"SET k v EX 10 b", []string{"-ERR syntax error"}},
+		{"TTL k", []string{":-1"}},
+		{"SET k hello world", []string{"-ERR syntax error"}},
+		{`SET k "hello world"`, []string{"+OK"}},
+		{"GET k", []string{"$11", "hello world"}},
+		{"SET ttl v EX 100", []string{"+OK"}},
+		{"SCANEXPIRE 200", []string{"*1", "$3", "ttl"}},
+		{"SET tagged v META 12", []string{"+OK"}},
+		{"OBJECT META tagged", []string{":12"}},
+		{"OBJECT META k", []string{":0"}},
+		{"OBJECT META missing", []string{"$-1"}},
+		{"SET k v META -1", []string{"-ERR value is not an integer or out of range"}},
+		{"SET short v PX 1", []string{"+OK"}},
+	} {
+		exchange(t, client, reader, tc.cmd, tc.want...)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	exchange(t, client, reader, "GET short", "$-1")
+	exchange(t, client, reader, "SET short again NX", "+OK")
+}
+
+func TestObjectFreq(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	// A write counts as the first access
+	exchange(t, client, reader, "SET k v", "+OK")
+	exchange(t, client, reader, "OBJECT FREQ k", ":6")
+	exchange(t, client, reader, "OBJECT FREQ missing", "$-1")
+
+	for i := 0; i < 200; i++ {
+		exchange(t, client, reader, "GET k", "$1", "v")
+	}
+	go client.Write([]byte("OBJECT FREQ k\r\n"))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	freq, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, ":"), "\r\n"))
+	if err != nil || freq <= 6 || freq > 20 {
+		t.Fatalf("got %q after 200 reads, want a logarithmic count above 6", line)
+	}
+}
+
+func TestInfoJSON(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET a 1", "+OK")
+
+	go client.Write([]byte("INFO JSON\r\n"))
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	var info map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(line, "\r\n")), &info); err != nil {
+		t.Fatalf("INFO JSON is not valid JSON: %v: %q", err, line)
+	}
+	if info["keys"] != 1.0 {
+		t.Fatalf("keys: got %v, want 1", info["keys"])
+	}
+	for _, field := range []string{"run_id", "degraded", "live_bytes", "master_repl_offset"} {
+		if _, ok := info[field]; !ok {
+			t.Fatalf("INFO JSON has no %s field: %q", field, line)
+		}
+	}
+}
+
+// respCommand encodes args as a RESP array request.
+func respCommand(args ...string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return sb.String()
+}
+
+func TestBinaryValueRoundTrip(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	value := "line1\r\nline2\x00\nend\r"
+	go client.Write([]byte(respCommand("SET", "bin", value)))
+	if line, err := reader.ReadString('\n'); err != nil || line != "+OK\r\n" {
+		t.Fatalf("SET: got %q, %v", line, err)
+	}
+
+	for _, get := range []string{respCommand("GET", "bin"), "GET bin\r\n"} {
+		go client.Write([]byte(get))
+
+		want := fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(reader, got); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if string(got) != want {
+			t.Fatalf("GET: got %q, want %q", got, want)
+		}
+	}
+
+	exchange(t, client, reader, "PING", "+PONG")
+}
+
+func TestMalformedMultiBulkClosesConnection(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "*2\r\n$3\r\nGET\r\n+key", "-ERR Protocol error: expected '$', got \"+key\"")
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Fatalf("connection still open after a protocol error: %v", err)
+	}
+}
+
+func TestIsDisconnect(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{net.ErrClosed, true},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{fmt.Errorf("write: %w", syscall.EPIPE), true},
+		{errLineTooLong, false},
+		{errors.New("disk on fire"), false},
+	} {
+		if got := isDisconnect(tc.err); got != tc.want {
+			t.Errorf("isDisconnect(%v): got %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestDumpAll(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET a 1", "+OK")
+	go client.Write([]byte(respCommand("SET", "bin", "x\r\ny")))
+	if line, err := reader.ReadString('\n'); err != nil || line != "+OK\r\n" {
+		t.Fatalf("SET: got %q, %v", line, err)
+	}
+
+	go client.Write([]byte("DUMPALL\r\n"))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "$"), "\r\n"))
+	if err != nil {
+		t.Fatalf("got %q, want a bulk string", line)
+	}
+
+	got := make(map[string]string)
+	err = internal.ReadDump(io.LimitReader(reader, int64(n)), func(key, value string, _ int64) error {
+		got[key] = value
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadDump failed: %v", err)
+	}
+	if len(got) != 2 || got["a"] != "1" || got["bin"] != "x\r\ny" {
+		t.Fatalf("got %q", got)
+	}
+
+	if line, err := reader.ReadString('\n'); err != nil || line != "\r\n" {
+		t.Fatalf("bulk string not terminated: got %q, %v", line, err)
+	}
+	exchange(t, client, reader, "PING", "+PONG")
+}
+
+func TestDumpAllIsNotBoundByOutputBufferLimit(t *testing.T) {
+	config.SetOutputBufferLimit(64, 0, 0)
+	defer config.SetOutputBufferLimit(0, 0, 0)
+	client, reader := newTestConn(t)
+
+	value := strings.Repeat("v", 200)
+	exchange(t, client, reader, "SET big "+value, "+OK")
+
+	go client.Write([]byte("DUMPALL\r\n"))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "$"), "\r\n"))
+	if err != nil {
+		t.Fatalf("got %q, want a bulk string", line)
+	}
+	err = internal.ReadDump(io.LimitReader(reader, int64(n)), func(key, v string, _ int64) error {
+		if key != "big" || v != value {
+			t.Errorf("got %q=%q", key, v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadDump failed: %v", err)
+	}
+	if line, err := reader.ReadString('\n'); err != nil || line != "\r\n" {
+		t.Fatalf("bulk string not terminated: got %q, %v", line, err)
+	}
+	exchange(t, client, reader, "PING", "+PONG")
+}
+
+func TestFramedDumpAll(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	var buf bytes.Buffer
+	buf.WriteByte(core.FrameHandshake)
+	core.WriteFrame(&buf, core.EncodeCommand("SET", "a", "1"))
+	core.WriteFrame(&buf, core.EncodeCommand("DUMPALL"))
+	go client.Write(buf.Bytes())
+
+	if reply, err := core.ReadFrame(reader, 1<<20); err != nil || string(reply) != "+OK" {
+		t.Fatalf("SET: got %q, %v", reply, err)
+	}
+	reply, err := core.ReadFrame(reader, 1<<20)
+	if err != nil {
+		t.Fatalf("ReadFrame failed: %v", err)
+	}
+	header, body, ok := bytes.Cut(reply, []byte("\r\n"))
+	if !ok {
+		t.Fatalf("got %q, want a bulk string", reply)
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(string(header), "$")); err != nil || n != len(body) {
+		t.Fatalf("header %q does not match a body of %d bytes", header, len(body))
+	}
+	var got []string
+	err = internal.ReadDump(bytes.NewReader(body), func(key, value string, _ int64) error {
+		got = append(got, key+"="+value)
+		return nil
+	})
+	if err != nil || len(got) != 1 || got[0] != "a=1" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+func TestFramedConnection(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	send := func(args ...string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		core.WriteFrame(&buf, core.EncodeCommand(args...))
+		go client.Write(buf.Bytes())
+
+		reply, err := core.ReadFrame(reader, 1<<20)
+		if err != nil {
+			t.Fatalf("ReadFrame failed: %v", err)
+		}
+		return string(reply)
+	}
+
+	if _, err := client.Write([]byte{core.FrameHandshake}); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+
+	value := "a\r\nb\x00\n"
+	if got := send("SET", "bin", value); got != "+OK" {
+		t.Fatalf("SET: got %q", got)
+	}
+	if got, want := send("GET", "bin"), fmt.Sprintf("$%d\r\n%s", len(value), value); got != want {
+		t.Fatalf("GET: got %q, want %q", got, want)
+	}
+	if got := send("PING"); got != "+PONG" {
+		t.Fatalf("PING: got %q", got)
+	}
+
+	// A frame that isn't a valid command gets an error, not a disconnect
+	var buf bytes.Buffer
+	core.WriteFrame(&buf, []byte{0, 0})
+	go client.Write(buf.Bytes())
+	if reply, err := core.ReadFrame(reader, 1<<20); err != nil || !strings.HasPrefix(string(reply), "-ERR Protocol error") {
+		t.Fatalf("malformed frame: got %q, %v", reply, err)
+	}
+	if got := send("PING"); got != "+PONG" {
+		t.Fatalf("PING: got %q", got)
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET key value", "+OK")
+
+	go client.Write([]byte("MEMORY STATS\r\n"))
+	if line, _ := reader.ReadString('\n'); line != "*10\r\n" {
+		t.Fatalf("got %q, want a 10 element array", line)
+	}
+	stats := make(map[string]string)
+	for i := 0; i < 5; i++ {
+		var pair [2]string
+		for j := range pair {
+			reader.ReadString('\n') // bulk length
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			pair[j] = strings.TrimSuffix(line, "\r\n")
+		}
+		stats[pair[0]] = pair[1]
+	}
+
+	if stats["keys"] != "1" || stats["key_bytes"] != "3" {
+		t.Fatalf("got %v, want 1 key of 3 bytes", stats)
+	}
+	for _, field := range []string{"keydir_bytes", "data_bytes", "reclaimable_bytes"} {
+		if _, err := strconv.ParseInt(stats[field], 10, 64); err != nil {
+			t.Fatalf("%s: %v", field, err)
+		}
+	}
+}
+
+func TestRoll(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET key value", "+OK")
+	exchange(t, client, reader, "ROLL", "+OK")
+	exchange(t, client, reader, "ROLL now", "-ERR wrong number of arguments for 'ROLL' command")
+	exchange(t, client, reader, "GET key", "$5", "value")
+}
+
+func TestSecureDel(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET key value", "+OK")
+	exchange(t, client, reader, "SECUREDEL key", ":1")
+	exchange(t, client, reader, "SECUREDEL key", ":0")
+	exchange(t, client, reader, "GET key", "$-1")
+	exchange(t, client, reader, "SECUREDEL", "-ERR wrong number of arguments for 'SECUREDEL' command")
+}
+
+func TestCommandDocs(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "COMMAND DOCS get SET nope",
+		"*2",
+		"*3", "$3", "GET", ":2", "$22", "Get the value of a key",
+		"*3", "$3", "SET", ":-3", "$32", "Set a key to hold a string value")
+	exchange(t, client, reader, "COMMAND LIST", "-ERR unknown subcommand 'LIST' for 'COMMAND' command")
+	exchange(t, client, reader, "COMMAND", "-ERR wrong number of arguments for 'COMMAND' command")
+}
+
+func TestSetNX(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SETNX lock a", ":1")
+	exchange(t, client, reader, "SETNX lock b", ":0")
+	exchange(t, client, reader, "GET lock", "$1", "a")
+}
+
+func TestDel(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET k v", "+OK")
+	exchange(t, client, reader, "DEL k", ":1")
+	exchange(t, client, reader, "DEL k", ":0")
+	exchange(t, client, reader, "DEL missing", ":0")
+}
+
+func TestFlushDB(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "SET a 1", "+OK")
+	exchange(t, client, reader, "SET b 2", "+OK")
+	exchange(t, client, reader, "FLUSHDB", "+OK")
+	exchange(t, client, reader, "EXISTS a b", ":0")
+	exchange(t, client, reader, "SET a 3", "+OK")
+	exchange(t, client, reader, "GET a", "$1", "3")
+}
+
+func TestGetSetGetDel(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "GETSET k a", "$-1")
+	exchange(t, client, reader, "GETSET k b", "$1", "a")
+	exchange(t, client, reader, "GETDEL k", "$1", "b")
+	exchange(t, client, reader, "GETDEL k", "$-1")
+	exchange(t, client, reader, "GET k", "$-1")
+}
+
+func TestCAS(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "CAS k a b", ":0")
+	exchange(t, client, reader, `CAS k "" a`, ":1")
+	exchange(t, client, reader, "CAS k a b", ":1")
+	exchange(t, client, reader, "CAS k a c", ":0")
+	exchange(t, client, reader, "GET k", "$1", "b")
+}
+
+func TestTTLPersist(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "TTL k", ":-2")
+	exchange(t, client, reader, "SET k v", "+OK")
+	exchange(t, client, reader, "TTL k", ":-1")
+	exchange(t, client, reader, "PERSIST k", ":0")
+	exchange(t, client, reader, "SET k v EX 100", "+OK")
+	exchange(t, client, reader, "TTL k", ":100")
+	exchange(t, client, reader, "PERSIST k", ":1")
+	exchange(t, client, reader, "TTL k", ":-1")
+	exchange(t, client, reader, "SET gone v PX 1", "+OK")
+	time.Sleep(10 * time.Millisecond)
+	exchange(t, client, reader, "TTL gone", ":-2")
+	exchange(t, client, reader, "PERSIST gone", ":0")
+}
+
+func TestTypeStrlen(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "TYPE k", "+none")
+	exchange(t, client, reader, "STRLEN k", ":0")
+	exchange(t, client, reader, "SET k hello", "+OK")
+	exchange(t, client, reader, "TYPE k", "+string")
+	exchange(t, client, reader, "STRLEN k", ":5")
+}
+
+func TestAppend(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "APPEND k abc", ":3")
+	exchange(t, client, reader, "APPEND k def", ":6")
+	exchange(t, client, reader, "GET k", "$6", "abcdef")
+}
+
+func TestGetRangeSetRange(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "GETRANGE k 0 -1", "$0", "")
+	exchange(t, client, reader, `SET k "Hello World"`, "+OK")
+	exchange(t, client, reader, "GETRANGE k -5 -1", "$5", "World")
+	exchange(t, client, reader, "SETRANGE k 6 Redis", ":11")
+	exchange(t, client, reader, "GET k", "$11", "Hello Redis")
+	exchange(t, client, reader, "SETRANGE k -1 x", "-ERR offset is out of range")
+	exchange(t, client, reader, "GETRANGE k a 1", "-ERR value is not an integer or out of range")
+}
+
+func TestIncrDecr(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "INCR n", ":1")
+	exchange(t, client, reader, "INCRBY n 10", ":11")
+	exchange(t, client, reader, "DECR n", ":10")
+	exchange(t, client, reader, "DECRBY n 15", ":-5")
+	exchange(t, client, reader, "GET n", "$2", "-5")
+	exchange(t, client, reader, "SET s abc", "+OK")
+	exchange(t, client, reader, "INCR s", "-ERR value is not an integer or out of range")
+	exchange(t, client, reader, "INCRBY n x", "-ERR value is not an integer or out of range")
+}
+
+func TestIncrByFloat(t *testing.T) {
+	client, reader := newTestConn(t)
+
+	exchange(t, client, reader, "INCRBYFLOAT f 10.5", "$4", "10.5")
+	exchange(t, client, reader, "INCRBYFLOAT f -0.75", "$4", "9.75")
+	exchange(t, client, reader, "INCRBYFLOAT f abc", "-ERR value is not a float")
+	exchange(t, client, reader, "SET s text", "+OK")
+	exchange(t, client, reader, "INCRBYFLOAT s 1", "-ERR value is not a float")
+}
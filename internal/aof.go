@@ -2,11 +2,8 @@ package internal
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/binary"
 	"hash/crc32"
-	"io"
-	"os"
 	"time"
 )
 
@@ -22,28 +19,34 @@ type Header struct {
 	KeySize   uint32
 	ValueSize uint32
 	Tombstone bool
+	// Version counts the writes of the key, see PutWithVersion. Entries from
+	// files older than format 2 carry no version on disk.
+	Version uint64
+	// ExpireAt is the expiry in unix nanos, 0 if the key never expires.
+	// Entries from files older than format 3 never expire.
+	ExpireAt int64
+	// Meta holds application flags, see PutWithMeta. Entries from files
+	// older than format 4 have none.
+	Meta uint32
+	// BatchContinues marks every entry of a WriteBatch but the last, which
+	// commits the batch. Entries from files older than format 5 never have
+	// it.
+	BatchContinues bool
 }
 
 func NewLogEntry(key string, value string, tombstone bool) *LogEntry {
-	timestamp := time.Now().UnixNano()
-	keySize := uint32(len([]byte(key)))
-	valueSize := uint32(len([]byte(value)))
-
-	// data byte slice to calculate CRC
-	data := new(bytes.Buffer)
-	binary.Write(data, binary.BigEndian, timestamp)
-	binary.Write(data, binary.BigEndian, keySize)
-	binary.Write(data, binary.BigEndian, valueSize)
-	binary.Write(data, binary.BigEndian, tombstone)
-	data.Write([]byte(key))
-	data.Write([]byte(value))
-	crc := calcCRC(data.Bytes())
+	entry := newLogEntry(key, value, tombstone)
+	entry.seal(ChecksumCRC32C)
+	return entry
+}
 
+// newLogEntry builds an entry without a checksum. Fill in the remaining
+// header fields, then seal it with the checksum of the file it goes to.
+func newLogEntry(key string, value string, tombstone bool) *LogEntry {
 	header := &Header{
-		Crc:       crc,
-		Timestamp: timestamp,
-		KeySize:   keySize,
-		ValueSize: valueSize,
+		Timestamp: time.Now().UnixNano(),
+		KeySize:   uint32(len(key)),
+		ValueSize: uint32(len(value)),
 		Tombstone: tombstone,
 	}
 	return &LogEntry{
@@ -53,6 +56,16 @@ func NewLogEntry(key string, value string, tombstone bool) *LogEntry {
 	}
 }
 
+// seal computes the Crc field over everything that follows it on disk.
+func (e *LogEntry) seal(checksum ChecksumType) {
+	e.Header.Crc = 0
+	if checksum != ChecksumNone {
+		e.Header.Crc = checksum.sum(e.Serialize()[4:])
+	}
+}
+
+// Serialize encodes the entry in the current data file format (see codec.go
+// for the layout of every format).
 func (e *LogEntry) Serialize() []byte {
 	size := logEntryHeaderSize + len(e.Key) + len(e.Value)
 	buf := make([]byte, size)
@@ -63,16 +76,20 @@ func (e *LogEntry) Serialize() []byte {
 	binary.BigEndian.PutUint32(buf[12:16], e.Header.KeySize)
 	binary.BigEndian.PutUint32(buf[16:20], e.Header.ValueSize)
 
-	// Write tombstone as byte (0 or 1)
+	buf[20] = 0
 	if e.Header.Tombstone {
-		buf[20] = 1
-	} else {
-		buf[20] = 0
+		buf[20] |= entryFlagTombstone
+	}
+	if e.Header.BatchContinues {
+		buf[20] |= entryFlagBatchContinues
 	}
+	binary.BigEndian.PutUint64(buf[21:29], e.Header.Version)
+	binary.BigEndian.PutUint64(buf[29:37], uint64(e.Header.ExpireAt))
+	binary.BigEndian.PutUint32(buf[37:41], e.Header.Meta)
 
 	// Copy key and value
-	copy(buf[21:], e.Key)
-	copy(buf[21+len(e.Key):], e.Value)
+	copy(buf[logEntryHeaderSize:], e.Key)
+	copy(buf[logEntryHeaderSize+len(e.Key):], e.Value)
 
 	return buf
 }
@@ -85,29 +102,9 @@ func (e *LogEntry) IsDeleted() bool {
 	return e.Header.Tombstone
 }
 
-// Write the decoded entry into the append-only write file and return the size of entry (err if it occurs)
-// DEPRECATED
-func writeLogEntry(file *os.File, entry *LogEntry) (int, error) {
-	total := 0
-
-	if err := binary.Write(file, binary.BigEndian, entry.Header); err != nil {
-		return total, err
-	}
-	total += logEntryHeaderSize
-
-	n, err := file.Write(entry.Key)
-	if err != nil {
-		return 0, err
-	}
-	total += n
-
-	n, err = file.Write(entry.Value)
-	if err != nil {
-		return 0, err
-	}
-	total += n
-
-	return total, nil
+// IsExpired reports whether the entry has an expiry at or before now.
+func (e *LogEntry) IsExpired(now time.Time) bool {
+	return e.Header.ExpireAt != 0 && e.Header.ExpireAt <= now.UnixNano()
 }
 
 func writeLogEntryBuffered(w *bufio.Writer, entry *LogEntry) (int, error) {
@@ -115,74 +112,6 @@ func writeLogEntryBuffered(w *bufio.Writer, entry *LogEntry) (int, error) {
 	return w.Write(data)
 }
 
-func readLogEntry(file *os.File, offset int64, size int64) (*LogEntry, error) {
-	if size < logEntryHeaderSize {
-		return nil, io.ErrUnexpectedEOF
-	}
-
-	buf := make([]byte, size)
-	n, err := file.ReadAt(buf, offset)
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
-	if int64(n) != size {
-		return nil, io.ErrUnexpectedEOF
-	}
-
-	r := bytes.NewReader(buf)
-
-	header := new(Header)
-	entry := new(LogEntry)
-	entry.Header = header
-
-	if err := binary.Read(r, binary.BigEndian, header); err != nil {
-		return nil, err
-	}
-
-	keyLen, valLen := int(header.KeySize), int(header.ValueSize)
-	if logEntryHeaderSize+keyLen+valLen != len(buf) {
-		return nil, io.ErrUnexpectedEOF
-	}
-
-	entry.Key = make([]byte, keyLen)
-	if _, err := io.ReadFull(r, entry.Key); err != nil {
-		return nil, err
-	}
-	entry.Value = make([]byte, valLen)
-	if _, err := io.ReadFull(r, entry.Value); err != nil {
-		return nil, err
-	}
-
-	return entry, nil
-}
-
-// This function will parse each entry in .log files and append it into KeyDir for lightning read.
-func parseEntry(file *os.File) (*LogEntry, int64, error) {
-	entry := new(LogEntry)
-	entry.Header = new(Header)
-
-	if err := binary.Read(file, binary.BigEndian, entry.Header); err != nil {
-		return nil, 0, io.ErrUnexpectedEOF
-	}
-
-	key := make([]byte, entry.Header.KeySize)
-	if _, err := io.ReadFull(file, key); err != nil {
-		return nil, 0, err
-	}
-
-	val := make([]byte, entry.Header.ValueSize)
-	if _, err := io.ReadFull(file, val); err != nil {
-		return nil, 0, err
-	}
-
-	entry.Key = key
-	entry.Value = val
-
-	totalSz := int64(logEntryHeaderSize + len(key) + len(val))
-
-	return entry, totalSz, nil
-}
-
 func calcCRC(data []byte) uint32 {
-	return crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+	return crc32.Checksum(data, castagnoliTable)
 }
@@ -0,0 +1,17 @@
+package internal
+
+// Append adds value to the end of the string stored at key, treating a
+// missing key as empty, and returns the new length. Entries are immutable,
+// so this reads the current value and writes the whole concatenation as a
+// new entry: appending to a large value rewrites all of it. Like other
+// updates it is atomic with respect to updates of the same key and keeps
+// the key's expiry.
+func (bc *BitCask) Append(key string, value string) (int64, error) {
+	result, err := bc.update(key, func(old string, exists bool) (string, error) {
+		return old + value, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(result)), nil
+}
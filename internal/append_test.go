@@ -0,0 +1,20 @@
+package internal
+
+import "testing"
+
+func TestAppend(t *testing.T) {
+	bc := openTestDB(t)
+
+	if n, err := bc.Append("greeting", "hello"); err != nil || n != 5 {
+		t.Fatalf("Append to a missing key: got %d, %v", n, err)
+	}
+	if n, err := bc.Append("greeting", " world"); err != nil || n != 11 {
+		t.Fatalf("Append to an existing key: got %d, %v", n, err)
+	}
+	if got, err := bc.Get("greeting"); err != nil || got != "hello world" {
+		t.Fatalf("Get: got %q, %v", got, err)
+	}
+	if n, err := bc.Append("greeting", ""); err != nil || n != 11 {
+		t.Fatalf("Append of nothing: got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,20 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrBackpressure = errors.New("too many unsynced bytes, retry after the next sync")
+
+// checkBackpressure rejects a write while more than Options.MaxUnsyncedBytes
+// of the log sit in the page cache or write buffer waiting for an fsync. It
+// never blocks: writers see ErrBackpressure until the background sync (or an
+// explicit Sync) catches up. Callers hold bc.Mu.
+func (bc *BitCask) checkBackpressure() error {
+	limit := bc.opts.MaxUnsyncedBytes
+	if limit > 0 && bc.unsynced >= limit {
+		return fmt.Errorf("%w (%d/%d bytes)", ErrBackpressure, bc.unsynced, limit)
+	}
+	return nil
+}
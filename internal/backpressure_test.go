@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPutBackpressureUntilSync(t *testing.T) {
+	bc, err := Open(t.TempDir(), WithMaxUnsyncedBytes(100))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	var rejected error
+	for i := 0; i < 10; i++ {
+		if rejected = bc.Put("key", "value"); rejected != nil {
+			break
+		}
+	}
+	if !errors.Is(rejected, ErrBackpressure) {
+		t.Fatalf("expected ErrBackpressure, got %v", rejected)
+	}
+	if got := bc.Stats().UnsyncedBytes; got < 100 {
+		t.Fatalf("expected at least 100 unsynced bytes, got %d", got)
+	}
+	if _, err := bc.Delete("key"); !errors.Is(err, ErrBackpressure) {
+		t.Fatalf("expected ErrBackpressure on Delete, got %v", err)
+	}
+
+	if err := bc.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got := bc.Stats().UnsyncedBytes; got != 0 {
+		t.Fatalf("expected 0 unsynced bytes after Sync, got %d", got)
+	}
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put after Sync failed: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Backup copies a consistent image of the database into dir, which must not
+// exist yet. The writers are flushed and every file pinned at its current
+// size under the write lock, then the files are copied up to those sizes
+// under the read lock: reads carry on during the copy, writes wait for it.
+// The read lock keeps SecureDelete from rewriting an entry mid-copy; files
+// only ever grow otherwise, and a pinned file stays readable if a merge
+// removes it.
+func (bc *BitCask) Backup(dir string) error {
+	type source struct {
+		id   int
+		df   *dataFile
+		size int64
+	}
+	var sources []source
+	defer func() {
+		for _, src := range sources {
+			src.df.release()
+		}
+	}()
+
+	bc.Mu.Lock()
+	if err := bc.flush(); err != nil {
+		bc.Mu.Unlock()
+		return err
+	}
+	for id, df := range bc.Files {
+		size, err := bc.fileSize(id)
+		if err != nil {
+			bc.Mu.Unlock()
+			return err
+		}
+		df.acquire()
+		sources = append(sources, source{id, df, size})
+	}
+	m := &manifest{
+		RunId:             bc.runId,
+		Shards:            bc.opts.Shards,
+		ShardKeyDelimiter: bc.opts.ShardKeyDelimiter,
+		VersionFloor:      bc.versionFloor,
+	}
+	bc.Mu.Unlock()
+
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	for _, src := range sources {
+		dst := dataFilePath(dir, src.id, filepath.Ext(src.df.path))
+		if err := copyFileRange(dst, src.df.file, src.size); err != nil {
+			return fmt.Errorf("failed to back up file %d: %w", src.id, err)
+		}
+	}
+
+	// save syncs dir, which also makes the copied data files durable
+	return m.save(dir)
+}
+
+func copyFileRange(dst string, src *os.File, size int64) error {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, io.NewSectionReader(src, 0, size)); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// validateBackup checks that dir looks like a GoCask data dir: it has a
+// valid manifest and every data file has a readable header, with the magic
+// unless it is a legacy .log file.
+func validateBackup(dir string, ext string) error {
+	if _, err := os.Stat(manifestPath(dir)); err != nil {
+		return fmt.Errorf("invalid backup %s: %w", dir, err)
+	}
+	if _, err := loadManifest(dir); err != nil {
+		return fmt.Errorf("invalid backup %s: %w", dir, err)
+	}
+
+	files, err := listDataFiles(dir, ext)
+	if err != nil {
+		return fmt.Errorf("invalid backup %s: %w", dir, err)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		header, err := readFileHeader(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("invalid backup %s: %w", dir, err)
+		}
+		if !header.hasMagic() && filepath.Ext(file) != legacyDataFileExtension {
+			return fmt.Errorf("invalid backup %s: %s is not a data file", dir, file)
+		}
+	}
+
+	return nil
+}
+
+// OpenFromBackup installs backupDir as dataDir and opens it. The swap is
+// done with renames, so a crash mid-restore leaves either the old or the
+// restored directory in place, never a half-copied one. The previous
+// dataDir, if any, is moved aside to dataDir.old-<unix seconds>, and
+// backupDir itself is consumed.
+//
+// Renames are only atomic within one filesystem, so backupDir and dataDir
+// must live on the same one.
+func OpenFromBackup(backupDir, dataDir string, opts ...Option) (*BitCask, error) {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if err := validateBackup(backupDir, options.DataFileExtension); err != nil {
+		return nil, err
+	}
+
+	var asideDir string
+	if _, err := os.Stat(dataDir); err == nil {
+		asideDir = fmt.Sprintf("%s.old-%d", dataDir, time.Now().Unix())
+		if err := os.Rename(dataDir, asideDir); err != nil {
+			return nil, fmt.Errorf("failed to move %s aside: %w", dataDir, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := os.Rename(backupDir, dataDir); err != nil {
+		if asideDir != "" {
+			os.Rename(asideDir, dataDir)
+		}
+		if errors.Is(err, syscall.EXDEV) {
+			return nil, fmt.Errorf("cannot restore %s into %s: backup must be on the same filesystem as the data dir", backupDir, dataDir)
+		}
+		return nil, fmt.Errorf("failed to install backup: %w", err)
+	}
+	if err := syncDir(filepath.Dir(dataDir)); err != nil {
+		return nil, fmt.Errorf("failed to sync parent of %s: %w", dataDir, err)
+	}
+
+	return Open(dataDir, opts...)
+}
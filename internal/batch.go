@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// GetMany is Get for several keys at once. Every key is looked up under one
+// read lock, and a single flush covers any of them still buffered, so a
+// batch costs about as much locking as one Get; the values are then read
+// without the lock. The result has a value and an error for each key, in
+// order, with ErrKeyNotFound for keys that are missing.
+func (bc *BitCask) GetMany(keys []string) ([]string, []error) {
+	values := make([]string, len(keys))
+	errs := make([]error, len(keys))
+	pointers := make([]ValuePointer, len(keys))
+	files := make([]*dataFile, len(keys))
+
+	bc.Mu.RLock()
+	needsFlush := false
+	for i, key := range keys {
+		pointers[i], files[i], errs[i] = bc.pin(key)
+		if errs[i] == nil && bc.unflushed(pointers[i]) {
+			needsFlush = true
+		}
+	}
+	bc.Mu.RUnlock()
+
+	if needsFlush {
+		bc.Mu.Lock()
+		err := bc.flush()
+		bc.recordWriteResult(err)
+		bc.Mu.Unlock()
+		if err != nil {
+			for i, df := range files {
+				if df != nil {
+					df.release()
+					files[i], errs[i] = nil, err
+				}
+			}
+		}
+	}
+
+	for i, df := range files {
+		if df == nil {
+			continue
+		}
+		values[i], errs[i] = bc.readValue(df, pointers[i])
+		df.release()
+		if errs[i] == nil {
+			bc.touchFreq(keys[i])
+		}
+	}
+	return values, errs
+}
+
+// ErrCrossShardBatch is returned by Commit for a batch whose keys belong to
+// different shards.
+var ErrCrossShardBatch = errors.New("batch keys belong to different shards")
+
+// WriteBatch collects puts and deletes that Commit applies together. The
+// zero value is an empty batch ready to use.
+type WriteBatch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	key    string
+	value  string
+	delete bool
+}
+
+// Put adds a write of key to the batch. Like Put it clears any expiry.
+func (b *WriteBatch) Put(key string, value string) {
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+}
+
+// Delete adds a deletion of key to the batch. Deleting a key that doesn't
+// exist when the batch is committed does nothing.
+func (b *WriteBatch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{key: key, delete: true})
+}
+
+// Len returns the number of writes in the batch.
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Commit applies every write of batch, in order, or none of them. The
+// entries are appended back to back to a single data file, flushed once and
+// fsynced once, except under SyncNever, and KeyDir is updated for all of
+// them under the same lock, so readers never see part of a batch either.
+// Every entry but the last is marked as continuing the batch, and recovery
+// drops a batch whose last entry never made it to disk.
+//
+// A batch that doesn't fit in the active file starts a new one, and one
+// larger than Options.MaxActiveFileSize makes its file exceed the limit.
+// Every key of a batch must route to the same shard, otherwise Commit
+// returns ErrCrossShardBatch: recovery replays files in id order, so an
+// entry written to another shard's file could later win over newer writes
+// of its key. With Options.ShardKeyDelimiter, keys sharing a prefix always
+// share a shard.
+func (bc *BitCask) Commit(batch *WriteBatch) error {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+	if err := bc.checkBackpressure(); err != nil {
+		return err
+	}
+
+	// Track each key through the batch, as it may be written more than once
+	type keyState struct {
+		version uint64
+		live    bool
+	}
+	states := make(map[string]keyState)
+	var entries []*LogEntry
+	for _, op := range batch.ops {
+		if int64(len(op.value)) > maxValueSize {
+			return fmt.Errorf("%w: %d bytes for key %q, at most %d", ErrValueTooLarge, len(op.value), op.key, maxValueSize)
+		}
+		st, ok := states[op.key]
+		if !ok {
+			_, live := bc.lookup(op.key)
+			st = keyState{version: bc.lastVersion(op.key), live: live}
+		}
+		if op.delete && !st.live {
+			continue
+		}
+
+		entry := newLogEntry(op.key, op.value, op.delete)
+		entry.Header.Timestamp = bc.nextTimestamp()
+		entry.Header.Version = st.version + 1
+		entries = append(entries, entry)
+		states[op.key] = keyState{version: st.version + 1, live: !op.delete}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var size int64
+	for i, entry := range entries {
+		entry.Header.BatchContinues = i < len(entries)-1
+		entry.seal(bc.opts.Checksum)
+		size += entry.Size()
+	}
+
+	s := bc.shardFor(string(entries[0].Key))
+	for _, entry := range entries[1:] {
+		if bc.shardFor(string(entry.Key)) != s {
+			return fmt.Errorf("%w: %q and %q", ErrCrossShardBatch, entries[0].Key, entry.Key)
+		}
+	}
+	full := s.file != nil && s.size > fileHeaderSize && s.size+size >= bc.opts.MaxActiveFileSize
+	if s.file == nil || full || bc.activeFileExpired(s) {
+		if err := bc.rollShard(s); err != nil {
+			return fmt.Errorf("failed to roll new file: %w", err)
+		}
+	}
+
+	pointers := make([]ValuePointer, len(entries))
+	for i, entry := range entries {
+		vp, err := bc.writeEntry(s, entry)
+		if err != nil {
+			return err
+		}
+		pointers[i] = vp
+	}
+	if err := s.writer.Flush(); err != nil {
+		bc.recordWriteResult(err)
+		return fmt.Errorf("failed to flush writer: %w", err)
+	}
+	if bc.opts.SyncPolicy != SyncNever {
+		if err := bc.syncWrites(); err != nil {
+			return err
+		}
+	}
+	bc.recordWriteResult(nil)
+
+	for i, entry := range entries {
+		key := string(entry.Key)
+		if entry.Header.Tombstone {
+			bc.unindexKey(key)
+			bc.raiseVersionFloor(pointers[i].Version)
+			bc.shadowLazy(key, pointers[i].FileId)
+			bc.dropFreq(key)
+		} else {
+			bc.indexKey(key, pointers[i])
+			bc.touchFreq(key)
+		}
+	}
+	return nil
+}
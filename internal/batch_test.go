@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestGetMany(t *testing.T) {
+	bc := openTestDB(t)
+
+	bc.Put("a", "1")
+	bc.Put("b", "2")
+	bc.Put("gone", "3")
+	bc.Delete("gone")
+
+	values, errs := bc.GetMany([]string{"a", "missing", "b", "gone", "a"})
+	want := []string{"1", "", "2", "", "1"}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Fatalf("value %d = %q, want %q", i, values[i], want[i])
+		}
+	}
+	for _, i := range []int{0, 2, 4} {
+		if errs[i] != nil {
+			t.Fatalf("error %d = %v", i, errs[i])
+		}
+	}
+	for _, i := range []int{1, 3} {
+		if !errors.Is(errs[i], ErrKeyNotFound) {
+			t.Fatalf("error %d = %v, want ErrKeyNotFound", i, errs[i])
+		}
+	}
+
+	bc.Close()
+	if _, errs := bc.GetMany([]string{"a"}); !errors.Is(errs[0], ErrClosed) {
+		t.Fatalf("GetMany after Close: got %v, want ErrClosed", errs[0])
+	}
+}
+
+func TestCommit(t *testing.T) {
+	bc := openTestDB(t)
+
+	bc.Put("a", "old")
+	bc.Put("b", "old")
+
+	var batch WriteBatch
+	batch.Put("a", "new")
+	batch.Delete("b")
+	batch.Delete("missing")
+	batch.Put("c", "1")
+	batch.Put("c", "2")
+	if err := bc.Commit(&batch); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if v, err := bc.Get("a"); err != nil || v != "new" {
+		t.Fatalf("Get(a) = %q, %v", v, err)
+	}
+	if _, err := bc.Get("b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(b): got %v, want ErrKeyNotFound", err)
+	}
+	if v, err := bc.Get("c"); err != nil || v != "2" {
+		t.Fatalf("Get(c) = %q, %v", v, err)
+	}
+	if version, _ := bc.Version("c"); version != 2 {
+		t.Fatalf("version of c = %d, want 2", version)
+	}
+}
+
+// TestCommitIsAtomicAcrossCrashes commits a batch of 1000 keys that doesn't
+// fit in the active file, then cuts the file short inside the batch as a
+// crash mid-write would.
+func TestCommitIsAtomicAcrossCrashes(t *testing.T) {
+	const keys = 1000
+	for _, tc := range []struct {
+		name string
+		// how many bytes of the batch to cut off
+		cut  int64
+		want bool
+	}{
+		{"Complete", 0, true},
+		{"LastEntryTorn", 1, false},
+		{"HalfWritten", -1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			bc, err := Open(dir, WithMaxActiveFileSize(32*1024))
+			if err != nil {
+				t.Fatalf("failed to open: %v", err)
+			}
+			// Fill part of the active file so the batch has to roll
+			for i := 0; i < 100; i++ {
+				bc.Put(fmt.Sprintf("before-%d", i), "v")
+			}
+
+			var batch WriteBatch
+			for i := 0; i < keys; i++ {
+				batch.Put(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i))
+			}
+			if err := bc.Commit(&batch); err != nil {
+				t.Fatalf("Commit failed: %v", err)
+			}
+			bc.Mu.RLock()
+			first, last := bc.KeyDir["key-0"], bc.KeyDir[fmt.Sprintf("key-%d", keys-1)]
+			path := bc.Files[first.FileId].path
+			bc.Mu.RUnlock()
+			if first.FileId != last.FileId {
+				t.Fatalf("batch spans files %d and %d", first.FileId, last.FileId)
+			}
+			bc.Close()
+
+			end := last.Offset + last.Size
+			switch {
+			case tc.cut > 0:
+				end -= tc.cut
+			case tc.cut < 0:
+				end = (first.Offset + end) / 2
+			}
+			if err := os.Truncate(path, end); err != nil {
+				t.Fatalf("Truncate failed: %v", err)
+			}
+
+			// Writes after the crash must not complete the cut batch
+			bc, err = Open(dir, WithMaxActiveFileSize(32*1024))
+			if err != nil {
+				t.Fatalf("failed to reopen: %v", err)
+			}
+			bc.Put("after", "v")
+			bc.Close()
+			bc, err = Open(dir, WithMaxActiveFileSize(32*1024))
+			if err != nil {
+				t.Fatalf("failed to reopen: %v", err)
+			}
+			defer bc.Close()
+
+			found := 0
+			for i := 0; i < keys; i++ {
+				if v, err := bc.Get(fmt.Sprintf("key-%d", i)); err == nil {
+					if v != fmt.Sprintf("value-%d", i) {
+						t.Fatalf("key-%d = %q", i, v)
+					}
+					found++
+				}
+			}
+			if want := map[bool]int{true: keys, false: 0}[tc.want]; found != want {
+				t.Fatalf("found %d keys of the batch, want %d", found, want)
+			}
+			if !bc.Exists("before-99") || !bc.Exists("after") {
+				t.Fatalf("writes around the batch were lost")
+			}
+		})
+	}
+}
+
+func TestCommitWithShards(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir, WithShards(4, ":"))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	// Find two keys that route to different shards
+	other := ""
+	for i := 0; other == ""; i++ {
+		if key := fmt.Sprint("k", i); bc.shardFor(key) != bc.shardFor("a") {
+			other = key
+		}
+	}
+	var cross WriteBatch
+	cross.Put("a", "1")
+	cross.Put(other, "1")
+	if err := bc.Commit(&cross); !errors.Is(err, ErrCrossShardBatch) {
+		t.Fatalf("Commit across shards: got %v, want ErrCrossShardBatch", err)
+	}
+	if bc.Exists("a") || bc.Exists(other) {
+		t.Fatalf("a rejected batch wrote keys")
+	}
+
+	// Keys with the same prefix share a shard. A later Put must still win
+	// over the batch after a reopen.
+	var batch WriteBatch
+	batch.Put("user:a", "1")
+	batch.Put("user:b", "old")
+	if err := bc.Commit(&batch); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := bc.Put("user:b", "new"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	bc.Close()
+
+	bc, err = Open(dir, WithShards(4, ":"))
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	if v, err := bc.Get("user:b"); err != nil || v != "new" {
+		t.Fatalf("Get(user:b) after reopen = %q, %v, want %q", v, err, "new")
+	}
+	if v, err := bc.Get("user:a"); err != nil || v != "1" {
+		t.Fatalf("Get(user:a) after reopen = %q, %v", v, err)
+	}
+}
@@ -8,96 +8,254 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type BitCask struct {
 	// KeyDir is a in-memory hash table used to store all the keys referenced to the actual value
 	KeyDir        map[string]ValuePointer
-	Files         map[int]*os.File // Multiple file descriptors for read
+	Files         map[int]*dataFile // Every data file, including the active ones
 	Mu            *sync.RWMutex
-	CurrentFileId int
-	ActiveFile    *os.File // ONLY 1 active file to write and it's always written at the end
-	ActiveSize    int64    // Used to check whether this active file exceeds out of maximum allowed size, else trigger rollNewFile()
-	dir           string
+	CurrentFileId int // Highest data file id, the next roll creates CurrentFileId+1
+	// Active file of every shard, see Options.Shards. Each one is only
+	// appended to and rolled once it exceeds Options.MaxActiveFileSize
+	shards []*shard
+	dir    string
+	opts   Options
+	// Per-key LFU access counters, see OBJECT FREQ
+	freq   map[string]*lfuCounter
+	freqMu sync.Mutex
+	// Live keys and bytes per data file, see FileStats
+	usage map[int]*fileUsage
+	// Timestamp of the newest entry written or loaded, see nextTimestamp
+	lastTimestamp int64
+	// Total length of the keys in KeyDir, see MemoryStats
+	keyBytes int64
+	// Keys found duplicated across files by the last load, see
+	// Options.ValidateOnLoad
+	loadDuplicates int
+	// Corrupt stretches of data files skipped by the last load, see
+	// Options.RecoverCorrupt
+	loadCorrupt int
+	// Files indexed lazily by the last load, oldest first, and the deleted
+	// keys they may still hold, see Options.LazyIndex
+	lazy           []*lazyFile
+	lazyTombstones map[string]int
+	// Highest version any deleted key reached, and the part of it saved in
+	// the manifest, see lastVersion
+	versionFloor      uint64
+	savedVersionFloor uint64
+	// Write circuit breaker state, see recordWriteResult
+	writeFailures  int
+	firstFailureAt time.Time
+	degraded       bool
+	// Data files below this id were dropped by FlushDB, see LoadFiles
+	flushedBelow int
+	// Instance identity, see RunID
+	runId      string
+	replOffset int64
+	// Log bytes and entries written since the last fsync, see
+	// checkBackpressure and syncIfDue
+	unsynced       int64
+	unsyncedWrites int64
+	// Fires Options.IdleFlush after the last buffered write, see
+	// scheduleIdleFlush
+	idleFlush *time.Timer
+	// Recently accepted request ids, see PutIdempotent
+	requestIds *requestIdCache
+	// Per-key locks of read-modify-write operations, see update
+	keyLocks keyLocks
 	// TESTING
-	writer *bufio.Writer
-	done   chan struct{}
-	syncWg *sync.WaitGroup
+	done      chan struct{}
+	closed    atomic.Bool // set by Close, cleared by Reopen
+	closeOnce *sync.Once
+	syncWg    *sync.WaitGroup
+	// Unix nanos of the last background sync tick, see Ping
+	lastSyncTick atomic.Int64
+	// Disk I/O counters, see Stats. Atomic so readers holding only the
+	// read lock can update them.
+	bytesRead      atomic.Int64
+	bytesWritten   atomic.Int64
+	entriesRead    atomic.Int64
+	entriesWritten atomic.Int64
 }
 
 type ValuePointer struct {
-	FileId int
-	Offset int64
-	Size   int64
+	FileId   int
+	Offset   int64
+	Size     int64
+	Version  uint64
+	ExpireAt int64 // unix nanos, 0 if the key never expires
 }
 
-func Open(dir string) (*BitCask, error) {
+func Open(dir string, opts ...Option) (*BitCask, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, err
 	}
 
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Shards < 1 || options.Shards > maxShards {
+		return nil, fmt.Errorf("invalid shard count %d, must be between 1 and %d", options.Shards, maxShards)
+	}
+	if options.SyncInterval <= 0 {
+		return nil, fmt.Errorf("invalid sync interval %v, must be positive", options.SyncInterval)
+	}
+	if options.SyncPolicy == SyncNever && options.MaxUnsyncedBytes > 0 {
+		return nil, errors.New("MaxUnsyncedBytes needs a sync policy that syncs")
+	}
+	if options.WriteBufferSize <= 0 {
+		return nil, fmt.Errorf("invalid write buffer size %d, must be positive", options.WriteBufferSize)
+	}
+
 	bc := &BitCask{
-		dir:    dir,
-		KeyDir: make(map[string]ValuePointer),
-		Files:  make(map[int]*os.File),
-		done:   make(chan struct{}),
-		syncWg: &sync.WaitGroup{},
-		Mu:     &sync.RWMutex{},
+		dir:  dir,
+		opts: options,
+		Mu:   &sync.RWMutex{},
+	}
+	if err := bc.open(); err != nil {
+		return nil, err
 	}
 
+	return bc, nil
+}
+
+// open loads the data dir into a BitCask that holds no state yet, or no
+// longer does after Close, and starts the background goroutines.
+func (bc *BitCask) open() error {
+	bc.KeyDir = make(map[string]ValuePointer)
+	bc.Files = make(map[int]*dataFile)
+	bc.CurrentFileId = 0
+	bc.shards = nil
+	bc.freq = make(map[string]*lfuCounter)
+	bc.usage = make(map[int]*fileUsage)
+	bc.keyBytes = 0
+	bc.writeFailures, bc.firstFailureAt, bc.degraded = 0, time.Time{}, false
+	bc.replOffset, bc.unsynced, bc.unsyncedWrites = 0, 0, 0
+	bc.requestIds = newRequestIdCache(requestIdWindow)
+	bc.done = make(chan struct{})
+	bc.closeOnce = &sync.Once{}
+	bc.syncWg = &sync.WaitGroup{}
+	bc.bytesRead.Store(0)
+	bc.bytesWritten.Store(0)
+	bc.entriesRead.Store(0)
+	bc.entriesWritten.Store(0)
+
+	for i := 0; i < bc.opts.Shards; i++ {
+		bc.shards = append(bc.shards, &shard{index: i})
+	}
+
+	m, err := loadManifest(bc.dir)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+	bc.runId = m.RunId
+	bc.flushedBelow = m.FlushedBelow
+	bc.savedVersionFloor = m.VersionFloor
+
 	if err := bc.LoadFiles(); err != nil {
-		return nil, err
+		return err
 	}
 
-	if bc.ActiveFile == nil {
-		log.Println("ActiveFile is nil, rolling a new file")
+	if m.Shards != bc.opts.Shards || m.ShardKeyDelimiter != bc.opts.ShardKeyDelimiter {
+		// Keys may now route to other shards. Seal every active file so
+		// their new entries land in files with higher ids than anything
+		// written under the old layout, which keeps recovery order correct.
+		log.Printf("Shard layout changed to %d shards, rolling all active files", bc.opts.Shards)
 		if err := bc.RollNewFile(); err != nil {
-			return nil, fmt.Errorf("failed to roll new file: %v", err)
+			return fmt.Errorf("failed to roll new file: %v", err)
+		}
+		m.Shards, m.ShardKeyDelimiter = bc.opts.Shards, bc.opts.ShardKeyDelimiter
+		if err := m.save(bc.dir); err != nil {
+			return fmt.Errorf("failed to save manifest: %w", err)
 		}
 	}
 
-	// Initialize buffered writer
-	bc.writer = bufio.NewWriterSize(bc.ActiveFile, 64*1024) // 64KB buffer
+	for _, s := range bc.shards {
+		if s.file == nil {
+			log.Printf("Shard %d has no active file, rolling a new file", s.index)
+			if err := bc.rollShard(s); err != nil {
+				return fmt.Errorf("failed to roll new file: %v", err)
+			}
+		}
+	}
+
+	if len(bc.lazy) > 0 {
+		log.Printf("Indexed %d data files lazily, merges and retention are disabled", len(bc.lazy))
+	}
 
 	// Start background sync
 	bc.startBackgroundSync()
+	if bc.opts.AutoMergeInterval > 0 && len(bc.lazy) == 0 {
+		bc.startAutoMerge()
+	}
+	if bc.opts.StatsLogInterval > 0 {
+		bc.startStatsLog()
+	}
+	if bc.opts.RetentionAge > 0 && len(bc.lazy) == 0 {
+		bc.startRetention()
+	}
 
-	return bc, nil
+	return nil
+}
+
+// RunID returns the random id generated the first time this data dir was
+// opened. Clients can compare it across reconnects to detect that they are
+// talking to a different (or wiped) instance.
+func (bc *BitCask) RunID() string {
+	return bc.runId
+}
+
+// ReplicationOffset returns the number of log bytes this instance has
+// appended since it was opened.
+func (bc *BitCask) ReplicationOffset() int64 {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+	return bc.replOffset
 }
 
+// testHookSyncTick, when set, runs at the start of every background sync tick.
+var testHookSyncTick func()
+
 func (bc *BitCask) startBackgroundSync() {
 	bc.syncWg.Add(1)
+	bc.lastSyncTick.Store(time.Now().UnixNano())
 
 	go func() {
 		defer bc.syncWg.Done()
 
-		ticker := time.NewTicker(syncInterval)
+		ticker := time.NewTicker(bc.opts.SyncInterval)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
+				if testHookSyncTick != nil {
+					testHookSyncTick()
+				}
+				bc.lastSyncTick.Store(time.Now().UnixNano())
+
 				bc.Mu.Lock()
-				if bc.writer != nil {
-					_ = bc.writer.Flush()
+				var err error
+				if bc.opts.SyncPolicy == SyncNever {
+					err = bc.flush()
+				} else {
+					err = bc.fsync()
 				}
-				if bc.ActiveFile != nil {
-					_ = bc.ActiveFile.Sync()
+				if err == nil {
+					err = bc.rollExpiredShards()
 				}
+				bc.recordWriteResult(err)
 				bc.Mu.Unlock()
 
 			case <-bc.done:
 				bc.Mu.Lock()
-				if bc.writer != nil {
-					_ = bc.writer.Flush()
-				}
-				if bc.ActiveFile != nil {
-					_ = bc.ActiveFile.Sync()
-				}
+				_ = bc.fsync()
 				bc.Mu.Unlock()
 				return
 			}
@@ -107,266 +265,596 @@ func (bc *BitCask) startBackgroundSync() {
 func (bc *BitCask) Put(key string, value string) error {
 	bc.Mu.Lock()
 	defer bc.Mu.Unlock()
-	entry := NewLogEntry(key, value, false)
 
-	if bc.ActiveFile == nil || bc.ActiveSize+entry.Size() >= MaxActiveFileSize {
-		if err := bc.RollNewFile(); err != nil {
-			return fmt.Errorf("failed to roll new file: %w", err)
-		}
+	return bc.put(key, value)
+}
+
+// put appends the next version of key and points KeyDir at it. Like a Redis
+// SET it clears any expiry. Callers hold bc.Mu for writing.
+func (bc *BitCask) put(key string, value string) error {
+	return bc.putExpiring(key, value, 0)
+}
+
+// putExpiring is put with an expiry in unix nanos, 0 for none.
+func (bc *BitCask) putExpiring(key string, value string, expireAt int64) error {
+	return bc.putEntry(key, value, expireAt, 0)
+}
+
+// putEntry is putExpiring that also stores meta in the entry header.
+func (bc *BitCask) putEntry(key string, value string, expireAt int64, meta uint32) error {
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+	if err := bc.checkBackpressure(); err != nil {
+		return err
 	}
+	if int64(len(value)) > maxValueSize {
+		return fmt.Errorf("%w: %d bytes, at most %d", ErrValueTooLarge, len(value), maxValueSize)
+	}
+	entry := newLogEntry(key, value, false)
+	entry.Header.Timestamp = bc.nextTimestamp()
+	entry.Header.Version = bc.lastVersion(key) + 1
+	entry.Header.ExpireAt = expireAt
+	entry.Header.Meta = meta
 
-	offset := bc.ActiveSize
+	vp, err := bc.appendEntry(entry, true)
+	if err != nil {
+		return err
+	}
+	if err := bc.syncIfAlways(); err != nil {
+		return err
+	}
+	bc.indexKey(key, vp)
+	bc.touchFreq(key)
+
+	return nil
+}
+
+// appendEntry seals entry and appends it to the active file of its key's
+// shard, flushing the writer if asked to. It returns where the entry landed
+// but leaves KeyDir to the caller. Callers hold bc.Mu for writing.
+func (bc *BitCask) appendEntry(entry *LogEntry, flush bool) (ValuePointer, error) {
+	entry.seal(bc.opts.Checksum)
 
-	n, err := writeLogEntryBuffered(bc.writer, entry)
+	s := bc.shardFor(string(entry.Key))
+	if s.file == nil || s.size+entry.Size() >= bc.opts.MaxActiveFileSize || bc.activeFileExpired(s) {
+		if err := bc.rollShard(s); err != nil {
+			return ValuePointer{}, fmt.Errorf("failed to roll new file: %w", err)
+		}
+	}
+
+	vp, err := bc.writeEntry(s, entry)
 	if err != nil {
-		return fmt.Errorf("failed to write log entry: %w", err)
+		return ValuePointer{}, err
 	}
 
-	if err := bc.writer.Flush(); err != nil {
-		return fmt.Errorf("failed to flush writer: %w", err)
+	if flush {
+		if err := s.writer.Flush(); err != nil {
+			bc.recordWriteResult(err)
+			return ValuePointer{}, fmt.Errorf("failed to flush writer: %w", err)
+		}
+	} else {
+		bc.scheduleIdleFlush()
 	}
-	
-	bc.KeyDir[key] = ValuePointer{
-		FileId: bc.CurrentFileId,
-		Offset: offset,
-		Size:   entry.Size(),
+	bc.recordWriteResult(nil)
+
+	if err := bc.syncIfDue(); err != nil {
+		return ValuePointer{}, err
 	}
-	bc.ActiveSize += int64(n)
 
-	return nil
+	return vp, nil
 }
 
-func (bc *BitCask) Get(key string) (string, error) {
-	bc.Mu.RLock()
-	defer bc.Mu.RUnlock()
+// writeEntry writes the sealed entry into the buffer of the active file of
+// s and accounts for it, without flushing. Callers hold bc.Mu for writing.
+func (bc *BitCask) writeEntry(s *shard, entry *LogEntry) (ValuePointer, error) {
+	offset := s.size
 
-	vp, ok := bc.KeyDir[key]
-	if !ok {
-		return "", fmt.Errorf("key not found!")
+	n, err := writeLogEntryBuffered(s.writer, entry)
+	if err != nil {
+		bc.recordWriteResult(err)
+		return ValuePointer{}, fmt.Errorf("failed to write log entry: %w", err)
 	}
 
-	file, ok := bc.Files[vp.FileId]
-	if !ok {
-		return "", fmt.Errorf("file not found!")
+	s.size += int64(n)
+	bc.replOffset += int64(n)
+	bc.unsynced += int64(n)
+	bc.unsyncedWrites++
+	bc.bytesWritten.Add(int64(n))
+	bc.entriesWritten.Add(1)
+
+	return ValuePointer{
+		FileId:   s.fileId,
+		Offset:   offset,
+		Size:     entry.Size(),
+		Version:  entry.Header.Version,
+		ExpireAt: entry.Header.ExpireAt,
+	}, nil
+}
+
+// nextTimestamp returns the timestamp of a new entry: the time of
+// Options.Clock, or one past the previous timestamp if the clock went back.
+// Entry timestamps therefore never decrease, even across restarts, no matter
+// how the wall clock is adjusted. Callers hold bc.Mu for writing.
+func (bc *BitCask) nextTimestamp() int64 {
+	ts := bc.opts.Clock().UnixNano()
+	if ts <= bc.lastTimestamp {
+		ts = bc.lastTimestamp + 1
 	}
+	bc.lastTimestamp = ts
+	return ts
+}
+
+// Get only holds bc.Mu to look key up. The disk read happens after the lock
+// is released, on a pinned file handle, so it doesn't stall writers. Active
+// and sealed files are read the same way; an entry still sitting in an
+// active file's write buffer is flushed first.
+func (bc *BitCask) Get(key string) (string, error) {
+	value, _, err := bc.load(key)
+	if err == nil {
+		bc.touchFreq(key)
+	} else if errors.Is(err, ErrKeyNotFound) && bc.opts.ExpireOnRead {
+		bc.expireOnRead(key)
+	}
+	return value, err
+}
 
-	entry, err := readLogEntry(file, vp.Offset, vp.Size)
+// load is Get without access tracking that also returns the KeyDir pointer
+// the value was read through. Callers don't hold bc.Mu.
+func (bc *BitCask) load(key string) (string, ValuePointer, error) {
+	vp, df, err := bc.pinFlushed(key)
 	if err != nil {
-		return "", err
+		return "", vp, err
 	}
+	defer df.release()
 
-	if entry.IsDeleted() {
-		return "", fmt.Errorf("key not found")
+	value, err := bc.readValue(df, vp)
+	return value, vp, err
+}
+
+// pinFlushed is pin for callers that don't hold bc.Mu. It makes sure the
+// entry is in the file, not just in an active file's write buffer, so it
+// can be read once the lock is released.
+func (bc *BitCask) pinFlushed(key string) (ValuePointer, *dataFile, error) {
+	bc.Mu.RLock()
+	vp, df, err := bc.pin(key)
+	needsFlush := err == nil && bc.unflushed(vp)
+	bc.Mu.RUnlock()
+	if err != nil || !needsFlush {
+		return vp, df, err
 	}
 
-	return string(entry.Value), nil
+	if err := bc.flushPinned(df); err != nil {
+		return vp, nil, err
+	}
+	return vp, df, nil
 }
 
-func (bc *BitCask) Delete(key string) error {
+// flushPinned flushes the write buffers so an entry of the pinned file df
+// can be read, releasing df if that fails. Callers don't hold bc.Mu.
+func (bc *BitCask) flushPinned(df *dataFile) error {
 	bc.Mu.Lock()
-	defer bc.Mu.Unlock()
+	err := bc.flush()
+	bc.recordWriteResult(err)
+	bc.Mu.Unlock()
+	if err != nil {
+		df.release()
+	}
+	return err
+}
 
-	if _, ok := bc.KeyDir[key]; !ok {
-		return fmt.Errorf("key not found")
+// get reads the current value of key along with its KeyDir pointer. Callers
+// hold bc.Mu, which no writer releases while a value KeyDir points at is
+// still buffered, so unlike Get it never has to flush.
+func (bc *BitCask) get(key string) (string, ValuePointer, error) {
+	vp, df, err := bc.pin(key)
+	if err != nil {
+		return "", vp, err
 	}
+	defer df.release()
 
-	entry := NewLogEntry(key, "", true)
+	value, err := bc.readValue(df, vp)
+	return value, vp, err
+}
 
-	if bc.ActiveFile == nil || bc.ActiveSize+entry.Size() >= MaxActiveFileSize {
-		if err := bc.RollNewFile(); err != nil {
-			return fmt.Errorf("failed to roll new file: %w", err)
-		}
+// pin looks key up and takes a reference on the file holding its value.
+// Callers hold bc.Mu and release the file when done reading.
+func (bc *BitCask) pin(key string) (ValuePointer, *dataFile, error) {
+	if bc.closed.Load() {
+		return ValuePointer{}, nil, ErrClosed
+	}
+	vp, ok := bc.lookup(key)
+	if !ok || vp.expired(time.Now()) {
+		return vp, nil, ErrKeyNotFound
 	}
 
-	n, err := writeLogEntryBuffered(bc.writer, entry)
+	df, ok := bc.Files[vp.FileId]
+	if !ok {
+		return vp, nil, fmt.Errorf("%w: %d", ErrFileNotFound, vp.FileId)
+	}
+	df.acquire()
+
+	return vp, df, nil
+}
+
+// readValue reads the value vp points at from df.
+func (bc *BitCask) readValue(df *dataFile, vp ValuePointer) (string, error) {
+	value, err := bc.readValueBytes(df, vp)
+	return string(value), err
+}
+
+// readValueBytes is readValue without the copy into a string.
+func (bc *BitCask) readValueBytes(df *dataFile, vp ValuePointer) ([]byte, error) {
+	entry, err := readLogEntryValue(df.file, df.header.Version, df.header.Checksum, vp.Offset, vp.Size)
 	if err != nil {
-		return fmt.Errorf("failed to write log entry: %w", err)
+		return nil, err
 	}
-	bc.ActiveSize += int64(n)
-	delete(bc.KeyDir, key)
+	bc.bytesRead.Add(vp.Size)
+	bc.entriesRead.Add(1)
 
-	return nil
+	if entry.IsDeleted() {
+		return nil, ErrKeyNotFound
+	}
+
+	return entry.Value, nil
 }
 
-func (bc *BitCask) RollNewFile() error {
-	if bc.ActiveFile != nil {
-		oldFileId := bc.CurrentFileId
+// Delete removes key, reporting whether it held a live value. Deleting a
+// missing key is not an error, as in Redis; an expired key still in KeyDir
+// gets its tombstone but reports false, since reads already treat it as
+// missing.
+func (bc *BitCask) Delete(key string) (bool, error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
 
-		// Move old write-only file into a map of read-only files
-		if err := bc.ActiveFile.Sync(); err != nil {
-			return err
-		}
-		if err := bc.ActiveFile.Close(); err != nil {
-			return err
-		}
+	vp, ok := bc.lookup(key)
+	if !ok {
+		return false, nil
+	}
+	if err := bc.delete(key); err != nil {
+		return false, err
+	}
+	return !vp.expired(time.Now()), nil
+}
 
-		oldPath := filepath.Join(bc.dir, fmt.Sprintf("%06d.log", oldFileId))
-		readFile, err := os.OpenFile(oldPath, os.O_RDONLY, 0644)
-		if err != nil {
-			return err
-		}
-		bc.Files[oldFileId] = readFile
+// delete appends a tombstone for key and drops it from KeyDir. Callers hold
+// bc.Mu for writing.
+func (bc *BitCask) delete(key string) error {
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+	if err := bc.checkBackpressure(); err != nil {
+		return err
 	}
 
-	newId := bc.CurrentFileId + 1
+	cur, ok := bc.lookup(key)
+	if !ok {
+		return ErrKeyNotFound
+	}
 
-	fileName := fmt.Sprintf("%06d.log", newId)
-	filePath := filepath.Join(bc.dir, fileName)
+	entry := newLogEntry(key, "", true)
+	entry.Header.Timestamp = bc.nextTimestamp()
+	entry.Header.Version = cur.Version + 1
 
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	// Tombstones are not flushed right away, see Flush
+	vp, err := bc.appendEntry(entry, false)
 	if err != nil {
 		return err
 	}
+	if err := bc.syncIfAlways(); err != nil {
+		return err
+	}
+	bc.unindexKey(key)
+	bc.raiseVersionFloor(vp.Version)
+	bc.shadowLazy(key, vp.FileId)
+	bc.dropFreq(key)
 
-	// Bitcask instance have a new active file and new currentFileId
-	bc.CurrentFileId = newId
-	bc.ActiveFile = file
-	bc.ActiveSize = 0
-	bc.Files[newId] = file
+	return nil
+}
+
+// Roll seals the active file of every shard regardless of its size and
+// starts new ones, e.g. so that everything written so far can be archived
+// from sealed files. Everything is fsynced first. Readers holding the old
+// active files keep reading them through their own handles.
+func (bc *BitCask) Roll() error {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+	err := bc.fsync()
+	if err == nil {
+		err = bc.RollNewFile()
+	}
+	bc.recordWriteResult(err)
 
-	bc.writer = bufio.NewWriterSize(file, 64*1024)
+	return err
+}
 
+// RollNewFile seals the active file of every shard and starts new ones.
+// Callers hold bc.Mu.
+func (bc *BitCask) RollNewFile() error {
+	for _, s := range bc.shards {
+		if err := bc.rollShard(s); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (bc *BitCask) LoadFiles() error {
 	// recover() from the existing files from ./logs folder
-	files, _ := filepath.Glob(filepath.Join(bc.dir, "*.log"))
+	files, err := listDataFiles(bc.dir, bc.opts.DataFileExtension)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, len(files))
+	for id := range files {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
 	log.Println("BitCask data dir:", bc.dir)
-	log.Println("Found log files:", files)
-
-	bc.Files = make(map[int]*os.File)
-	maxId := 0
-
-	for _, file := range files {
-		base := filepath.Base(file) // "000001.log"
-
-		name := strings.TrimSuffix(base, ".log")
+	log.Println("Found data files:", len(ids))
+
+	bc.Files = make(map[int]*dataFile)
+	bc.loadDuplicates, bc.loadCorrupt = 0, 0
+	bc.lastTimestamp = 0
+	bc.lazy, bc.lazyTombstones = nil, make(map[string]int)
+	bc.versionFloor = bc.savedVersionFloor
+	maxId := max(bc.flushedBelow-1, 0)
+	unclean := make(map[int]bool)
+
+	for _, id := range ids {
+		file := files[id]
+
+		// Left behind by a FlushDB that didn't get to delete it
+		if id < bc.flushedBelow {
+			log.Printf("Removing %s, dropped by FLUSHDB", file)
+			if err := removeDroppedFile(bc.dir, id, file); err != nil {
+				return err
+			}
+			continue
+		}
 
-		id, err := strconv.Atoi(name)
+		f, err := os.OpenFile(file, os.O_RDONLY, 0644)
 		if err != nil {
-			continue
+			return err
 		}
 
+		header, err := readFileHeader(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to read header of %s: %w", file, err)
+		}
+		// A skipped file still reserves its id so a roll never appends to it
 		if id > maxId {
 			maxId = id
 		}
 
-		f, err := os.OpenFile(file, os.O_RDONLY, 0644)
-		if err != nil {
-			return err
+		// Only .log files may predate the header, anything else without
+		// the magic is not ours and must not be parsed as entries
+		if !header.hasMagic() && filepath.Ext(file) != legacyDataFileExtension {
+			f.Close()
+			log.Printf("Skipping %s: not a GoCask data file", file)
+			continue
 		}
+		bc.Files[id] = newDataFile(file, f, header)
 
-		bc.Files[id] = f
-
-		if err := bc.rebuildKeyDirFromFile(f, id); err != nil {
+		clean, err := bc.rebuildKeyDirFromFile(f, id, header)
+		if err != nil {
 			return fmt.Errorf("failed to rebuild keydir from %s: %w", file, err)
 		}
+		if !clean {
+			unclean[id] = true
+		}
 	}
 
 	bc.CurrentFileId = maxId
 
-	if maxId > 0 {
+	// The latest file of each shard becomes its active file again
+	latest := make(map[int]int)
+	for id, df := range bc.Files {
+		if shard := int(df.header.Shard); id > latest[shard] {
+			latest[shard] = id
+		}
+	}
+
+	for _, s := range bc.shards {
+		id, ok := latest[s.index]
+		if !ok {
+			continue
+		}
+
+		// Only append to the file if it was written with the current format
+		// and checksum and ends cleanly, otherwise Open rolls a fresh one.
+		readOnly := bc.Files[id]
+		if h := readOnly.header; h.Version != dataFileVersion || h.Checksum != bc.opts.Checksum || unclean[id] {
+			continue
+		}
+
 		// The most recent file must be writable (active file). We initially opened
 		// every file as read-only to rebuild KeyDir safely. Now reopen the latest
 		// file with RW|APPEND so subsequent writes succeed.
-		if f, ok := bc.Files[maxId]; ok && f != nil {
-			_ = f.Close()
-		}
-
-		activePath := filepath.Join(bc.dir, fmt.Sprintf("%06d.log", maxId))
-		activeFile, err := os.OpenFile(activePath, os.O_RDWR|os.O_APPEND, 0644)
+		activeFile, err := os.OpenFile(readOnly.path, os.O_RDWR|os.O_APPEND, 0644)
 		if err != nil {
 			return fmt.Errorf("failed to reopen active file for write: %w", err)
 		}
+		_ = readOnly.retire(false)
+		bc.Files[id] = newDataFile(readOnly.path, activeFile, readOnly.header)
 
-		bc.Files[maxId] = activeFile
-		bc.ActiveFile = activeFile
-
-		offset, err := bc.ActiveFile.Seek(0, io.SeekEnd)
+		offset, err := activeFile.Seek(0, io.SeekEnd)
 		if err != nil {
 			return fmt.Errorf("failed to seek active file: %w", err)
 		}
-		bc.ActiveSize = offset
 
-		bc.writer = bufio.NewWriterSize(bc.ActiveFile, 64*1024)
+		s.fileId = id
+		s.file = activeFile
+		s.size = offset
+		s.writer = bufio.NewWriterSize(activeFile, bc.opts.WriteBufferSize)
 	}
 
 	return nil
 }
 
-func (bc *BitCask) rebuildKeyDirFromFile(file *os.File, fileId int) error {
-	var offset int64 = 0
+// rebuildKeyDirFromFile indexes the entries of a data file, from its hint
+// file when a valid one exists. It reports whether the file ends cleanly,
+// see batchRecords.clean; files with a hint were sealed and always do.
+func (bc *BitCask) rebuildKeyDirFromFile(file *os.File, fileId int, header fileHeader) (bool, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
 
-	for {
-		entry, size, err := parseEntry(file)
+	records, ok := loadHint(bc.dir, fileId, fi.Size())
+	if ok && bc.opts.LazyIndex && lazyIndexable(header, fi.Size()) {
+		bc.lastTimestamp = max(bc.lastTimestamp, header.CreatedAt)
+		bc.lazy = append(bc.lazy, newLazyFile(fileId, records))
+		return true, nil
+	}
+	clean := true
+	if !ok || header.Version < 2 {
+		// Only the key is needed to index an entry, so never read values
+		// here unless they have to be verified
+		var scanned batchRecords
+		if bc.opts.RecoverCorrupt {
+			scanned, err = bc.recoverRecords(file, fileId, header, fi.Size())
+		} else {
+			scanned, err = scanRecords(file, header, fi.Size())
+		}
 		if err != nil {
-			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
-				break
-			}
-			return err
+			return false, err
+		}
+		if len(scanned.pending) > 0 {
+			log.Printf("Recovery: dropped an unfinished batch of %d entries at the end of file %d",
+				len(scanned.pending), fileId)
+		}
+		records, clean = scanned.committed, scanned.clean()
+	}
+
+	// Files read from hints only tell when they were created, which still
+	// bounds their entries from below
+	bc.lastTimestamp = max(bc.lastTimestamp, header.CreatedAt)
+	now := time.Now()
+	for _, r := range records {
+		bc.lastTimestamp = max(bc.lastTimestamp, r.Timestamp)
+		version := r.Version
+		if header.Version < 2 {
+			// Older formats don't store versions, count the writes instead
+			version = bc.lastVersion(r.Key) + 1
+		}
+		vp := ValuePointer{
+			FileId:   fileId,
+			Offset:   r.Offset,
+			Size:     r.Size,
+			Version:  version,
+			ExpireAt: r.ExpireAt,
 		}
 
-		if entry.IsDeleted() {
-			// Remove deleted keys
-			delete(bc.KeyDir, string(entry.Key))
+		if r.Tombstone || vp.expired(now) {
+			// Remove deleted keys. An expired value still hides the older
+			// values of its key, so it is dropped the same way
+			bc.unindexKey(r.Key)
+			bc.raiseVersionFloor(version)
+			bc.shadowLazy(r.Key, fileId)
 		} else {
-			// Update KeyDir with latest value location
-			bc.KeyDir[string(entry.Key)] = ValuePointer{
-				FileId: fileId,
-				Offset: offset,
-				Size:   size,
+			if bc.opts.ValidateOnLoad && header.Version >= 2 {
+				bc.checkDuplicate(r.Key, fileId, version)
 			}
+			// Update KeyDir with latest value location
+			bc.indexKey(r.Key, vp)
 		}
+	}
+
+	return clean, nil
+}
 
-		offset += size
+// checkDuplicate reports a key whose entry in fileId is not newer than the
+// one already indexed from an older file. Every write bumps the version, so
+// this only happens when an entry was copied, e.g. by a merge, and the
+// original was left behind.
+func (bc *BitCask) checkDuplicate(key string, fileId int, version uint64) {
+	old, ok := bc.KeyDir[key]
+	if !ok || old.FileId == fileId || old.Version < version {
+		return
 	}
+	bc.loadDuplicates++
+	log.Printf("Recovery: key %q has version %d in file %d but version %d in older file %d",
+		key, version, fileId, old.Version, old.FileId)
+}
 
-	return nil
+// Flush hands buffered entries to the OS without fsyncing them. Afterwards
+// they are visible to other readers of the files and survive a crash of this
+// process, but not a power loss or kernel crash. Use Sync for that.
+func (bc *BitCask) Flush() error {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	err := bc.flush()
+	bc.recordWriteResult(err)
+
+	return err
 }
 
+// Sync flushes like Flush and then fsyncs the active files, so everything
+// written so far survives a power loss.
 func (bc *BitCask) Sync() error {
 	bc.Mu.Lock()
 	defer bc.Mu.Unlock()
 
-	if bc.writer != nil {
-		if err := bc.writer.Flush(); err != nil {
-			return fmt.Errorf("failed to flush buffer: %w", err)
-		}
-	}
-
-	if bc.ActiveFile != nil {
-		if err := bc.ActiveFile.Sync(); err != nil {
-			return fmt.Errorf("failed to sync to disk: %w", err)
-		}
-	}
+	err := bc.fsync()
+	bc.recordWriteResult(err)
 
-	return nil
+	return err
 }
 
+// Close syncs and closes every data file. Only the first call does so; later
+// ones, like a signal handler racing a deferred Close, wait for it to finish
+// and return nil.
 func (bc *BitCask) Close() error {
+	var err error
+	bc.closeOnce.Do(func() {
+		err = bc.close()
+	})
+	return err
+}
+
+func (bc *BitCask) close() error {
+	bc.closed.Store(true)
 	close(bc.done)
 	bc.syncWg.Wait()
 	bc.Mu.Lock()
 	defer bc.Mu.Unlock()
 
-	if bc.writer != nil {
-		if err := bc.writer.Flush(); err != nil {
-			return fmt.Errorf("failed to flush buffer on close: %w", err)
-		}
+	if bc.idleFlush != nil {
+		bc.idleFlush.Stop()
+		bc.idleFlush = nil
 	}
-
-	if bc.ActiveFile != nil {
-		if err := bc.ActiveFile.Sync(); err != nil {
-			return fmt.Errorf("failed to sync on close: %w", err)
-		}
+	if err := bc.fsync(); err != nil {
+		return fmt.Errorf("failed to sync on close: %w", err)
 	}
 
-	for id, file := range bc.Files {
-		if err := file.Close(); err != nil {
+	// Files still pinned by an in-flight Get close when it finishes
+	for id, df := range bc.Files {
+		delete(bc.Files, id)
+		if err := df.retire(false); err != nil {
 			return fmt.Errorf("failed to close file %d: %w", id, err)
 		}
 	}
 
 	return nil
 }
+
+// Reopen loads the data dir again into a BitCask that was closed, as Open
+// would, so tests and pools can reuse the instance. Counters and runtime
+// state start over. It must not race with other calls on bc.
+func (bc *BitCask) Reopen() error {
+	if !bc.closed.Load() {
+		return errors.New("database is open, close it first")
+	}
+	if err := bc.open(); err != nil {
+		return fmt.Errorf("failed to reopen: %w", err)
+	}
+	bc.closed.Store(false)
+	return nil
+}
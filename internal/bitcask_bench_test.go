@@ -45,7 +45,7 @@ func BenchmarkBitCask_SustainedThroughput(b *testing.B) {
 	b.StopTimer()
 
 	// Wait for final sync
-	time.Sleep(syncInterval + 100*time.Millisecond)
+	time.Sleep(defaultSyncInterval + 100*time.Millisecond)
 	bc.Sync()
 }
 
@@ -222,7 +222,7 @@ func BenchmarkBitCask_WithFileRotation(b *testing.B) {
 	bytesWritten := int64(0)
 	rotations := 0
 
-	lastFileId := bc.currentFileId
+	lastFileId := bc.CurrentFileId
 
 	for time.Since(start) < duration {
 		key := fmt.Sprintf("key_%d", writes)
@@ -231,9 +231,9 @@ func BenchmarkBitCask_WithFileRotation(b *testing.B) {
 		bytesWritten += int64(len(value))
 
 		// Count file rotations
-		if bc.currentFileId != lastFileId {
+		if bc.CurrentFileId != lastFileId {
 			rotations++
-			lastFileId = bc.currentFileId
+			lastFileId = bc.CurrentFileId
 		}
 	}
 
@@ -275,7 +275,7 @@ func TestDiskThroughput(t *testing.T) {
 
 	fmt.Printf("\nRunning sustained write test for %v...\n", duration)
 	fmt.Printf("Value size: %d bytes\n", valueSize)
-	fmt.Printf("Sync interval: %v\n\n", syncInterval)
+	fmt.Printf("Sync interval: %v\n\n", defaultSyncInterval)
 
 	start := time.Now()
 	writes := 0
@@ -330,3 +330,29 @@ func TestDiskThroughput(t *testing.T) {
 	fmt.Printf("Avg latency:     %.3f ms\n", elapsed.Seconds()*1000/float64(writes))
 	fmt.Printf("Files created:   %d\n", len(bc.Files))
 }
+
+// Benchmark 6: Write-path CPU cost of each checksum algorithm on small values
+func BenchmarkEntryEncoding_CRC32C(b *testing.B) {
+	benchmarkEntryEncoding(b, ChecksumCRC32C)
+}
+
+func BenchmarkEntryEncoding_XXHash(b *testing.B) {
+	benchmarkEntryEncoding(b, ChecksumXXHash)
+}
+
+func BenchmarkEntryEncoding_None(b *testing.B) {
+	benchmarkEntryEncoding(b, ChecksumNone)
+}
+
+func benchmarkEntryEncoding(b *testing.B, checksum ChecksumType) {
+	value := "small-value-0123456789"
+
+	b.SetBytes(int64(len(value)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		entry := newLogEntry("key_0000001", value, false)
+		entry.seal(checksum)
+		_ = entry.Serialize()
+	}
+}
@@ -0,0 +1,582 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// openTestDB opens a BitCask in a fresh temp dir and closes it when the test ends.
+func openTestDB(t *testing.T) *BitCask {
+	t.Helper()
+
+	bc, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	t.Cleanup(func() { bc.Close() })
+
+	return bc
+}
+
+func TestFlushMakesBufferedWritesVisible(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	// Deletes are buffered until the next flush
+	if _, err := bc.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	s := bc.shards[0]
+	onDisk := func() int64 {
+		fi, err := os.Stat(dataFilePath(bc.dir, s.fileId, bc.opts.DataFileExtension))
+		if err != nil {
+			t.Fatalf("stat failed: %v", err)
+		}
+		return fi.Size()
+	}
+
+	if onDisk() == s.size {
+		t.Fatalf("expected the tombstone to still be buffered")
+	}
+	if err := bc.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if got := onDisk(); got != s.size {
+		t.Fatalf("file has %d bytes after Flush, want %d", got, s.size)
+	}
+}
+
+func TestEmptyValueIsDistinctFromMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	if err := bc.Put("empty", ""); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if value, err := bc.Get("empty"); err != nil || value != "" {
+		t.Fatalf("got %q, %v, want an empty value", value, err)
+	}
+	if _, err := bc.Get("missing"); err == nil {
+		t.Fatalf("expected Get of a missing key to fail")
+	}
+	bc.Close()
+
+	// The empty value must survive recovery too
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if value, err := bc.Get("empty"); err != nil || value != "" {
+		t.Fatalf("after reopen got %q, %v, want an empty value", value, err)
+	}
+}
+
+func TestGetReadsBufferedEntriesAcrossRolls(t *testing.T) {
+	bc := openTestDB(t)
+
+	// appendEntry without a flush leaves the entry in the writer's buffer,
+	// as a batched writer would.
+	putBuffered := func(key, value string) {
+		bc.Mu.Lock()
+		defer bc.Mu.Unlock()
+
+		entry := newLogEntry(key, value, false)
+		entry.Header.Version = bc.KeyDir[key].Version + 1
+		vp, err := bc.appendEntry(entry, false)
+		if err != nil {
+			t.Fatalf("appendEntry failed: %v", err)
+		}
+		bc.indexKey(key, vp)
+		if !bc.unflushed(vp) {
+			t.Fatalf("%s: entry was flushed already", key)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		putBuffered(fmt.Sprintf("before:%d", i), "sealed")
+		putBuffered(fmt.Sprintf("rolled:%d", i), "active")
+		if got, err := bc.Get(fmt.Sprintf("rolled:%d", i)); err != nil || got != "active" {
+			t.Fatalf("Get from active file: got %q, %v", got, err)
+		}
+
+		bc.Mu.Lock()
+		if err := bc.RollNewFile(); err != nil {
+			t.Fatalf("RollNewFile failed: %v", err)
+		}
+		bc.Mu.Unlock()
+
+		putBuffered(fmt.Sprintf("after:%d", i), "new")
+		for key, want := range map[string]string{
+			fmt.Sprintf("before:%d", i): "sealed",
+			fmt.Sprintf("after:%d", i):  "new",
+		} {
+			if got, err := bc.Get(key); err != nil || got != want {
+				t.Fatalf("Get(%q): got %q, %v, want %q", key, got, err, want)
+			}
+		}
+	}
+}
+
+func TestReopen(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("a", "1"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := bc.Reopen(); err == nil {
+		t.Fatalf("Reopen of an open database succeeded")
+	}
+
+	for i, kv := range [][2]string{{"b", "2"}, {"c", "3"}} {
+		if err := bc.Close(); err != nil {
+			t.Fatalf("Close %d failed: %v", i, err)
+		}
+		if err := bc.Close(); err != nil {
+			t.Fatalf("second Close failed: %v", err)
+		}
+		if err := bc.Reopen(); err != nil {
+			t.Fatalf("Reopen %d failed: %v", i, err)
+		}
+		if err := bc.Put(kv[0], kv[1]); err != nil {
+			t.Fatalf("Put after Reopen failed: %v", err)
+		}
+	}
+
+	for key, want := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		if got, err := bc.Get(key); err != nil || got != want {
+			t.Fatalf("Get(%q): got %q, %v, want %q", key, got, err, want)
+		}
+	}
+	if got := bc.Stats().Keys; got != 3 {
+		t.Fatalf("got %d keys, want 3", got)
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	bc, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// Like the server's signal handler racing its deferred Close
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- bc.Close() }()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatalf("third Close failed: %v", err)
+	}
+}
+
+func TestValidateOnLoadCountsDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := bc.Put(key, "value"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	sealed := bc.Files[bc.CurrentFileId].path
+	if err := bc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// A merge that copied the file's entries but never deleted it
+	data, err := os.ReadFile(sealed)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+	if err := os.WriteFile(dataFilePath(dir, 9, defaultDataFileExtension), data, 0644); err != nil {
+		t.Fatalf("failed to write copy: %v", err)
+	}
+
+	for _, validate := range []bool{false, true} {
+		bc, err := Open(dir, WithValidateOnLoad(validate))
+		if err != nil {
+			t.Fatalf("failed to open: %v", err)
+		}
+		want := 0
+		if validate {
+			want = 3
+		}
+		if got := bc.Stats().LoadDuplicates; got != want {
+			t.Fatalf("validate=%v: got %d duplicates, want %d", validate, got, want)
+		}
+		if got, err := bc.Get("c"); err != nil || got != "value" {
+			t.Fatalf("Get: got %q, %v", got, err)
+		}
+		bc.Close()
+	}
+}
+
+func TestRecoverCorruptSkipsBadEntry(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		corrupt func(entry []byte)
+	}{
+		// The entry keeps its size, its checksum fails
+		{"value", func(entry []byte) { entry[len(entry)-1] ^= 0xFF }},
+		// The entry seems to run past the end of the file
+		{"key size", func(entry []byte) { binary.BigEndian.PutUint32(entry[12:16], 1<<30) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			bc, err := Open(dir)
+			if err != nil {
+				t.Fatalf("failed to open: %v", err)
+			}
+			for _, key := range []string{"a", "b", "c"} {
+				if err := bc.Put(key, "value-"+key); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+			vp := bc.KeyDir["b"]
+			path := bc.Files[vp.FileId].path
+			if err := bc.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read data file: %v", err)
+			}
+			tc.corrupt(data[vp.Offset : vp.Offset+vp.Size])
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatalf("failed to write data file: %v", err)
+			}
+
+			bc, err = Open(dir, WithRecoverCorrupt(true))
+			if err != nil {
+				t.Fatalf("failed to open: %v", err)
+			}
+			defer bc.Close()
+
+			for _, key := range []string{"a", "c"} {
+				if got, err := bc.Get(key); err != nil || got != "value-"+key {
+					t.Fatalf("Get(%q): got %q, %v", key, got, err)
+				}
+			}
+			if bc.Exists("b") {
+				t.Fatalf("corrupt entry was indexed")
+			}
+			if got := bc.Stats().LoadCorrupt; got != 1 {
+				t.Fatalf("got %d corrupt entries, want 1", got)
+			}
+			if err := bc.Put("b", "again"); err != nil {
+				t.Fatalf("Put after recovery failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestRecoverCorruptResyncsAcrossWindows(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	const n = 3000
+	value := strings.Repeat("v", 1000)
+	for i := 0; i < n; i++ {
+		bc.Put(fmt.Sprintf("key:%d", i), value)
+	}
+	path := bc.Files[bc.CurrentFileId].path
+	bc.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+	if len(data) < 2*recoverWindowSize {
+		t.Fatalf("data file of %d bytes doesn't span several windows", len(data))
+	}
+	// Garbage straddling a window boundary
+	garbage := data[recoverWindowSize-32<<10 : recoverWindowSize+32<<10]
+	rand.New(rand.NewSource(1)).Read(garbage)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+
+	bc, err = Open(dir, WithRecoverCorrupt(true))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	if got := bc.Stats().LoadCorrupt; got != 1 {
+		t.Fatalf("got %d corrupt stretches, want 1", got)
+	}
+	if _, err := bc.Get("key:0"); err != nil {
+		t.Fatalf("Get before the garbage: %v", err)
+	}
+	if _, err := bc.Get(fmt.Sprintf("key:%d", n-1)); err != nil {
+		t.Fatalf("Get after the garbage: %v", err)
+	}
+	// Only the entries the garbage overwrote are lost
+	keys, _ := bc.Scan("key:")
+	if lost := n - len(keys); lost == 0 || lost > len(garbage)/1000+2 {
+		t.Fatalf("lost %d keys to %d bytes of garbage", lost, len(garbage))
+	}
+}
+
+func TestCorruptSizeMidFileIsNotATornTail(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		bc.Put(key, "value-"+key)
+	}
+	vp := bc.KeyDir["b"]
+	path := bc.Files[vp.FileId].path
+	bc.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+
+	// Cut into the last entry: a torn tail, dropped quietly
+	if err := os.WriteFile(path, data[:len(data)-1], 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open with a torn tail: %v", err)
+	}
+	if got, err := bc.Get("b"); err != nil || got != "value-b" {
+		t.Fatalf("Get(b): got %q, %v", got, err)
+	}
+	bc.Close()
+
+	// A size running past the end with entries after it is corruption,
+	// which must not drop those entries silently
+	binary.BigEndian.PutUint32(data[vp.Offset+12:vp.Offset+16], 1<<30)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if _, err := Open(dir); !errors.Is(err, ErrCorruptedEntry) {
+		t.Fatalf("Open: got %v, want ErrCorruptedEntry", err)
+	}
+}
+
+func TestOffsetsAcrossRollsDuringBurst(t *testing.T) {
+	bc, err := Open(t.TempDir(), WithMaxActiveFileSize(512))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	// Writers roll on size while another goroutine rolls explicitly
+	stop := make(chan struct{})
+	rolled := make(chan struct{})
+	go func() {
+		defer close(rolled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			bc.Mu.Lock()
+			if err := bc.RollNewFile(); err != nil {
+				t.Errorf("RollNewFile failed: %v", err)
+			}
+			bc.Mu.Unlock()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	const writers, perWriter = 4, 100
+	want := make(map[string]string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				key := fmt.Sprintf("w%d:%d", w, i)
+				value := strings.Repeat("v", i%50)
+				if err := bc.Put(key, value); err != nil {
+					t.Errorf("Put failed: %v", err)
+					return
+				}
+				mu.Lock()
+				want[key] = value
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	<-rolled
+
+	if len(bc.Files) < 10 {
+		t.Fatalf("only %d files, expected the burst to roll many times", len(bc.Files))
+	}
+	for key, value := range want {
+		if got, err := bc.Get(key); err != nil || got != value {
+			t.Fatalf("Get(%q): got %q, %v, want %q", key, got, err, value)
+		}
+	}
+
+	// Every KeyDir offset is where a scan of its file finds the entry
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+	found := 0
+	for id := range bc.Files {
+		err := bc.scanFile(id, func(entry *LogEntry, offset int64, size int64) error {
+			vp := bc.KeyDir[string(entry.Key)]
+			if vp.FileId != id {
+				return fmt.Errorf("key %q in file %d, KeyDir says file %d", entry.Key, id, vp.FileId)
+			}
+			if vp.Offset != offset || vp.Size != size {
+				return fmt.Errorf("key %q at %d+%d, KeyDir says %d+%d", entry.Key, offset, size, vp.Offset, vp.Size)
+			}
+			found++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("file %d: %v", id, err)
+		}
+	}
+	if found != len(want) {
+		t.Fatalf("scanned %d entries, want %d", found, len(want))
+	}
+}
+
+func TestRoll(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	before := bc.CurrentFileId
+
+	if err := bc.Roll(); err != nil {
+		t.Fatalf("Roll failed: %v", err)
+	}
+	if bc.CurrentFileId != before+1 {
+		t.Fatalf("got active file %d, want %d", bc.CurrentFileId, before+1)
+	}
+	if st := bc.Stats(); st.Files != 2 || st.UnsyncedBytes != 0 {
+		t.Fatalf("got %d files and %d unsynced bytes, want 2 and 0", st.Files, st.UnsyncedBytes)
+	}
+
+	if err := bc.Put("other", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if vp := bc.KeyDir["other"]; vp.FileId != bc.CurrentFileId {
+		t.Fatalf("write after Roll went to file %d, want %d", vp.FileId, bc.CurrentFileId)
+	}
+	for _, key := range []string{"key", "other"} {
+		if got, err := bc.Get(key); err != nil || got != "value" {
+			t.Fatalf("Get(%q): got %q, %v", key, got, err)
+		}
+	}
+}
+
+func TestTimestampsSurviveClockGoingBack(t *testing.T) {
+	var now atomic.Int64
+	now.Store(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).UnixNano())
+	clock := func() time.Time { return time.Unix(0, now.Load()) }
+
+	dir := t.TempDir()
+	bc, err := Open(dir, WithClock(clock))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	write := func(bc *BitCask, value string) {
+		t.Helper()
+		if err := bc.Put("key", value); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	write(bc, "1")
+	now.Add(int64(-time.Hour))
+	write(bc, "2")
+	if _, err := bc.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The clock is still behind after a restart
+	now.Add(int64(-time.Hour))
+	bc, err = Open(dir, WithClock(clock))
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	write(bc, "3")
+
+	history, err := bc.History("key")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("got %d entries, want 4", len(history))
+	}
+	for i := 1; i < len(history); i++ {
+		if prev, cur := history[i-1].Timestamp, history[i].Timestamp; cur <= prev {
+			t.Fatalf("entry %d has timestamp %d, not after %d", i, cur, prev)
+		}
+	}
+}
+
+func TestDeleteReportsWhetherKeyExisted(t *testing.T) {
+	bc := openTestDB(t)
+
+	bc.Put("key", "value")
+	if deleted, err := bc.Delete("key"); err != nil || !deleted {
+		t.Fatalf("Delete of an existing key = %v, %v", deleted, err)
+	}
+	if deleted, err := bc.Delete("key"); err != nil || deleted {
+		t.Fatalf("Delete of a deleted key = %v, %v", deleted, err)
+	}
+	if deleted, err := bc.Delete("missing"); err != nil || deleted {
+		t.Fatalf("Delete of a missing key = %v, %v", deleted, err)
+	}
+
+	bc.Mu.Lock()
+	bc.putExpiring("expired", "v", time.Now().Add(-time.Second).UnixNano())
+	bc.Mu.Unlock()
+	if deleted, err := bc.Delete("expired"); err != nil || deleted {
+		t.Fatalf("Delete of an expired key = %v, %v", deleted, err)
+	}
+	if _, ok := bc.KeyDir["expired"]; ok {
+		t.Fatalf("expired key still indexed after Delete")
+	}
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+)
+
+type ChecksumType uint8
+
+const (
+	// ChecksumCRC32C is CRC-32 with the Castagnoli polynomial, the default.
+	ChecksumCRC32C ChecksumType = iota
+	// ChecksumXXHash is the 32-bit xxHash, cheaper than CRC32C without
+	// hardware support.
+	ChecksumXXHash
+	// ChecksumNone stores a zero and skips verification, trading integrity
+	// for write throughput. Only use it on storage you trust.
+	ChecksumNone
+)
+
+func (c ChecksumType) String() string {
+	switch c {
+	case ChecksumCRC32C:
+		return "crc32c"
+	case ChecksumXXHash:
+		return "xxhash"
+	case ChecksumNone:
+		return "none"
+	default:
+		return fmt.Sprintf("checksum(%d)", uint8(c))
+	}
+}
+
+func ParseChecksumType(name string) (ChecksumType, error) {
+	for _, c := range []ChecksumType{ChecksumCRC32C, ChecksumXXHash, ChecksumNone} {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown checksum %q", name)
+}
+
+// ErrCorruptedEntry is returned when an entry read from disk doesn't match
+// its checksum, e.g. after bitrot or a torn write.
+var ErrCorruptedEntry = errors.New("corrupted entry")
+
+// verify checks the serialized entry buf against the checksum stored at its
+// start.
+func (c ChecksumType) verify(buf []byte) error {
+	if c == ChecksumNone {
+		return nil
+	}
+	stored := binary.BigEndian.Uint32(buf[0:4])
+	if computed := c.sum(buf[4:]); computed != stored {
+		return fmt.Errorf("%w: checksum %08x, stored %08x", ErrCorruptedEntry, computed, stored)
+	}
+	return nil
+}
+
+// sum computes the checksum of data with the given algorithm.
+func (c ChecksumType) sum(data []byte) uint32 {
+	switch c {
+	case ChecksumXXHash:
+		return xxh32(data, 0)
+	case ChecksumNone:
+		return 0
+	default:
+		return calcCRC(data)
+	}
+}
+
+// KeyChecksum re-reads the entry of key from disk and returns the checksum
+// stored in it along with the one computed over its bytes, using the
+// algorithm of the file holding it. They differ if the entry is corrupt.
+func (bc *BitCask) KeyChecksum(key string) (stored, computed uint32, kind ChecksumType, err error) {
+	vp, df, err := bc.pinFlushed(key)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer df.release()
+
+	buf, err := readEntryBytes(df.file, vp.Offset, vp.Size)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	bc.bytesRead.Add(vp.Size)
+
+	kind = df.header.Checksum
+	return binary.BigEndian.Uint32(buf[0:4]), kind.sum(buf[4:]), kind, nil
+}
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+const (
+	xxPrime1 uint32 = 2654435761
+	xxPrime2 uint32 = 2246822519
+	xxPrime3 uint32 = 3266489917
+	xxPrime4 uint32 = 668265263
+	xxPrime5 uint32 = 374761393
+)
+
+// xxh32 is the 32-bit xxHash of b.
+func xxh32(b []byte, seed uint32) uint32 {
+	n := len(b)
+	var h uint32
+
+	if n >= 16 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for len(b) >= 16 {
+			v1 = xxRound(v1, binary.LittleEndian.Uint32(b[0:4]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint32(b[4:8]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint32(b[8:12]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint32(b[12:16]))
+			b = b[16:]
+		}
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) +
+			bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	} else {
+		h = seed + xxPrime5
+	}
+
+	h += uint32(n)
+	for len(b) >= 4 {
+		h += binary.LittleEndian.Uint32(b[0:4]) * xxPrime3
+		h = bits.RotateLeft32(h, 17) * xxPrime4
+		b = b[4:]
+	}
+	for _, c := range b {
+		h += uint32(c) * xxPrime5
+		h = bits.RotateLeft32(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 15
+	h *= xxPrime2
+	h ^= h >> 13
+	h *= xxPrime3
+	h ^= h >> 16
+	return h
+}
+
+func xxRound(acc, input uint32) uint32 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft32(acc, 13)
+	return acc * xxPrime1
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestXXH32KnownVectors(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  uint32
+	}{
+		{"", 0x02cc5d05},
+		{"a", 0x550d7456},
+		{"abc", 0x32d153ff},
+		{"Nobody inspects the spammish repetition", 0xe2293b2f},
+	} {
+		if got := xxh32([]byte(tc.input), 0); got != tc.want {
+			t.Errorf("xxh32(%q) = %#08x, want %#08x", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestChecksumIsRecordedPerFile(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, checksum := range []ChecksumType{ChecksumNone, ChecksumXXHash, ChecksumCRC32C} {
+		bc, err := Open(dir, WithChecksum(checksum))
+		if err != nil {
+			t.Fatalf("failed to open with %v: %v", checksum, err)
+		}
+		if got := bc.Files[bc.CurrentFileId].header.Checksum; got != checksum {
+			t.Fatalf("active file records %v, want %v", got, checksum)
+		}
+		if err := bc.Put(checksum.String(), "value-"+checksum.String()); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		bc.Close()
+	}
+
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if len(bc.Files) != 3 {
+		t.Fatalf("expected one file per checksum policy, got %d", len(bc.Files))
+	}
+	for _, checksum := range []ChecksumType{ChecksumNone, ChecksumXXHash, ChecksumCRC32C} {
+		v, err := bc.Get(checksum.String())
+		if err != nil || v != "value-"+checksum.String() {
+			t.Fatalf("Get(%v) = %q, %v", checksum, v, err)
+		}
+	}
+}
+
+func TestLegacyHeaderlessFileStillLoads(t *testing.T) {
+	dir := t.TempDir()
+
+	legacy := serializeLegacy(NewLogEntry("old", "value", false))
+	if err := os.WriteFile(filepath.Join(dir, "000001.log"), legacy, 0644); err != nil {
+		t.Fatalf("failed to write legacy file: %v", err)
+	}
+
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	if v, err := bc.Get("old"); err != nil || v != "value" {
+		t.Fatalf("Get(old) = %q, %v", v, err)
+	}
+	if bc.CurrentFileId != 2 {
+		t.Fatalf("expected writes to go to a new file, active file is %d", bc.CurrentFileId)
+	}
+}
+
+func TestKeyChecksumDetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir, WithChecksum(ChecksumXXHash))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	stored, computed, kind, err := bc.KeyChecksum("key")
+	if err != nil || kind != ChecksumXXHash || stored != computed || stored == 0 {
+		t.Fatalf("intact entry: stored %08x, computed %08x, %v, %v", stored, computed, kind, err)
+	}
+
+	// Flip the last byte of the value on disk
+	vp := bc.KeyDir["key"]
+	f, err := os.OpenFile(bc.Files[vp.FileId].path, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("X"), vp.Offset+vp.Size-1); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	f.Close()
+
+	if stored, computed, _, err = bc.KeyChecksum("key"); err != nil || stored == computed {
+		t.Fatalf("corrupt entry: stored %08x, computed %08x, %v", stored, computed, err)
+	}
+	if _, _, _, err := bc.KeyChecksum("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("missing key: got %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestGetDetectsCorruption(t *testing.T) {
+	for _, checksum := range []ChecksumType{ChecksumCRC32C, ChecksumXXHash, ChecksumNone} {
+		bc, err := Open(t.TempDir(), WithChecksum(checksum))
+		if err != nil {
+			t.Fatalf("failed to open: %v", err)
+		}
+		defer bc.Close()
+
+		if err := bc.Put("key", "value"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+
+		// Flip a bit in the middle of the value on disk
+		vp := bc.KeyDir["key"]
+		f, err := os.OpenFile(bc.Files[vp.FileId].path, os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatalf("open failed: %v", err)
+		}
+		b := make([]byte, 1)
+		if _, err := f.ReadAt(b, vp.Offset+vp.Size-3); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		b[0] ^= 0x01
+		if _, err := f.WriteAt(b, vp.Offset+vp.Size-3); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		f.Close()
+
+		value, err := bc.Get("key")
+		if checksum == ChecksumNone {
+			// Nothing to verify against
+			if err != nil || value != "vamue" {
+				t.Fatalf("%v: got %q, %v, want the corrupt value", checksum, value, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrCorruptedEntry) || value != "" {
+			t.Fatalf("%v: got %q, %v, want ErrCorruptedEntry", checksum, value, err)
+		}
+	}
+}
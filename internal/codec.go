@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// All entry decoding goes through this file so the on-disk layout written by
+// Serialize is interpreted in exactly one place. Every data file format
+// extends the entry header of the previous one at the end:
+//
+//	format 0, 1: crc (4) | timestamp (8) | key size (4) | value size (4) | tombstone (1)
+//	format 2:    ... | version (8)
+//	format 3:    ... | expire at, unix nanos (8)
+//	format 4:    ... | meta (4)
+//	format 5:    same layout, the tombstone byte holds entryFlag bits
+//
+// There are three read variants:
+//
+//   - readLogEntry: header, key and value, for callers that need the whole entry
+//   - readLogEntryValue: header and value, checksum verified, for the Get path
+//   - readLogEntryHeaderAndKey: header and key only, for KeyDir recovery
+
+// Bits of the tombstone byte from format 5 on. Older formats only store 0
+// or 1 there.
+const (
+	entryFlagTombstone      = 1 << 0
+	entryFlagBatchContinues = 1 << 1
+)
+
+// entryHeaderSize returns the size of an entry header in the given format.
+func entryHeaderSize(format uint8) int64 {
+	switch {
+	case format < 2:
+		return 21
+	case format == 2:
+		return 29
+	case format == 3:
+		return 37
+	default:
+		return logEntryHeaderSize
+	}
+}
+
+// decodeHeader decodes the entry header at the start of buf.
+func decodeHeader(buf []byte, format uint8) (*Header, error) {
+	if int64(len(buf)) < entryHeaderSize(format) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	header := &Header{
+		Crc:       binary.BigEndian.Uint32(buf[0:4]),
+		Timestamp: int64(binary.BigEndian.Uint64(buf[4:12])),
+		KeySize:   binary.BigEndian.Uint32(buf[12:16]),
+		ValueSize: binary.BigEndian.Uint32(buf[16:20]),
+		Tombstone: buf[20] != 0,
+	}
+	if format >= 5 {
+		header.Tombstone = buf[20]&entryFlagTombstone != 0
+		header.BatchContinues = buf[20]&entryFlagBatchContinues != 0
+	}
+	if format >= 2 {
+		header.Version = binary.BigEndian.Uint64(buf[21:29])
+	}
+	if format >= 3 {
+		header.ExpireAt = int64(binary.BigEndian.Uint64(buf[29:37]))
+	}
+	if format >= 4 {
+		header.Meta = binary.BigEndian.Uint32(buf[37:41])
+	}
+	return header, nil
+}
+
+// decodeEntry decodes a complete serialized entry. buf must hold exactly one
+// entry. Key and Value alias buf.
+func decodeEntry(buf []byte, format uint8) (*LogEntry, error) {
+	header, err := decodeHeader(buf, format)
+	if err != nil {
+		return nil, err
+	}
+
+	keyStart := entryHeaderSize(format)
+	keyEnd := keyStart + int64(header.KeySize)
+	if keyEnd+int64(header.ValueSize) != int64(len(buf)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return &LogEntry{
+		Header: header,
+		Key:    buf[keyStart:keyEnd],
+		Value:  buf[keyEnd:],
+	}, nil
+}
+
+// readEntryBytes reads the size bytes of the entry at offset in one call.
+func readEntryBytes(file io.ReaderAt, offset int64, size int64) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if int64(n) != size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf, nil
+}
+
+// readLogEntry reads and decodes the whole entry of the given size at offset.
+func readLogEntry(file io.ReaderAt, format uint8, offset int64, size int64) (*LogEntry, error) {
+	if size < entryHeaderSize(format) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	buf, err := readEntryBytes(file, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEntry(buf, format)
+}
+
+// readLogEntryValue is readLogEntry for callers that already know the key:
+// the returned entry has a nil Key. Since the value goes back to the caller,
+// the entry is checked against its checksum first and ErrCorruptedEntry
+// returned if it doesn't match.
+func readLogEntryValue(file io.ReaderAt, format uint8, checksum ChecksumType, offset int64, size int64) (*LogEntry, error) {
+	if size < entryHeaderSize(format) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	buf, err := readEntryBytes(file, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	if err := checksum.verify(buf); err != nil {
+		return nil, err
+	}
+	entry, err := decodeEntry(buf, format)
+	if err != nil {
+		return nil, err
+	}
+	entry.Key = nil
+	return entry, nil
+}
+
+// readLogEntryHeader decodes only the header of the entry at offset.
+func readLogEntryHeader(file io.ReaderAt, format uint8, offset int64) (*Header, error) {
+	buf := make([]byte, entryHeaderSize(format))
+	if _, err := file.ReadAt(buf, offset); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return decodeHeader(buf, format)
+}
+
+// readLogEntryHeaderAndKey decodes the header and key of the entry at offset
+// without reading its value, which is all KeyDir recovery needs. The returned
+// entry has a nil Value; the size is the full on-disk size of the entry.
+// fileSize bounds the entry so a torn tail is reported as io.ErrUnexpectedEOF,
+// and sizes in a corrupt header never cause an allocation larger than the
+// file.
+func readLogEntryHeaderAndKey(file io.ReaderAt, format uint8, offset int64, fileSize int64) (*LogEntry, int64, error) {
+	if offset >= fileSize {
+		return nil, 0, io.EOF
+	}
+
+	headerSize := entryHeaderSize(format)
+	buf := make([]byte, headerSize)
+	if _, err := file.ReadAt(buf, offset); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	header, err := decodeHeader(buf, format)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size := headerSize + int64(header.KeySize) + int64(header.ValueSize)
+	if offset+size > fileSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	key := make([]byte, header.KeySize)
+	if _, err := file.ReadAt(key, offset+headerSize); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	return &LogEntry{Header: header, Key: key}, size, nil
+}
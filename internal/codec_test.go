@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestDecodeEntryRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		key, value string
+		tombstone  bool
+	}{
+		{"key", "value", false},
+		{"empty", "", false},
+		{"gone", "", true},
+		{"bin\x00ary", "line\r\nbreak\x00", false},
+	} {
+		entry := NewLogEntry(tc.key, tc.value, tc.tombstone)
+		got, err := decodeEntry(entry.Serialize(), dataFileVersion)
+		if err != nil {
+			t.Fatalf("decodeEntry(%q) failed: %v", tc.key, err)
+		}
+		if !reflect.DeepEqual(got.Header, entry.Header) {
+			t.Fatalf("header mismatch: got %+v, want %+v", got.Header, entry.Header)
+		}
+		if string(got.Key) != tc.key || string(got.Value) != tc.value {
+			t.Fatalf("got %q=%q, want %q=%q", got.Key, got.Value, tc.key, tc.value)
+		}
+	}
+}
+
+func TestDecodeEntryRejectsTruncated(t *testing.T) {
+	buf := NewLogEntry("key", "value", false).Serialize()
+
+	for _, n := range []int{0, logEntryHeaderSize - 1, logEntryHeaderSize, len(buf) - 1} {
+		if _, err := decodeEntry(buf[:n], dataFileVersion); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("decodeEntry of %d bytes: expected ErrUnexpectedEOF, got %v", n, err)
+		}
+	}
+}
+
+func TestReadVariantsAgree(t *testing.T) {
+	var file bytes.Buffer
+	first := NewLogEntry("first", "one", false)
+	second := NewLogEntry("second", "two", false)
+	file.Write(first.Serialize())
+	file.Write(second.Serialize())
+	r := bytes.NewReader(file.Bytes())
+
+	full, err := readLogEntry(r, dataFileVersion, first.Size(), second.Size())
+	if err != nil {
+		t.Fatalf("readLogEntry failed: %v", err)
+	}
+	value, err := readLogEntryValue(r, dataFileVersion, ChecksumCRC32C, first.Size(), second.Size())
+	if err != nil {
+		t.Fatalf("readLogEntryValue failed: %v", err)
+	}
+	keyOnly, size, err := readLogEntryHeaderAndKey(r, dataFileVersion, first.Size(), int64(file.Len()))
+	if err != nil {
+		t.Fatalf("readLogEntryHeaderAndKey failed: %v", err)
+	}
+
+	if string(full.Key) != "second" || string(full.Value) != "two" {
+		t.Fatalf("readLogEntry got %q=%q", full.Key, full.Value)
+	}
+	if value.Key != nil || string(value.Value) != "two" {
+		t.Fatalf("readLogEntryValue got %q=%q", value.Key, value.Value)
+	}
+	if string(keyOnly.Key) != "second" || keyOnly.Value != nil || size != second.Size() {
+		t.Fatalf("readLogEntryHeaderAndKey got %q=%q size %d", keyOnly.Key, keyOnly.Value, size)
+	}
+
+	// A torn tail is reported instead of decoded
+	torn := bytes.NewReader(file.Bytes()[:file.Len()-1])
+	if _, _, err := readLogEntryHeaderAndKey(torn, dataFileVersion, first.Size(), int64(file.Len()-1)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected ErrUnexpectedEOF for torn entry, got %v", err)
+	}
+}
+
+func TestForgedSizesDontAllocate(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	if err := bc.Put("good", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	path := bc.Files[bc.CurrentFileId].path
+	bc.Close()
+
+	// A header claiming a 1GB key and a 3GB value at the end of the file
+	forged := NewLogEntry("k", "v", false).Serialize()
+	binary.BigEndian.PutUint32(forged[12:16], 1<<30)
+	binary.BigEndian.PutUint32(forged[16:20], 3<<30)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	f.Write(forged)
+	f.Close()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	bc, err = Open(dir)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatalf("failed to open with a forged entry: %v", err)
+	}
+	defer bc.Close()
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Fatalf("Open allocated %d bytes for a forged header", allocated)
+	}
+	if got, err := bc.Get("good"); err != nil || got != "value" {
+		t.Fatalf("Get: got %q, %v", got, err)
+	}
+}
+
+func TestHeaderAndKeyRecoveryMatchesFullParse(t *testing.T) {
+	dir := t.TempDir()
+
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := bc.Put(fmt.Sprintf("key_%d", i%50), fmt.Sprintf("value_%d_%0100d", i, i)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	for i := 0; i < 50; i += 7 {
+		if _, err := bc.Delete(fmt.Sprintf("key_%d", i)); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+	}
+	bc.Close()
+
+	// Rebuild the index by fully decoding every entry, values included
+	data, err := os.ReadFile(dataFilePath(dir, 1, defaultDataFileExtension))
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+
+	want := make(map[string]ValuePointer)
+	for offset := int64(fileHeaderSize); offset < int64(len(data)); {
+		header, err := decodeHeader(data[offset:], dataFileVersion)
+		if err != nil {
+			t.Fatalf("decodeHeader failed: %v", err)
+		}
+		size := int64(logEntryHeaderSize) + int64(header.KeySize) + int64(header.ValueSize)
+		entry, err := decodeEntry(data[offset:offset+size], dataFileVersion)
+		if err != nil {
+			t.Fatalf("decodeEntry failed: %v", err)
+		}
+		if entry.IsDeleted() {
+			delete(want, string(entry.Key))
+		} else {
+			want[string(entry.Key)] = ValuePointer{FileId: 1, Offset: offset, Size: size, Version: entry.Header.Version}
+		}
+		offset += size
+	}
+
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if !reflect.DeepEqual(bc.KeyDir, want) {
+		t.Fatalf("KeyDir mismatch:\n got %v\nwant %v", bc.KeyDir, want)
+	}
+}
+
+// serializeLegacy encodes e in the headerless format 0 layout, which has no
+// version field.
+func serializeLegacy(e *LogEntry) []byte {
+	buf := e.Serialize()
+	legacy := append([]byte{}, buf[:21]...)
+	legacy = append(legacy, buf[logEntryHeaderSize:]...)
+	binary.BigEndian.PutUint32(legacy[0:4], calcCRC(legacy[4:]))
+	return legacy
+}
+
+func TestDecodeLegacyFormat(t *testing.T) {
+	entry := NewLogEntry("key", "value", false)
+	entry.Header.Version = 7
+
+	got, err := decodeEntry(serializeLegacy(entry), 0)
+	if err != nil {
+		t.Fatalf("decodeEntry failed: %v", err)
+	}
+	if string(got.Key) != "key" || string(got.Value) != "value" || got.Header.Version != 0 {
+		t.Fatalf("got %q=%q version %d", got.Key, got.Value, got.Header.Version)
+	}
+}
@@ -1,4 +1,46 @@
 package config
 
+import "sync/atomic"
+
 var Address = ":8080"
 var Protocol = "tcp"
+
+// Debug enables the DEBUG command family. It is set once at startup.
+var Debug = false
+
+// MaxLineLength is the longest inline command, in bytes, a connection
+// accepts. Longer commands are rejected with an error instead of dropping
+// the connection. It is set once at startup.
+var MaxLineLength = 64 * 1024 * 1024
+
+// rateLimit is the per-connection command limit in commands/sec, 0 disables it.
+// It can be changed at runtime via CONFIG SET so it is stored atomically.
+var rateLimit atomic.Int64
+
+func RateLimit() int64 {
+	return rateLimit.Load()
+}
+
+func SetRateLimit(limit int64) {
+	rateLimit.Store(limit)
+}
+
+// Output buffer limits of a connection, like Redis' client-output-buffer-limit:
+// a reply larger than the hard limit, or replies staying above the soft limit
+// for longer than the soft seconds, close the connection. 0 disables a limit.
+// They can be changed at runtime via CONFIG SET so they are stored atomically.
+var (
+	outputHardLimit   atomic.Int64
+	outputSoftLimit   atomic.Int64
+	outputSoftSeconds atomic.Int64
+)
+
+func OutputBufferLimit() (hard, soft, softSeconds int64) {
+	return outputHardLimit.Load(), outputSoftLimit.Load(), outputSoftSeconds.Load()
+}
+
+func SetOutputBufferLimit(hard, soft, softSeconds int64) {
+	outputHardLimit.Store(hard)
+	outputSoftLimit.Store(soft)
+	outputSoftSeconds.Store(softSeconds)
+}
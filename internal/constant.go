@@ -3,5 +3,50 @@ package internal
 import "time"
 
 const MaxActiveFileSize = 128 * 1024 * 1024 //128MB
-const logEntryHeaderSize = 21               // 4 + 8 + 4 + 4 + 1
-const syncInterval = 1 * time.Second
+const logEntryHeaderSize = 41               // 4 + 8 + 4 + 4 + 1 + 8 + 8 + 4, current format
+
+// Defaults of Options.SyncInterval and Options.WriteBufferSize
+const defaultSyncInterval = 1 * time.Second
+const defaultWriteBufferSize = 64 * 1024
+
+// LFU access counter tuning, mirroring Redis' lfu-log-factor and lfu-decay-time
+const lfuInitVal = 5
+const lfuLogFactor = 10
+const lfuDecayTime = 1 * time.Minute
+
+// Write circuit breaker: this many consecutive write failures within the
+// window switch the engine to read-only
+const degradeAfterFailures = 5
+const degradeWindow = 30 * time.Second
+
+// Bytes of a data file Options.RecoverCorrupt reads at a time, see
+// recoverRecords
+const recoverWindowSize = 1 << 20
+
+// Number of keys ForEachKey pulls per read lock acquisition
+const forEachBatchSize = 1024
+
+const manifestFileName = "MANIFEST"
+const manifestMagic = "GOCASK-MANIFEST 1"
+
+// Data file header, see fileHeader
+const fileMagic = "GCSK"
+const fileHeaderSize = 16
+const dataFileVersion = 5
+
+// Data files are named <id><extension>; files from before the extension was
+// configurable use legacyDataFileExtension and are still loaded
+const defaultDataFileExtension = ".gcask"
+const legacyDataFileExtension = ".log"
+
+// Shard indexes are stored in one byte of the data file header
+const maxShards = 256
+
+// Number of recent request ids PutIdempotent deduplicates against
+const requestIdWindow = 4096
+
+// How often the background retention enforcer looks for expired files
+const retentionCheckInterval = 1 * time.Minute
+
+// Number of mutexes read-modify-write operations hash keys onto
+const keyLockStripes = 256
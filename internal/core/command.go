@@ -2,6 +2,7 @@ package core
 
 import (
 	"errors"
+	"strconv"
 	"strings"
 )
 
@@ -10,8 +11,16 @@ type Command struct {
 	Args []string
 }
 
+// ParseCommand splits an inline command on whitespace. An argument can be
+// wrapped in double quotes to include spaces or to pass an empty string,
+// e.g. SET key "". Inside quotes, like in redis-cli, \" and \\ stand for a
+// quote and a backslash, \n, \r and \t for those control characters and
+// \xhh for any byte; other backslashes are kept as they are.
 func ParseCommand(cmd string) (*Command, error) {
-	tokens := strings.Split(cmd, " ")
+	tokens, err := splitArgs(cmd)
+	if err != nil {
+		return nil, err
+	}
 	if len(tokens) == 0 {
 		return nil, errors.New("invalid command: Please enter a command")
 	}
@@ -20,3 +29,69 @@ func ParseCommand(cmd string) (*Command, error) {
 		Args: tokens[1:],
 	}, nil
 }
+
+func splitArgs(line string) ([]string, error) {
+	var tokens []string
+	var sb strings.Builder
+	inToken, inQuotes := false, false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(line):
+			b, n := unescape(line[i+1:])
+			sb.WriteByte(b)
+			i += n
+		case inQuotes && c == '"':
+			inQuotes = false
+		case inQuotes:
+			sb.WriteByte(c)
+		case c == '"':
+			inToken, inQuotes = true, true
+		case isSpace(c):
+			if inToken {
+				tokens = append(tokens, sb.String())
+				sb.Reset()
+				inToken = false
+			}
+		default:
+			inToken = true
+			sb.WriteByte(c)
+		}
+	}
+
+	if inQuotes {
+		return nil, errors.New("invalid command: unbalanced quotes")
+	}
+	if inToken {
+		tokens = append(tokens, sb.String())
+	}
+	return tokens, nil
+}
+
+// unescape decodes the escape sequence whose backslash precedes rest. It
+// returns the byte it stands for and how many bytes of rest it used; a
+// backslash that starts no known sequence stands for itself.
+func unescape(rest string) (byte, int) {
+	switch rest[0] {
+	case '"', '\\':
+		return rest[0], 1
+	case 'n':
+		return '\n', 1
+	case 'r':
+		return '\r', 1
+	case 't':
+		return '\t', 1
+	case 'x':
+		if len(rest) >= 3 {
+			if b, err := strconv.ParseUint(rest[1:3], 16, 8); err == nil {
+				return byte(b), 3
+			}
+		}
+	}
+	return '\\', 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		cmd  string
+		args []string
+	}{
+		{"GET key", "GET", []string{"key"}},
+		{"SET msg hello", "SET", []string{"msg", "hello"}},
+		{`SET msg "hello world"`, "SET", []string{"msg", "hello world"}},
+		{`SET msg "  two  spaces  "`, "SET", []string{"msg", "  two  spaces  "}},
+		{`SET key ""`, "SET", []string{"key", ""}},
+		{`SET key "say \"hi\""`, "SET", []string{"key", `say "hi"`}},
+		{`SET key "back\\slash"`, "SET", []string{"key", `back\slash`}},
+		{`SET key "a\nb\tc\x41"`, "SET", []string{"key", "a\nb\tcA"}},
+		{`SET key "c:\dir"`, "SET", []string{"key", `c:\dir`}},
+		{`SET key pre"quoted part"`, "SET", []string{"key", "prequoted part"}},
+		{"SET key value   ", "SET", []string{"key", "value"}},
+		{"  SET\tkey\tvalue\r\n", "SET", []string{"key", "value"}},
+		{`SET key unquoted\ttab`, "SET", []string{"key", `unquoted\ttab`}},
+	} {
+		parsed, err := ParseCommand(tc.line)
+		if err != nil {
+			t.Fatalf("ParseCommand(%q) failed: %v", tc.line, err)
+		}
+		if parsed.Cmd != tc.cmd || !reflect.DeepEqual(parsed.Args, tc.args) {
+			t.Errorf("ParseCommand(%q) = %q %q, want %q %q", tc.line, parsed.Cmd, parsed.Args, tc.cmd, tc.args)
+		}
+	}
+
+	for _, line := range []string{"", "   ", `SET key "unterminated`, `SET key "ends in \"`} {
+		if _, err := ParseCommand(line); err == nil {
+			t.Errorf("ParseCommand(%q) accepted an invalid command", line)
+		}
+	}
+}
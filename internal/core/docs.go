@@ -0,0 +1,108 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commandDoc describes a command for COMMAND DOCS. Arity counts the command
+// name itself, like in Redis: a positive arity is exact, a negative one a
+// minimum.
+type commandDoc struct {
+	Arity   int
+	Summary string
+}
+
+// commandDocs documents the built-in commands. A command added with
+// RegisterCommand and missing here is listed with arity -1 and no summary.
+var commandDocs = map[string]commandDoc{
+	"GET":          {2, "Get the value of a key"},
+	"PUT":          {2, "Alias of GET"},
+	"SET":          {-3, "Set a key to hold a string value"},
+	"SETNX":        {3, "Set a key only if it does not exist"},
+	"GETSET":       {3, "Set a key and return its old value"},
+	"GETDEL":       {2, "Get the value of a key and delete it"},
+	"MGET":         {-2, "Get the values of several keys"},
+	"MSET":         {-3, "Set several keys to their values"},
+	"DEL":          {2, "Delete a key"},
+	"DELETE":       {2, "Alias of DEL"},
+	"SECUREDEL":    {2, "Delete a key and zero its value on disk"},
+	"SWAP":         {3, "Exchange the values of two keys"},
+	"CAS":          {4, "Set a key only if it holds the expected value"},
+	"APPEND":       {3, "Append a value to the string stored at key"},
+	"GETRANGE":     {4, "Get a substring of the value stored at key"},
+	"SETRANGE":     {4, "Overwrite part of the value stored at key"},
+	"INCR":         {2, "Increment the integer stored at key by one"},
+	"DECR":         {2, "Decrement the integer stored at key by one"},
+	"INCRBY":       {3, "Add an integer to the number stored at key"},
+	"DECRBY":       {3, "Subtract an integer from the number stored at key"},
+	"INCRBYFLOAT":  {3, "Add a float to the number stored at key"},
+	"EXISTS":       {-2, "Count how many of the keys exist"},
+	"TYPE":         {2, "Get the type of the value stored at key"},
+	"STRLEN":       {2, "Get the length of the value stored at key"},
+	"KEYS":         {-1, "List the keys matching a glob pattern, all without one"},
+	"SYNC":         {1, "Force sync to disk"},
+	"FLUSH":        {1, "Write buffered entries to the OS without fsync"},
+	"FLUSHDB":      {1, "Delete every key and its data files"},
+	"PING":         {-1, "Ping the server"},
+	"INFO":         {-1, "Get server information, optionally as JSON"},
+	"OBJECT":       {3, "Inspect the FREQ, VERSION or META of a key"},
+	"CONFIG":       {-3, "Get or set a server parameter"},
+	"DEBUG":        {-2, "Inspect data files and entries (-debug only)"},
+	"HEALTH":       {-1, "Check the engine can write, RESET clears degraded mode"},
+	"WARMUP":       {1, "Read all values once to pull them into the OS cache"},
+	"SCAN":         {2, "List the keys starting with a prefix, sorted"},
+	"SCANEXPIRE":   {2, "List keys expiring within the next seconds"},
+	"TTL":          {2, "Get the remaining time to live of a key in seconds"},
+	"PERSIST":      {2, "Remove the expiry of a key"},
+	"REBUILDHINTS": {1, "Regenerate hint files of sealed data files"},
+	"MERGE":        {1, "Compact sealed data files and report the space freed"},
+	"ROLL":         {1, "Seal the active data file and start a new one"},
+	"DUMPALL":      {1, "Dump all keys as one bulk string"},
+	"MEMORY":       {2, "Compare KeyDir memory with the data kept on disk"},
+	"COMMAND":      {-2, "Describe the commands of this server"},
+}
+
+// COMMAND refers to the command table, so it is added once the table exists.
+func init() {
+	commands["COMMAND"] = cmdCOMMAND
+}
+
+// cmdCOMMAND implements COMMAND DOCS [name ...]. The reply is an array with
+// one entry per command, sorted by name, each an array of the name, its
+// arity and a one-line summary. Unknown names are left out.
+func cmdCOMMAND(args []string) string {
+	if len(args) == 0 {
+		return "-ERR wrong number of arguments for 'COMMAND' command"
+	}
+	if strings.ToUpper(args[0]) != "DOCS" {
+		return fmt.Sprintf("-ERR unknown subcommand '%s' for 'COMMAND' command", args[0])
+	}
+
+	var names []string
+	if len(args) == 1 {
+		for name := range commands {
+			names = append(names, name)
+		}
+	} else {
+		for _, name := range args[1:] {
+			if name = strings.ToUpper(name); commands[name] != nil {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d", len(names))
+	for _, name := range names {
+		doc, ok := commandDocs[name]
+		if !ok {
+			doc.Arity = -1
+		}
+		fmt.Fprintf(&sb, "\r\n*3\r\n$%d\r\n%s\r\n:%d\r\n$%d\r\n%s",
+			len(name), name, doc.Arity, len(doc.Summary), doc.Summary)
+	}
+	return sb.String()
+}
@@ -0,0 +1,16 @@
+package core
+
+import "testing"
+
+func TestEveryCommandIsDocumented(t *testing.T) {
+	for name := range commands {
+		if _, ok := commandDocs[name]; !ok {
+			t.Errorf("command %s has no entry in commandDocs", name)
+		}
+	}
+	for name := range commandDocs {
+		if _, ok := commands[name]; !ok {
+			t.Errorf("commandDocs documents unknown command %s", name)
+		}
+	}
+}
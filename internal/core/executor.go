@@ -1,10 +1,20 @@
 package core
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/iscoreyagain/GoCask/internal"
+	"github.com/iscoreyagain/GoCask/internal/config"
 )
 
 var bc *internal.BitCask
@@ -13,28 +23,84 @@ func SetBitCask(bitcask *internal.BitCask) {
 	bc = bitcask
 }
 
-// ExecuteAndResponse executes a command and returns the response
-func ExecuteAndResponse(cmd *Command) string {
-	switch strings.ToUpper(cmd.Cmd) {
-	case "GET", "PUT":
-		return cmdGET(cmd.Args)
-	case "SET":
-		return cmdSET(cmd.Args)
-	case "DEL", "DELETE":
-		return cmdDEL(cmd.Args)
-	case "EXISTS":
-		return cmdEXISTS(cmd.Args)
-	case "KEYS":
-		return cmdKEYS(cmd.Args)
-	case "SYNC":
-		return cmdSYNC(cmd.Args)
-	case "PING":
-		return cmdPING(cmd.Args)
-	case "INFO":
-		return cmdINFO(cmd.Args)
-	default:
+// CommandFunc handles one command and returns its RESP-encoded reply.
+type CommandFunc func(args []string) string
+
+// commands maps upper-case command names to their handlers.
+var commands = map[string]CommandFunc{
+	"GET":          cmdGET,
+	"PUT":          cmdGET,
+	"SET":          cmdSET,
+	"SETNX":        cmdSETNX,
+	"GETSET":       cmdGETSET,
+	"GETDEL":       cmdGETDEL,
+	"MGET":         cmdMGET,
+	"MSET":         cmdMSET,
+	"DEL":          cmdDEL,
+	"DELETE":       cmdDEL,
+	"SECUREDEL":    cmdSECUREDEL,
+	"SWAP":         cmdSWAP,
+	"CAS":          cmdCAS,
+	"APPEND":       cmdAPPEND,
+	"GETRANGE":     cmdGETRANGE,
+	"SETRANGE":     cmdSETRANGE,
+	"INCR":         cmdINCR,
+	"DECR":         cmdDECR,
+	"INCRBY":       cmdINCRBY,
+	"DECRBY":       cmdDECRBY,
+	"INCRBYFLOAT":  cmdINCRBYFLOAT,
+	"EXISTS":       cmdEXISTS,
+	"TYPE":         cmdTYPE,
+	"STRLEN":       cmdSTRLEN,
+	"KEYS":         cmdKEYS,
+	"SYNC":         cmdSYNC,
+	"FLUSH":        cmdFLUSH,
+	"FLUSHDB":      cmdFLUSHDB,
+	"PING":         cmdPING,
+	"INFO":         cmdINFO,
+	"OBJECT":       cmdOBJECT,
+	"CONFIG":       cmdCONFIG,
+	"DEBUG":        cmdDEBUG,
+	"HEALTH":       cmdHEALTH,
+	"WARMUP":       cmdWARMUP,
+	"SCAN":         cmdSCAN,
+	"SCANEXPIRE":   cmdSCANEXPIRE,
+	"TTL":          cmdTTL,
+	"PERSIST":      cmdPERSIST,
+	"REBUILDHINTS": cmdREBUILDHINTS,
+	"MERGE":        cmdMERGE,
+	"ROLL":         cmdROLL,
+	"DUMPALL":      bufferStream(streamDUMPALL),
+	"MEMORY":       cmdMEMORY,
+}
+
+// RegisterCommand adds or replaces the handler of a command. It must be
+// called before the server starts accepting connections.
+func RegisterCommand(name string, fn CommandFunc) {
+	commands[strings.ToUpper(name)] = fn
+}
+
+// ExecuteAndResponse executes a command and returns the response. A panic in
+// a handler is logged with its stack and turned into an error reply, so one
+// bad command can't drop the connection or take the server down.
+func ExecuteAndResponse(cmd *Command) (response string) {
+	if cmd == nil {
+		return "-ERR invalid command"
+	}
+
+	fn, ok := commands[strings.ToUpper(cmd.Cmd)]
+	if !ok {
 		return fmt.Sprintf("-ERR unknown command '%s'", cmd.Cmd)
 	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic in command '%s': %v\n%s", cmd.Cmd, r, debug.Stack())
+			response = "-ERR internal error"
+		}
+	}()
+
+	return fn(cmd.Args)
 }
 
 func cmdGET(args []string) string {
@@ -44,26 +110,182 @@ func cmdGET(args []string) string {
 
 	key := args[0]
 	value, err := bc.Get(key)
+	if errors.Is(err, internal.ErrKeyNotFound) {
+		return "$-1"
+	}
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+
+	return fmt.Sprintf("$%d\r\n%s", len(value), value)
+}
+
+// cmdSETNX implements SETNX key value, replying :1 if the key was set and
+// :0 if it already existed.
+func cmdSETNX(args []string) string {
+	if len(args) != 2 {
+		return "-ERR wrong number of arguments for 'SETNX' command"
+	}
+
+	written, err := bc.PutIfAbsent(args[0], args[1])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	if written {
+		return ":1"
+	}
+	return ":0"
+}
+
+func cmdGETSET(args []string) string {
+	if len(args) != 2 {
+		return "-ERR wrong number of arguments for 'GETSET' command"
+	}
+
+	old, existed, err := bc.GetSet(args[0], args[1])
 	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	if !existed {
 		return "$-1"
 	}
+	return fmt.Sprintf("$%d\r\n%s", len(old), old)
+}
 
+func cmdGETDEL(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'GETDEL' command"
+	}
+
+	value, ok, err := bc.GetDel(args[0])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	if !ok {
+		return "$-1"
+	}
 	return fmt.Sprintf("$%d\r\n%s", len(value), value)
 }
 
+// cmdMGET implements MGET key [key ...], replying with an array holding the
+// value of each key, or a nil bulk string where it is missing.
+func cmdMGET(args []string) string {
+	if len(args) == 0 {
+		return "-ERR wrong number of arguments for 'MGET' command"
+	}
+
+	values, errs := bc.GetMany(args)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d", len(values))
+	for i, value := range values {
+		switch {
+		case errors.Is(errs[i], internal.ErrKeyNotFound):
+			sb.WriteString("\r\n$-1")
+		case errs[i] != nil:
+			return fmt.Sprintf("-ERR %v", errs[i])
+		default:
+			fmt.Fprintf(&sb, "\r\n$%d\r\n%s", len(value), value)
+		}
+	}
+	return sb.String()
+}
+
+// cmdMSET implements MSET key value [key value ...]. The keys are written
+// in one batch, so either all of them are set or none.
+func cmdMSET(args []string) string {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return "-ERR wrong number of arguments for 'MSET' command"
+	}
+
+	var batch internal.WriteBatch
+	for i := 0; i < len(args); i += 2 {
+		batch.Put(args[i], args[i+1])
+	}
+	if err := bc.Commit(&batch); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return "+OK"
+}
+
+// cmdSET implements SET key value [NX|XX] [EX seconds|PX milliseconds] [GET]
+// [META flags]. A value with spaces must be quoted; any other word after
+// the value is a syntax error.
 func cmdSET(args []string) string {
 	if len(args) < 2 {
 		return "-ERR wrong number of arguments for 'SET' command"
 	}
 
 	key := args[0]
-	value := strings.Join(args[1:], " ")
+	value := args[1]
+	var opts internal.SetOptions
+	if reply := parseSetOptions(args[2:], &opts); reply != "" {
+		return reply
+	}
 
-	if err := bc.Put(key, value); err != nil {
+	old, existed, written, err := bc.Set(key, value, opts)
+	if err != nil {
 		return fmt.Sprintf("-ERR %v", err)
 	}
 
-	return "+OK"
+	switch {
+	case opts.GetOld && !existed:
+		return "$-1"
+	case opts.GetOld:
+		return fmt.Sprintf("$%d\r\n%s", len(old), old)
+	case !written:
+		return "$-1"
+	default:
+		return "+OK"
+	}
+}
+
+// parseSetOptions fills opts from the options of a SET command. It returns
+// an error reply, or "" when the options are valid.
+func parseSetOptions(args []string, opts *internal.SetOptions) string {
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "NX", "XX":
+			if opts.Condition != internal.SetAlways {
+				return "-ERR syntax error"
+			}
+			opts.Condition = internal.SetIfAbsent
+			if option == "XX" {
+				opts.Condition = internal.SetIfPresent
+			}
+		case "EX", "PX":
+			if !opts.ExpireAt.IsZero() || i+1 == len(args) {
+				return "-ERR syntax error"
+			}
+			i++
+			ttl, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return "-ERR value is not an integer or out of range"
+			}
+			if ttl <= 0 {
+				return "-ERR invalid expire time in 'set' command"
+			}
+			unit := time.Second
+			if option == "PX" {
+				unit = time.Millisecond
+			}
+			opts.ExpireAt = time.Now().Add(time.Duration(ttl) * unit)
+		case "GET":
+			opts.GetOld = true
+		case "META":
+			if i+1 == len(args) {
+				return "-ERR syntax error"
+			}
+			i++
+			meta, err := strconv.ParseUint(args[i], 10, 32)
+			if err != nil {
+				return "-ERR value is not an integer or out of range"
+			}
+			opts.Meta = uint32(meta)
+		default:
+			return "-ERR syntax error"
+		}
+	}
+	return ""
 }
 
 func cmdDEL(args []string) string {
@@ -71,63 +293,312 @@ func cmdDEL(args []string) string {
 		return "-ERR wrong number of arguments for 'DEL' command"
 	}
 
-	key := args[0]
-	err := bc.Delete(key)
+	deleted, err := bc.Delete(args[0])
 	if err != nil {
-		return ":0"
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	if deleted {
+		return ":1"
+	}
+	return ":0"
+}
+
+// cmdSECUREDEL deletes a key and zeroes its value on disk, see
+// BitCask.SecureDelete.
+func cmdSECUREDEL(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'SECUREDEL' command"
 	}
 
+	err := bc.SecureDelete(args[0])
+	if errors.Is(err, internal.ErrKeyNotFound) {
+		return ":0"
+	}
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
 	return ":1"
 }
 
-func cmdEXISTS(args []string) string {
+func cmdSWAP(args []string) string {
+	if len(args) != 2 {
+		return "-ERR wrong number of arguments for 'SWAP' command"
+	}
+	if err := bc.Swap(args[0], args[1]); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return "+OK"
+}
+
+// cmdCAS implements CAS key expected new, replying 1 if the value was
+// swapped and 0 if the current value didn't match.
+func cmdCAS(args []string) string {
+	if len(args) != 3 {
+		return "-ERR wrong number of arguments for 'CAS' command"
+	}
+
+	swapped, err := bc.CompareAndSwap(args[0], args[1], args[2])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	if swapped {
+		return ":1"
+	}
+	return ":0"
+}
+
+// cmdAPPEND implements APPEND key value, replying with the new length.
+func cmdAPPEND(args []string) string {
+	if len(args) != 2 {
+		return "-ERR wrong number of arguments for 'APPEND' command"
+	}
+
+	n, err := bc.Append(args[0], args[1])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return fmt.Sprintf(":%d", n)
+}
+
+// cmdGETRANGE implements GETRANGE key start end, replying with an empty
+// string for a missing key like Redis.
+func cmdGETRANGE(args []string) string {
+	if len(args) != 3 {
+		return "-ERR wrong number of arguments for 'GETRANGE' command"
+	}
+	start, err1 := strconv.Atoi(args[1])
+	end, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return "-ERR value is not an integer or out of range"
+	}
+
+	value, err := bc.GetRange(args[0], start, end)
+	if err != nil && !errors.Is(err, internal.ErrKeyNotFound) {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return fmt.Sprintf("$%d\r\n%s", len(value), value)
+}
+
+// cmdSETRANGE implements SETRANGE key offset value, replying with the new
+// length.
+func cmdSETRANGE(args []string) string {
+	if len(args) != 3 {
+		return "-ERR wrong number of arguments for 'SETRANGE' command"
+	}
+	offset, err := strconv.Atoi(args[1])
+	if err != nil {
+		return "-ERR value is not an integer or out of range"
+	}
+	if offset < 0 {
+		return "-ERR offset is out of range"
+	}
+
+	n, err := bc.SetRange(args[0], offset, args[2])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return fmt.Sprintf(":%d", n)
+}
+
+func cmdINCR(args []string) string {
 	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'INCR' command"
+	}
+	return incrBy(args[0], 1)
+}
+
+func cmdDECR(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'DECR' command"
+	}
+	return incrBy(args[0], -1)
+}
+
+func cmdINCRBY(args []string) string {
+	if len(args) != 2 {
+		return "-ERR wrong number of arguments for 'INCRBY' command"
+	}
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return "-ERR value is not an integer or out of range"
+	}
+	return incrBy(args[0], delta)
+}
+
+func cmdDECRBY(args []string) string {
+	if len(args) != 2 {
+		return "-ERR wrong number of arguments for 'DECRBY' command"
+	}
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || delta == math.MinInt64 {
+		return "-ERR value is not an integer or out of range"
+	}
+	return incrBy(args[0], -delta)
+}
+
+// incrBy adds delta to the integer at key and replies with the result.
+func incrBy(key string, delta int64) string {
+	n, err := bc.Incr(key, delta)
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return fmt.Sprintf(":%d", n)
+}
+
+func cmdINCRBYFLOAT(args []string) string {
+	if len(args) != 2 {
+		return "-ERR wrong number of arguments for 'INCRBYFLOAT' command"
+	}
+	delta, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return "-ERR value is not a float"
+	}
+
+	value, err := bc.IncrByFloat(args[0], delta)
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return fmt.Sprintf("$%d\r\n%s", len(value), value)
+}
+
+// cmdEXISTS counts how many of the given keys exist. Like Redis, a key given
+// more than once is counted every time.
+func cmdEXISTS(args []string) string {
+	if len(args) == 0 {
 		return "-ERR wrong number of arguments for 'EXISTS' command"
 	}
 
-	key := args[0]
-	if _, exist := bc.KeyDir[key]; !exist {
+	count := 0
+	for _, key := range args {
+		if bc.Exists(key) {
+			count++
+		}
+	}
+	return fmt.Sprintf(":%d", count)
+}
+
+// cmdTYPE implements TYPE key. Every value is a string, so the reply is
+// string, or none for a missing key.
+func cmdTYPE(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'TYPE' command"
+	}
+	if bc.Exists(args[0]) {
+		return "+string"
+	}
+	return "+none"
+}
+
+// cmdSTRLEN implements STRLEN key, replying 0 for a missing key.
+func cmdSTRLEN(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'STRLEN' command"
+	}
+
+	n, err := bc.Strlen(args[0])
+	switch {
+	case errors.Is(err, internal.ErrKeyNotFound):
 		return ":0"
+	case err != nil:
+		return fmt.Sprintf("-ERR %v", err)
 	}
-	return ":1"
+	return fmt.Sprintf(":%d", n)
 }
 
+// cmdKEYS implements KEYS [pattern], listing the keys that match the glob
+// pattern, or every key without one.
 func cmdKEYS(args []string) string {
-	if len(args) != 0 {
+	if len(args) > 1 {
 		return "-ERR wrong number of arguments for 'KEYS' command"
 	}
-
-	var keys []string
-	for key := range bc.KeyDir {
-		keys = append(keys, key)
+	pattern := "*"
+	if len(args) == 1 {
+		pattern = args[0]
+	}
+	if err := checkGlob(pattern); err != nil {
+		return fmt.Sprintf("-ERR invalid pattern: %v", err)
 	}
 
-	if len(keys) == 0 {
-		return "*0\r\n"
+	// Only keys starting with the literal part of the pattern can match
+	prefix := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		prefix = pattern[:i]
+	}
+	candidates, err := bc.Scan(prefix)
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
 	}
 
-	result := fmt.Sprintf("*%d\r\n", len(keys))
-	for _, key := range keys {
-		result += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+	keys := make([]string, 0, len(candidates))
+	for _, key := range candidates {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
 	}
-	return result
+	return respArray(keys)
 }
 
 func cmdPING(args []string) string {
+	if err := bc.Ping(); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
 	if len(args) == 0 {
 		return "+PONG"
 	}
 	return fmt.Sprintf("$%d\r\n%s", len(args[0]), args[0])
 }
 
+// infoJSON is the INFO JSON reply, the same fields as the text format.
+type infoJSON struct {
+	RunId    string `json:"run_id"`
+	Degraded bool   `json:"degraded"`
+	internal.Stats
+	AvgEntrySize     int64 `json:"avg_entry_size"`
+	MasterReplOffset int64 `json:"master_repl_offset"`
+}
+
 func cmdINFO(args []string) string {
-	if len(args) != 0 {
+	asJSON := len(args) == 1 && strings.ToUpper(args[0]) == "JSON"
+	if len(args) != 0 && !asJSON {
 		return "-ERR wrong number of arguments for 'INFO' command"
 	}
-	bc.Mu.RLock()
-	info := fmt.Sprintf("# Server\r\nkeys=%d\r\nfiles=%d\r\n",
-		len(bc.KeyDir), len(bc.Files))
-	bc.Mu.RUnlock()
+	degraded := 0
+	if bc.Degraded() {
+		degraded = 1
+	}
+
+	replOffset := bc.ReplicationOffset()
+	stats := bc.Stats()
+	var avgEntrySize int64
+	if stats.Keys > 0 {
+		avgEntrySize = stats.LiveBytes / int64(stats.Keys)
+	}
+
+	if asJSON {
+		data, err := json.Marshal(infoJSON{
+			RunId:            bc.RunID(),
+			Degraded:         degraded == 1,
+			Stats:            stats,
+			AvgEntrySize:     avgEntrySize,
+			MasterReplOffset: replOffset,
+		})
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		return fmt.Sprintf("$%d\r\n%s", len(data), data)
+	}
+
+	info := fmt.Sprintf("# Server\r\nrun_id=%s\r\nkeys=%d\r\nfiles=%d\r\ndegraded=%d\r\n"+
+		"unsynced_bytes=%d\r\n"+
+		"# Memory\r\nlive_bytes=%d\r\navg_entry_size=%d\r\n"+
+		"# Stats\r\ntotal_disk_read_bytes=%d\r\ntotal_disk_written_bytes=%d\r\n"+
+		"total_entries_read=%d\r\ntotal_entries_written=%d\r\n"+
+		"recovery_duplicate_keys=%d\r\nrecovery_corrupt_entries=%d\r\n"+
+		"# Replication\r\nmaster_repl_offset=%d\r\n",
+		bc.RunID(), stats.Keys, stats.Files, degraded, stats.UnsyncedBytes,
+		stats.LiveBytes, avgEntrySize,
+		stats.BytesRead, stats.BytesWritten,
+		stats.EntriesRead, stats.EntriesWritten, stats.LoadDuplicates, stats.LoadCorrupt, replOffset)
 
 	return fmt.Sprintf("$%d\r\n%s", len(info), info)
 }
@@ -141,3 +612,486 @@ func cmdSYNC(args []string) string {
 	}
 	return "+OK"
 }
+
+func cmdFLUSH(args []string) string {
+	if len(args) != 0 {
+		return "-ERR wrong number of arguments for 'FLUSH' command"
+	}
+	if err := bc.Flush(); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return "+OK"
+}
+
+// cmdFLUSHDB deletes every key, see BitCask.FlushDB.
+func cmdFLUSHDB(args []string) string {
+	if len(args) != 0 {
+		return "-ERR wrong number of arguments for 'FLUSHDB' command"
+	}
+	if err := bc.FlushDB(); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return "+OK"
+}
+
+func cmdOBJECT(args []string) string {
+	if len(args) != 2 {
+		return "-ERR wrong number of arguments for 'OBJECT' command"
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "FREQ":
+		freq, ok := bc.AccessFrequency(args[1])
+		if !ok {
+			return "$-1"
+		}
+		return fmt.Sprintf(":%d", freq)
+	case "VERSION":
+		version, ok := bc.Version(args[1])
+		if !ok {
+			return "$-1"
+		}
+		return fmt.Sprintf(":%d", version)
+	case "META":
+		meta, ok := bc.GetMeta(args[1])
+		if !ok {
+			return "$-1"
+		}
+		return fmt.Sprintf(":%d", meta)
+	default:
+		return fmt.Sprintf("-ERR unknown subcommand '%s' for 'OBJECT' command", args[0])
+	}
+}
+
+func cmdCONFIG(args []string) string {
+	if len(args) < 2 {
+		return "-ERR wrong number of arguments for 'CONFIG' command"
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if len(args) != 2 {
+			return "-ERR wrong number of arguments for 'CONFIG GET' command"
+		}
+		switch strings.ToLower(args[1]) {
+		case "rate-limit":
+			value := strconv.FormatInt(config.RateLimit(), 10)
+			return respArray([]string{"rate-limit", value})
+		case "client-output-buffer-limit":
+			hard, soft, softSeconds := config.OutputBufferLimit()
+			value := fmt.Sprintf("%d %d %d", hard, soft, softSeconds)
+			return respArray([]string{"client-output-buffer-limit", value})
+		default:
+			return respArray(nil)
+		}
+	case "SET":
+		if len(args) != 3 {
+			return "-ERR wrong number of arguments for 'CONFIG SET' command"
+		}
+		switch strings.ToLower(args[1]) {
+		case "rate-limit":
+			limit, err := strconv.ParseInt(args[2], 10, 64)
+			if err != nil || limit < 0 {
+				return fmt.Sprintf("-ERR invalid value '%s' for 'rate-limit'", args[2])
+			}
+			config.SetRateLimit(limit)
+			return "+OK"
+		case "client-output-buffer-limit":
+			// "<hard bytes> <soft bytes> <soft seconds>", quoted as one argument
+			fields := strings.Fields(args[2])
+			limits := make([]int64, len(fields))
+			for i, field := range fields {
+				limit, err := strconv.ParseInt(field, 10, 64)
+				if err != nil || limit < 0 {
+					return fmt.Sprintf("-ERR invalid value '%s' for 'client-output-buffer-limit'", args[2])
+				}
+				limits[i] = limit
+			}
+			if len(limits) != 3 {
+				return fmt.Sprintf("-ERR invalid value '%s' for 'client-output-buffer-limit'", args[2])
+			}
+			config.SetOutputBufferLimit(limits[0], limits[1], limits[2])
+			return "+OK"
+		default:
+			return fmt.Sprintf("-ERR unknown parameter '%s'", args[1])
+		}
+	default:
+		return fmt.Sprintf("-ERR unknown subcommand '%s' for 'CONFIG' command", args[0])
+	}
+}
+
+func cmdDEBUG(args []string) string {
+	if !config.Debug {
+		return "-ERR DEBUG command not allowed. Start the server with -debug to enable it"
+	}
+	if len(args) == 0 {
+		return "-ERR wrong number of arguments for 'DEBUG' command"
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "FILES":
+		return debugFILES(args[1:])
+	case "POPULATE":
+		return debugPOPULATE(args[1:])
+	case "CRC":
+		return debugCRC(args[1:])
+	case "TAIL":
+		return debugTAIL(args[1:])
+	default:
+		return fmt.Sprintf("-ERR unknown subcommand '%s' for 'DEBUG' command", args[0])
+	}
+}
+
+// debugFILES lists every data file with its live/dead split, or with a file
+// id the live keys stored in that file.
+func debugFILES(args []string) string {
+	if len(args) > 1 {
+		return "-ERR wrong number of arguments for 'DEBUG FILES' command"
+	}
+	if len(args) == 1 {
+		fileId, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "-ERR value is not an integer or out of range"
+		}
+		keys, err := bc.KeysInFile(fileId)
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		return respArray(keys)
+	}
+
+	var sb strings.Builder
+	for _, fi := range bc.FileInfos() {
+		active := 0
+		if fi.Active {
+			active = 1
+		}
+		var created int64
+		if !fi.CreatedAt.IsZero() {
+			created = fi.CreatedAt.Unix()
+		}
+		fmt.Fprintf(&sb, "file=%06d size=%d live_keys=%d live_bytes=%d dead_bytes=%d active=%d created_at=%d\r\n",
+			fi.Id, fi.Size, fi.LiveKeys, fi.LiveBytes, fi.DeadBytes, active, created)
+	}
+	info := sb.String()
+
+	return fmt.Sprintf("$%d\r\n%s", len(info), info)
+}
+
+// debugTAIL lists the last count entries written, most recent first, live
+// or not.
+func debugTAIL(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'DEBUG TAIL' command"
+	}
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 0 {
+		return "-ERR value is not an integer or out of range"
+	}
+
+	entries, err := bc.Tail(count)
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+
+	var sb strings.Builder
+	for _, e := range entries {
+		op := "set"
+		if e.Tombstone {
+			op = "del"
+		}
+		fmt.Fprintf(&sb, "file=%06d offset=%d timestamp=%d version=%d op=%s key=%q value_size=%d\r\n",
+			e.FileId, e.Offset, e.Timestamp, e.Version, op, e.Key, len(e.Value))
+	}
+	info := sb.String()
+
+	return fmt.Sprintf("$%d\r\n%s", len(info), info)
+}
+
+// debugCRC re-reads the entry of a key from disk and reports the checksum
+// stored in it next to the one computed over its bytes.
+func debugCRC(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'DEBUG CRC' command"
+	}
+
+	stored, computed, kind, err := bc.KeyChecksum(args[0])
+	if errors.Is(err, internal.ErrKeyNotFound) {
+		return "-ERR no such key"
+	}
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+
+	match := 0
+	if stored == computed {
+		match = 1
+	}
+	info := fmt.Sprintf("checksum=%s stored=%08x computed=%08x match=%d", kind, stored, computed, match)
+	return fmt.Sprintf("$%d\r\n%s", len(info), info)
+}
+
+// populateBatchSize is how many writes debugPOPULATE puts in one batch.
+const populateBatchSize = 1000
+
+// debugPOPULATE creates count keys named prefix:N, "key" by default, holding
+// value:N, padded with 'x' or truncated to size bytes when size is given.
+// Like in Redis, keys that already exist are left alone. The keys are written
+// through WriteBatch, one batch per shard at a time, so a large population
+// costs a flush per batch rather than per key.
+func debugPOPULATE(args []string) string {
+	if len(args) < 1 || len(args) > 3 {
+		return "-ERR wrong number of arguments for 'DEBUG POPULATE' command"
+	}
+
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 0 {
+		return "-ERR value is not an integer or out of range"
+	}
+	prefix := "key"
+	if len(args) > 1 {
+		prefix = args[1]
+	}
+	size := -1
+	if len(args) > 2 {
+		if size, err = strconv.Atoi(args[2]); err != nil || size < 0 {
+			return "-ERR value is not an integer or out of range"
+		}
+	}
+
+	// A batch may only hold keys of one shard
+	batches := make(map[int]*internal.WriteBatch)
+	for i := 0; i < count; i++ {
+		key := fmt.Sprintf("%s:%d", prefix, i)
+		if bc.Exists(key) {
+			continue
+		}
+
+		value := fmt.Sprintf("value:%d", i)
+		if size >= 0 {
+			if len(value) > size {
+				value = value[:size]
+			} else {
+				value += strings.Repeat("x", size-len(value))
+			}
+		}
+
+		shard := bc.ShardOf(key)
+		batch, ok := batches[shard]
+		if !ok {
+			batch = &internal.WriteBatch{}
+			batches[shard] = batch
+		}
+		batch.Put(key, value)
+		if batch.Len() >= populateBatchSize {
+			if err := bc.Commit(batch); err != nil {
+				return fmt.Sprintf("-ERR %v", err)
+			}
+			delete(batches, shard)
+		}
+	}
+	for _, batch := range batches {
+		if err := bc.Commit(batch); err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+	}
+	return "+OK"
+}
+
+func cmdHEALTH(args []string) string {
+	if len(args) == 1 && strings.ToUpper(args[0]) == "RESET" {
+		bc.ResetDegraded()
+		return "+OK"
+	}
+	if len(args) != 0 {
+		return "-ERR wrong number of arguments for 'HEALTH' command"
+	}
+
+	if err := bc.Ping(); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	if err := bc.HealthCheck(); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return "+OK"
+}
+
+func cmdWARMUP(args []string) string {
+	if len(args) != 0 {
+		return "-ERR wrong number of arguments for 'WARMUP' command"
+	}
+	if err := bc.WarmUp(context.Background()); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return "+OK"
+}
+
+func cmdREBUILDHINTS(args []string) string {
+	if len(args) != 0 {
+		return "-ERR wrong number of arguments for 'REBUILDHINTS' command"
+	}
+	if err := bc.RebuildHints(); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return "+OK"
+}
+
+func cmdROLL(args []string) string {
+	if len(args) != 0 {
+		return "-ERR wrong number of arguments for 'ROLL' command"
+	}
+	if err := bc.Roll(); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return "+OK"
+}
+
+// cmdMERGE compacts every sealed data file and reports what it freed.
+func cmdMERGE(args []string) string {
+	if len(args) != 0 {
+		return "-ERR wrong number of arguments for 'MERGE' command"
+	}
+
+	res, err := bc.Merge()
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	info := fmt.Sprintf("merged_files=%d reclaimed_bytes=%d dropped_entries=%d",
+		res.Files, res.ReclaimedBytes, res.DroppedEntries)
+	return fmt.Sprintf("$%d\r\n%s", len(info), info)
+}
+
+// streamDUMPALL replies with a point-in-time dump of the whole keyspace, see
+// internal.NewDump, as one bulk string. The dump is streamed from the data
+// files to the connection, so neither its size nor the output buffer
+// limits bound it.
+func streamDUMPALL(args []string) (string, *StreamReply) {
+	if len(args) != 0 {
+		return "-ERR wrong number of arguments for 'DUMPALL' command", nil
+	}
+
+	d, err := bc.NewDump()
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err), nil
+	}
+	return "", &StreamReply{
+		Size: d.Size(),
+		WriteTo: func(w io.Writer) error {
+			_, err := d.WriteTo(w)
+			return err
+		},
+		Close: d.Close,
+	}
+}
+
+// cmdMEMORY reports, as name/value pairs, how much memory the KeyDir takes
+// next to the data kept on disk.
+func cmdMEMORY(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'MEMORY' command"
+	}
+	if strings.ToUpper(args[0]) != "STATS" {
+		return fmt.Sprintf("-ERR unknown subcommand '%s' for 'MEMORY' command", args[0])
+	}
+
+	ms := bc.MemoryStats()
+	return respArray([]string{
+		"keys", strconv.Itoa(ms.Keys),
+		"key_bytes", strconv.FormatInt(ms.KeyBytes, 10),
+		"keydir_bytes", strconv.FormatInt(ms.KeyDirBytes, 10),
+		"data_bytes", strconv.FormatInt(ms.DataBytes, 10),
+		"reclaimable_bytes", strconv.FormatInt(ms.ReclaimableBytes, 10),
+	})
+}
+
+// respArray encodes items as a RESP array of bulk strings. Like every reply
+// it leaves out the final \r\n, which the server appends.
+func respArray(items []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d", len(items))
+	for _, item := range items {
+		fmt.Fprintf(&sb, "\r\n$%d\r\n%s", len(item), item)
+	}
+	return sb.String()
+}
+
+// cmdSCAN implements SCAN prefix, listing the keys that start with prefix in
+// sorted order. Unlike the Redis command it takes no cursor and returns all
+// of them in one reply.
+func cmdSCAN(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'SCAN' command"
+	}
+
+	keys, err := bc.ScanSorted(args[0])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return respArray(keys)
+}
+
+// cmdTTL implements TTL key, replying with the seconds key has left, -1 if
+// it never expires and -2 if it doesn't exist.
+func cmdTTL(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'TTL' command"
+	}
+
+	ttl, err := bc.TTL(args[0])
+	switch {
+	case errors.Is(err, internal.ErrKeyNotFound):
+		return ":-2"
+	case err != nil:
+		return fmt.Sprintf("-ERR %v", err)
+	case ttl < 0:
+		return ":-1"
+	}
+	// Like Redis, round to the nearest second
+	return fmt.Sprintf(":%d", ttl.Round(time.Second)/time.Second)
+}
+
+// cmdPERSIST implements PERSIST key, replying 1 if it removed an expiry and
+// 0 if key doesn't exist or never expires.
+func cmdPERSIST(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'PERSIST' command"
+	}
+
+	ttl, err := bc.TTL(args[0])
+	switch {
+	case errors.Is(err, internal.ErrKeyNotFound):
+		return ":0"
+	case err != nil:
+		return fmt.Sprintf("-ERR %v", err)
+	case ttl < 0:
+		return ":0"
+	}
+
+	// The key may change before Persist takes the lock; that only makes
+	// the reply stale, not the key
+	err = bc.Persist(args[0])
+	switch {
+	case errors.Is(err, internal.ErrKeyNotFound):
+		return ":0"
+	case err != nil:
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return ":1"
+}
+
+func cmdSCANEXPIRE(args []string) string {
+	if len(args) != 1 {
+		return "-ERR wrong number of arguments for 'SCANEXPIRE' command"
+	}
+
+	seconds, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || seconds < 0 {
+		return "-ERR value is not an integer or out of range"
+	}
+
+	keys, err := bc.ExpiringBefore(time.Now().Add(time.Duration(seconds) * time.Second))
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return respArray(keys)
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FrameHandshake is the first byte a client sends to switch its connection
+// to length-delimited framing. No inline or RESP command starts with it.
+//
+// In framed mode every message, in both directions, is a 4-byte big-endian
+// length followed by that many bytes. A request carries the command and its
+// arguments, each as a 4-byte big-endian length followed by its bytes. A
+// reply carries what the server would otherwise send as text, without the
+// final \r\n. Nothing depends on newlines, so any byte may appear anywhere.
+const FrameHandshake byte = 0xFF
+
+// ErrFrameTooLarge is returned by ReadFrame for a frame over the size limit.
+// The frame has been skipped, so the next one can still be read.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// ReadFrame reads one length-delimited frame of at most max bytes.
+func ReadFrame(r io.Reader, max int) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	n := int64(binary.BigEndian.Uint32(hdr[:]))
+	if n > int64(max) {
+		if _, err := io.CopyN(io.Discard, r, n); err != nil {
+			return nil, err
+		}
+		return nil, ErrFrameTooLarge
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+// WriteFrame writes payload as one length-delimited frame.
+func WriteFrame(w io.Writer, payload []byte) error {
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(payload)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// EncodeCommand encodes a command and its arguments as a request payload.
+func EncodeCommand(args ...string) []byte {
+	size := 0
+	for _, arg := range args {
+		size += 4 + len(arg)
+	}
+
+	buf := make([]byte, 0, size)
+	for _, arg := range args {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(arg)))
+		buf = append(buf, arg...)
+	}
+	return buf
+}
+
+// DecodeCommand decodes a request payload built by EncodeCommand.
+func DecodeCommand(payload []byte) (*Command, error) {
+	var args []string
+	for len(payload) > 0 {
+		if len(payload) < 4 {
+			return nil, errors.New("invalid command: truncated argument length")
+		}
+		n := binary.BigEndian.Uint32(payload)
+		payload = payload[4:]
+		if uint64(n) > uint64(len(payload)) {
+			return nil, fmt.Errorf("invalid command: argument of %d bytes, %d left", n, len(payload))
+		}
+		args = append(args, string(payload[:n]))
+		payload = payload[n:]
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("invalid command: Please enter a command")
+	}
+	return &Command{Cmd: args[0], Args: args[1:]}, nil
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	args := []string{"SET", "key", "line\r\nbreak\x00", ""}
+
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, EncodeCommand(args...)); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+	if err := WriteFrame(&buf, []byte("+OK")); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	payload, err := ReadFrame(&buf, 1024)
+	if err != nil {
+		t.Fatalf("ReadFrame failed: %v", err)
+	}
+	cmd, err := DecodeCommand(payload)
+	if err != nil {
+		t.Fatalf("DecodeCommand failed: %v", err)
+	}
+	if got := append([]string{cmd.Cmd}, cmd.Args...); !reflect.DeepEqual(got, args) {
+		t.Fatalf("got %q, want %q", got, args)
+	}
+
+	if payload, err := ReadFrame(&buf, 1024); err != nil || string(payload) != "+OK" {
+		t.Fatalf("second frame: got %q, %v", payload, err)
+	}
+	if _, err := ReadFrame(&buf, 1024); err != io.EOF {
+		t.Fatalf("after the last frame: got %v, want io.EOF", err)
+	}
+}
+
+func TestReadFrameLimits(t *testing.T) {
+	var buf bytes.Buffer
+	WriteFrame(&buf, bytes.Repeat([]byte("x"), 100))
+	WriteFrame(&buf, []byte("next"))
+
+	// An oversized frame is skipped so the stream stays in sync
+	if _, err := ReadFrame(&buf, 10); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("got %v, want ErrFrameTooLarge", err)
+	}
+	if payload, err := ReadFrame(&buf, 10); err != nil || string(payload) != "next" {
+		t.Fatalf("frame after the oversized one: got %q, %v", payload, err)
+	}
+
+	WriteFrame(&buf, []byte("cut short"))
+	truncated := bytes.NewReader(buf.Bytes()[:buf.Len()-3])
+	if _, err := ReadFrame(truncated, 1024); err != io.ErrUnexpectedEOF {
+		t.Fatalf("truncated frame: got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestDecodeCommandRejectsMalformedPayloads(t *testing.T) {
+	for _, payload := range [][]byte{
+		nil,
+		{0, 0},
+		{0, 0, 0, 5, 'G', 'E', 'T'},
+	} {
+		if _, err := DecodeCommand(payload); err == nil {
+			t.Errorf("DecodeCommand(%q) succeeded", payload)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import "errors"
+
+// Glob patterns for KEYS follow Redis: * matches any run of bytes, ? any
+// single byte, [abc] one of the listed bytes, [a-z] a range, [^abc] any byte
+// not listed, and \ makes the next byte literal. Matching works on bytes,
+// not runes, so keys that aren't valid UTF-8 match like any other.
+
+var (
+	errGlobTrailingEscape = errors.New("pattern ends with an escape")
+	errGlobUnterminated   = errors.New("unterminated '[' in pattern")
+)
+
+// checkGlob reports whether pattern is well formed, so a bad pattern is
+// rejected once instead of failing to match every key.
+func checkGlob(pattern string) error {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i == len(pattern)-1 {
+				return errGlobTrailingEscape
+			}
+			i++
+		case '[':
+			end := classEnd(pattern[i:])
+			if end < 0 {
+				return errGlobUnterminated
+			}
+			i += end
+		}
+	}
+	return nil
+}
+
+// globMatch reports whether s matches pattern, which checkGlob accepted.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+
+		case '[':
+			end := classEnd(pattern)
+			if len(s) == 0 || !classMatch(pattern[1:end], s[0]) {
+				return false
+			}
+			pattern, s = pattern[end+1:], s[1:]
+
+		case '\\':
+			pattern = pattern[1:]
+			fallthrough
+
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// classEnd returns the index of the ']' closing the class pattern starts
+// with, or -1 if there is none.
+func classEnd(pattern string) int {
+	for i := 1; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// classMatch reports whether c is in the class body, the part of a [...]
+// between the brackets.
+func classMatch(class string, c byte) bool {
+	negate := len(class) > 0 && class[0] == '^'
+	if negate {
+		class = class[1:]
+	}
+
+	matched := false
+	for i := 0; i < len(class); i++ {
+		lo := class[i]
+		if lo == '\\' && i+1 < len(class) {
+			i++
+			lo = class[i]
+		}
+		hi := lo
+		if i+2 < len(class) && class[i+1] == '-' {
+			hi = class[i+2]
+			if hi == '\\' && i+3 < len(class) {
+				hi = class[i+3]
+				i++
+			}
+			i += 2
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	return matched != negate
+}
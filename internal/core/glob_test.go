@@ -0,0 +1,49 @@
+package core
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"*:1", "user:1", true},
+		{"u*r*1", "user:1", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"key[0-9]", "key7", true},
+		{"key[9-0]", "key7", true},
+		{"key[0-9]", "keyx", false},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+		{"[\\]]", "]", true},
+		{"exact", "exact", true},
+		{"exact", "Exact", false},
+		{"exact", "exact ", false},
+		{"caf\xc3\xa9", "caf\xc3\xa9", true},
+		{"caf?", "caf\xc3\xa9", false},
+		{"caf??", "caf\xc3\xa9", true},
+		{"a**b", "axxb", true},
+	} {
+		if err := checkGlob(tc.pattern); err != nil {
+			t.Fatalf("checkGlob(%q): %v", tc.pattern, err)
+		}
+		if got := globMatch(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+
+	for _, pattern := range []string{"user[", "a\\", "[abc"} {
+		if err := checkGlob(pattern); err == nil {
+			t.Errorf("checkGlob(%q) accepted an invalid pattern", pattern)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"runtime/debug"
+	"strings"
+)
+
+// StreamReply is a bulk string reply written straight to the connection
+// instead of being built in memory, for replies that can be as large as the
+// dataset. Size is the length of the bulk string; WriteTo must write exactly
+// that many bytes. Close is called once the reply has been sent or dropped.
+type StreamReply struct {
+	Size    int64
+	WriteTo func(w io.Writer) error
+	Close   func()
+}
+
+// StreamFunc handles a command whose reply may be streamed. It returns
+// either a plain reply, such as an error, or a stream.
+type StreamFunc func(args []string) (string, *StreamReply)
+
+// streamCommands maps upper-case command names to handlers that can stream
+// their reply. Each also has an entry in commands, see bufferStream, for
+// callers of ExecuteAndResponse.
+var streamCommands = map[string]StreamFunc{
+	"DUMPALL": streamDUMPALL,
+}
+
+// Execute is ExecuteAndResponse, except that a command in streamCommands
+// returns its reply as a stream for the caller to write and close.
+func Execute(cmd *Command) (response string, stream *StreamReply) {
+	if cmd == nil {
+		return ExecuteAndResponse(cmd), nil
+	}
+	fn, ok := streamCommands[strings.ToUpper(cmd.Cmd)]
+	if !ok {
+		return ExecuteAndResponse(cmd), nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic in command '%s': %v\n%s", cmd.Cmd, r, debug.Stack())
+			response, stream = "-ERR internal error", nil
+		}
+	}()
+
+	return fn(cmd.Args)
+}
+
+// bufferStream turns a StreamFunc into a CommandFunc that builds the whole
+// reply in memory.
+func bufferStream(fn StreamFunc) CommandFunc {
+	return func(args []string) string {
+		reply, stream := fn(args)
+		if stream == nil {
+			return reply
+		}
+		defer stream.Close()
+
+		var buf bytes.Buffer
+		if err := stream.WriteTo(&buf); err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		return fmt.Sprintf("$%d\r\n%s", buf.Len(), buf.Bytes())
+	}
+}
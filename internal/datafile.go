@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Every data file created by this version starts with a fixed-size header:
+//
+//	magic "GCSK" (4) | version (1) | checksum (1) | shard (1) | reserved (1) | created at, unix nanos (8)
+//
+// Files written before the header existed start directly with entries; they
+// are read as version 0 with CRC32C checksums.
+type fileHeader struct {
+	Version   uint8
+	Checksum  ChecksumType
+	Shard     uint8 // index of the shard that appends to this file
+	CreatedAt int64
+}
+
+// dataStart returns the offset of the first entry in the file.
+func (h fileHeader) dataStart() int64 {
+	if h.Version == 0 {
+		return 0
+	}
+	return fileHeaderSize
+}
+
+func newFileHeader(checksum ChecksumType, shard int, createdAt time.Time) fileHeader {
+	return fileHeader{
+		Version:   dataFileVersion,
+		Checksum:  checksum,
+		Shard:     uint8(shard),
+		CreatedAt: createdAt.UnixNano(),
+	}
+}
+
+func (h fileHeader) encode() []byte {
+	buf := make([]byte, fileHeaderSize)
+	copy(buf[0:4], fileMagic)
+	buf[4] = h.Version
+	buf[5] = byte(h.Checksum)
+	buf[6] = h.Shard
+	binary.BigEndian.PutUint64(buf[8:16], uint64(h.CreatedAt))
+	return buf
+}
+
+// readFileHeader decodes the header of file, falling back to the legacy
+// headerless layout when the magic is missing.
+func readFileHeader(file *os.File) (fileHeader, error) {
+	buf := make([]byte, fileHeaderSize)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return fileHeader{}, err
+	}
+
+	if n < fileHeaderSize || !bytes.Equal(buf[0:4], []byte(fileMagic)) {
+		return fileHeader{Version: 0, Checksum: ChecksumCRC32C}, nil
+	}
+
+	return fileHeader{
+		Version:   buf[4],
+		Checksum:  ChecksumType(buf[5]),
+		Shard:     buf[6],
+		CreatedAt: int64(binary.BigEndian.Uint64(buf[8:16])),
+	}, nil
+}
+
+// hasMagic reports whether the file started with the data file magic, as
+// opposed to a legacy headerless file.
+func (h fileHeader) hasMagic() bool {
+	return h.Version > 0
+}
+
+// dataFilePath returns the path of data file id in dir.
+func dataFilePath(dir string, id int, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d%s", id, ext))
+}
+
+// listDataFiles maps the id of every data file in dir to its path. Files
+// named <id>ext and, for data written by older versions, <id>.log are data
+// files; anything else is ignored. Two files with the same id are an error.
+func listDataFiles(dir string, ext string) (map[int]string, error) {
+	exts := []string{ext}
+	if ext != legacyDataFileExtension {
+		exts = append(exts, legacyDataFileExtension)
+	}
+
+	files := make(map[int]string)
+	for _, e := range exts {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+e))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range matches {
+			id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(file), e))
+			if err != nil {
+				continue
+			}
+			if other, ok := files[id]; ok {
+				return nil, fmt.Errorf("data files %s and %s have the same id", other, file)
+			}
+			files[id] = file
+		}
+	}
+	return files, nil
+}
+
+// dataFile is a reference-counted handle to an open data file. Files holds
+// one reference for as long as the file is part of the database, and readers
+// that use a file after releasing bc.Mu take their own with acquire. A
+// retired file is closed, and removed if asked to, only when its last
+// reference is released, so a roll or merge never pulls a file out from
+// under an in-flight read.
+type dataFile struct {
+	path   string
+	file   *os.File
+	header fileHeader
+	refs   atomic.Int64
+	remove atomic.Bool
+	// Timestamp of the newest entry, once a retention check has scanned
+	// the sealed file. Guarded by bc.Mu.
+	newestAt    int64
+	newestKnown bool
+}
+
+func newDataFile(path string, file *os.File, header fileHeader) *dataFile {
+	df := &dataFile{path: path, file: file, header: header}
+	df.refs.Store(1)
+	return df
+}
+
+// acquire takes a reference on df. Callers hold bc.Mu and found df in Files,
+// which guarantees it has not been closed yet.
+func (df *dataFile) acquire() {
+	df.refs.Add(1)
+}
+
+func (df *dataFile) release() error {
+	if df.refs.Add(-1) > 0 {
+		return nil
+	}
+
+	err := df.file.Close()
+	if df.remove.Load() {
+		if rmErr := os.Remove(df.path); err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
+
+// retire drops the reference held by Files, unlinking the file once no
+// reader uses it when remove is set. Callers hold bc.Mu for writing and
+// have already taken df out of Files.
+func (df *dataFile) retire(remove bool) error {
+	df.remove.Store(remove)
+	return df.release()
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetiredFileOutlivesItsReaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "000001.log")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	df := newDataFile(path, f, newFileHeader(ChecksumCRC32C, 0, time.Now()))
+	df.acquire()
+
+	if err := df.retire(true); err != nil {
+		t.Fatalf("retire failed: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file removed while still pinned: %v", err)
+	}
+	if _, err := df.file.Stat(); err != nil {
+		t.Fatalf("file closed while still pinned: %v", err)
+	}
+
+	if err := df.release(); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected file to be removed after the last release, got %v", err)
+	}
+}
+
+func TestGetDuringRolls(t *testing.T) {
+	bc := openTestDB(t)
+
+	const keys = 100
+	for i := 0; i < keys; i++ {
+		if err := bc.Put(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// Each roll keeps another file open, so bound the number of rolls
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			bc.Mu.Lock()
+			if err := bc.RollNewFile(); err != nil {
+				t.Errorf("RollNewFile failed: %v", err)
+			}
+			bc.Mu.Unlock()
+			if err := bc.Put(fmt.Sprintf("key-%d", i%keys), fmt.Sprintf("value-%d", i%keys)); err != nil {
+				t.Errorf("Put failed: %v", err)
+			}
+		}
+	}()
+
+	for round := 0; round < 20; round++ {
+		for i := 0; i < keys; i++ {
+			value, err := bc.Get(fmt.Sprintf("key-%d", i))
+			if err != nil || value != fmt.Sprintf("value-%d", i) {
+				t.Fatalf("key-%d: got %q, %v", i, value, err)
+			}
+		}
+	}
+}
+
+// TestGetActiveFileDuringRolls reads a key whose latest value is always in
+// the active file, from several goroutines, while that file keeps being
+// sealed. Readers pin the file and read without holding bc.Mu, so this
+// relies on the handle they pinned staying open across the roll; run it
+// with -race.
+func TestGetActiveFileDuringRolls(t *testing.T) {
+	bc := openTestDB(t)
+	if err := bc.Put("hot", "0"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	const rolls = 200
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := -1
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				value, err := bc.Get("hot")
+				if err != nil {
+					t.Errorf("Get failed: %v", err)
+					return
+				}
+				var n int
+				fmt.Sscan(value, &n)
+				if n < last {
+					t.Errorf("Get went back from %d to %d", last, n)
+					return
+				}
+				last = n
+			}
+		}()
+	}
+
+	for i := 1; i <= rolls; i++ {
+		if err := bc.Put("hot", fmt.Sprint(i)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if err := bc.Roll(); err != nil {
+			t.Fatalf("Roll failed: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if value, err := bc.Get("hot"); err != nil || value != fmt.Sprint(rolls) {
+		t.Fatalf("Get after rolls = %q, %v", value, err)
+	}
+}
+
+func TestLoadFilesIgnoresForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	active := bc.Files[bc.CurrentFileId].path
+	bc.Close()
+
+	if filepath.Ext(active) != defaultDataFileExtension {
+		t.Fatalf("new data file %s does not use the %s extension", active, defaultDataFileExtension)
+	}
+
+	// Files that only look like data files by name must not be parsed
+	for _, name := range []string{"000007.gcask", "server.log", "notes.gcask"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("not a data file\n"), 0644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if _, ok := bc.Files[7]; ok {
+		t.Fatalf("foreign file 000007.gcask was loaded")
+	}
+	if got, err := bc.Get("key"); err != nil || got != "value" {
+		t.Fatalf("Get: got %q, %v", got, err)
+	}
+	if len(bc.KeyDir) != 1 {
+		t.Fatalf("got %d keys, want 1", len(bc.KeyDir))
+	}
+}
@@ -0,0 +1,55 @@
+package internal
+
+// requestIdCache remembers the last requestIdWindow request ids accepted by
+// PutIdempotent. Ids are evicted in FIFO order from a fixed ring, so memory
+// stays bounded however many requests come in.
+type requestIdCache struct {
+	ring []string
+	next int
+	seen map[string]struct{}
+}
+
+func newRequestIdCache(size int) *requestIdCache {
+	return &requestIdCache{
+		ring: make([]string, size),
+		seen: make(map[string]struct{}, size),
+	}
+}
+
+func (c *requestIdCache) contains(id string) bool {
+	_, ok := c.seen[id]
+	return ok
+}
+
+// add records id, evicting the oldest id once the ring is full.
+func (c *requestIdCache) add(id string) {
+	if old := c.ring[c.next]; old != "" {
+		delete(c.seen, old)
+	}
+	c.ring[c.next] = id
+	c.seen[id] = struct{}{}
+	c.next = (c.next + 1) % len(c.ring)
+}
+
+// PutIdempotent is Put for clients that retry after an ambiguous failure,
+// like a timeout. A write whose requestID was already accepted among the
+// last requestIdWindow idempotent writes is a no-op that returns nil, so a
+// retry is never appended twice. The window is kept in memory only and
+// starts empty after a restart.
+func (bc *BitCask) PutIdempotent(key, value, requestID string) error {
+	if requestID == "" {
+		return bc.Put(key, value)
+	}
+
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if bc.requestIds.contains(requestID) {
+		return nil
+	}
+	if err := bc.put(key, value); err != nil {
+		return err
+	}
+	bc.requestIds.add(requestID)
+	return nil
+}
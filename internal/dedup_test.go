@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPutIdempotentSkipsRetries(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.PutIdempotent("key", "first", "req-1"); err != nil {
+		t.Fatalf("PutIdempotent failed: %v", err)
+	}
+	written := bc.Stats().BytesWritten
+
+	if err := bc.PutIdempotent("key", "retry", "req-1"); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if got := bc.Stats().BytesWritten; got != written {
+		t.Fatalf("retry appended %d bytes", got-written)
+	}
+	if value, _ := bc.Get("key"); value != "first" {
+		t.Fatalf("got %q, want first", value)
+	}
+
+	if err := bc.PutIdempotent("key", "second", "req-2"); err != nil {
+		t.Fatalf("PutIdempotent failed: %v", err)
+	}
+	if value, _ := bc.Get("key"); value != "second" {
+		t.Fatalf("got %q, want second", value)
+	}
+}
+
+func TestRequestIdCacheEvictsOldest(t *testing.T) {
+	c := newRequestIdCache(3)
+	for i := 0; i < 4; i++ {
+		c.add(fmt.Sprintf("req-%d", i))
+	}
+
+	if c.contains("req-0") {
+		t.Fatalf("req-0 should have been evicted")
+	}
+	for i := 1; i < 4; i++ {
+		if !c.contains(fmt.Sprintf("req-%d", i)) {
+			t.Fatalf("req-%d should still be in the window", i)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package internal
+
+import "os"
+
+// syncDir fsyncs a directory so that files created in, or renamed into, it
+// are durably linked. Without it a crash right after RollNewFile or a
+// rename can leave a file whose data was synced but whose directory entry
+// was not, and recovery would never see it (notably on ext4 and xfs).
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package internal
+
+// syncDir is a no-op on Windows: directories can't be opened for fsync and
+// NTFS journals directory entries itself.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+	"time"
+)
+
+// A dump is a self-contained copy of the live keyspace, as sent by DUMPALL:
+//
+//	magic "GCDP" (4)
+//	records: key size (4) | value size (4) | expire at, unix nanos (8) | key | value
+//	end: 0xFFFFFFFF (4) | record count (8) | crc32c of everything before it (4)
+//
+// The end marker makes the stream self-terminating and the checksum catches a
+// transfer that was cut short or damaged.
+const dumpMagic = "GCDP"
+const dumpEndMarker = 0xFFFFFFFF
+
+var ErrDumpCorrupt = errors.New("dump corrupt")
+
+// Dump writes every live key to w as of one point in time, see NewDump.
+func (bc *BitCask) Dump(w io.Writer) error {
+	d, err := bc.NewDump()
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	_, err = d.WriteTo(w)
+	return err
+}
+
+// DumpSnapshot is a dump taken by NewDump and not written yet. Its size is
+// known up front, so it can be sent as a bulk string without building it in
+// memory first.
+type DumpSnapshot struct {
+	bc       *BitCask
+	keys     []string
+	pointers map[string]ValuePointer
+	files    map[int]*dataFile
+	size     int64
+}
+
+// NewDump takes a point-in-time snapshot of every live key for a dump. The
+// KeyDir is copied and every data file pinned under a single read lock;
+// WriteTo then reads the values with no lock held, so writes carry on while
+// the dump is written without showing up in it. The snapshot holds on to
+// the data files until Close.
+func (bc *BitCask) NewDump() (*DumpSnapshot, error) {
+	bc.Mu.RLock()
+	if err := bc.checkFullIndex(); err != nil {
+		bc.Mu.RUnlock()
+		return nil, err
+	}
+	now := time.Now()
+	d := &DumpSnapshot{
+		bc:       bc,
+		pointers: make(map[string]ValuePointer, len(bc.KeyDir)),
+		files:    make(map[int]*dataFile, len(bc.Files)),
+		size:     int64(len(dumpMagic)) + 16,
+	}
+	for key, vp := range bc.KeyDir {
+		if !vp.expired(now) {
+			d.pointers[key] = vp
+		}
+	}
+	for id, df := range bc.Files {
+		df.acquire()
+		d.files[id] = df
+	}
+	bc.Mu.RUnlock()
+
+	d.keys = make([]string, 0, len(d.pointers))
+	for key, vp := range d.pointers {
+		d.keys = append(d.keys, key)
+		valueSize := vp.Size - entryHeaderSize(d.files[vp.FileId].header.Version) - int64(len(key))
+		d.size += 16 + int64(len(key)) + valueSize
+	}
+	sort.Strings(d.keys)
+	return d, nil
+}
+
+// Size returns the number of bytes WriteTo writes.
+func (d *DumpSnapshot) Size() int64 {
+	return d.size
+}
+
+// WriteTo writes the dump to w.
+func (d *DumpSnapshot) WriteTo(w io.Writer) (int64, error) {
+	crc := crc32.New(castagnoliTable)
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(io.MultiWriter(cw, crc))
+	bw.WriteString(dumpMagic)
+
+	var hdr [16]byte
+	for _, key := range d.keys {
+		vp := d.pointers[key]
+		value, err := d.bc.readValue(d.files[vp.FileId], vp)
+		if err != nil {
+			return cw.n, fmt.Errorf("failed to read %q: %w", key, err)
+		}
+
+		binary.BigEndian.PutUint32(hdr[0:4], uint32(len(key)))
+		binary.BigEndian.PutUint32(hdr[4:8], uint32(len(value)))
+		binary.BigEndian.PutUint64(hdr[8:16], uint64(vp.ExpireAt))
+		bw.Write(hdr[:])
+		bw.WriteString(key)
+		bw.WriteString(value)
+	}
+
+	var end [12]byte
+	binary.BigEndian.PutUint32(end[0:4], dumpEndMarker)
+	binary.BigEndian.PutUint64(end[4:12], uint64(len(d.keys)))
+	bw.Write(end[:])
+	if err := bw.Flush(); err != nil {
+		return cw.n, err
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	_, err := cw.Write(sum[:])
+	return cw.n, err
+}
+
+// Close releases the data files pinned by the snapshot.
+func (d *DumpSnapshot) Close() {
+	for _, df := range d.files {
+		df.release()
+	}
+	d.files = nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ReadDump decodes a dump written by Dump, calling fn for every record. It
+// reads exactly up to the end of the dump and fails with ErrDumpCorrupt if
+// the stream is truncated or its checksum doesn't match. Records are passed
+// to fn as they are decoded, before the checksum is checked.
+func ReadDump(r io.Reader, fn func(key, value string, expireAt int64) error) error {
+	crc := crc32.New(castagnoliTable)
+	tr := io.TeeReader(r, crc)
+
+	magic := make([]byte, len(dumpMagic))
+	if err := readDumpFull(tr, magic); err != nil {
+		return err
+	}
+	if string(magic) != dumpMagic {
+		return fmt.Errorf("%w: bad magic", ErrDumpCorrupt)
+	}
+
+	var records uint64
+	var hdr [16]byte
+	for {
+		if err := readDumpFull(tr, hdr[:4]); err != nil {
+			return err
+		}
+		keySize := binary.BigEndian.Uint32(hdr[0:4])
+		if keySize == dumpEndMarker {
+			return readDumpEnd(tr, r, crc, records)
+		}
+
+		if err := readDumpFull(tr, hdr[4:16]); err != nil {
+			return err
+		}
+		valueSize := binary.BigEndian.Uint32(hdr[4:8])
+		expireAt := int64(binary.BigEndian.Uint64(hdr[8:16]))
+
+		// Read through a LimitReader rather than into a buffer of the
+		// announced size, so a damaged size field can't force a huge
+		// allocation before the stream runs out
+		size := int64(keySize) + int64(valueSize)
+		buf, err := io.ReadAll(io.LimitReader(tr, size))
+		if err != nil {
+			return err
+		}
+		if int64(len(buf)) != size {
+			return fmt.Errorf("%w: truncated", ErrDumpCorrupt)
+		}
+		if err := fn(string(buf[:keySize]), string(buf[keySize:]), expireAt); err != nil {
+			return err
+		}
+		records++
+	}
+}
+
+// readDumpEnd checks the record count and the trailing checksum, which is
+// read from r directly as it is not part of the checksummed bytes.
+func readDumpEnd(tr, r io.Reader, crc hash.Hash32, records uint64) error {
+	var count [8]byte
+	if err := readDumpFull(tr, count[:]); err != nil {
+		return err
+	}
+	want := crc.Sum32()
+
+	var sum [4]byte
+	if err := readDumpFull(r, sum[:]); err != nil {
+		return err
+	}
+	if got := binary.BigEndian.Uint32(sum[:]); got != want {
+		return fmt.Errorf("%w: checksum %08x, want %08x", ErrDumpCorrupt, got, want)
+	}
+	if n := binary.BigEndian.Uint64(count[:]); n != records {
+		return fmt.Errorf("%w: %d records, end marker says %d", ErrDumpCorrupt, records, n)
+	}
+	return nil
+}
+
+func readDumpFull(r io.Reader, buf []byte) error {
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: truncated", ErrDumpCorrupt)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDumpRoundTrip(t *testing.T) {
+	bc := openTestDB(t)
+
+	want := map[string]string{"a": "1", "bin": "x\r\n\x00y", "empty": ""}
+	for key, value := range want {
+		if err := bc.Put(key, value); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	expireAt := time.Now().Add(time.Hour)
+	if _, _, _, err := bc.Set("ttl", "t", SetOptions{ExpireAt: expireAt}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	want["ttl"] = "t"
+	if err := bc.Put("gone", "x"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := bc.Delete("gone"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := bc.Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+
+	got := make(map[string]string)
+	err := ReadDump(bytes.NewReader(buf.Bytes()), func(key, value string, exp int64) error {
+		got[key] = value
+		if key == "ttl" && exp != expireAt.UnixNano() {
+			t.Errorf("ttl expires at %d, want %d", exp, expireAt.UnixNano())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadDump failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Every truncation and any flipped byte must be detected
+	data := buf.Bytes()
+	noop := func(string, string, int64) error { return nil }
+	for n := 0; n < len(data); n++ {
+		if err := ReadDump(bytes.NewReader(data[:n]), noop); !errors.Is(err, ErrDumpCorrupt) {
+			t.Fatalf("dump truncated to %d bytes: got %v", n, err)
+		}
+	}
+	corrupt := bytes.Clone(data)
+	corrupt[len(corrupt)/2] ^= 0xFF
+	if err := ReadDump(bytes.NewReader(corrupt), noop); !errors.Is(err, ErrDumpCorrupt) {
+		t.Fatalf("corrupt dump: got %v", err)
+	}
+}
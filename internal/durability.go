@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// SyncPolicy decides when writes are fsynced, trading write throughput for
+// how much a power loss or kernel crash can take with it. A crash of the
+// process alone loses nothing under any policy once a Put has returned.
+type SyncPolicy uint8
+
+const (
+	// SyncInterval, the default, fsyncs from the background sync every
+	// Options.SyncInterval, and from the write path once SyncEveryBytes or
+	// SyncEveryWrites is reached. A crash loses at most the writes since.
+	SyncInterval SyncPolicy = iota
+	// SyncAlways fsyncs every Put and Delete before it returns, so nothing
+	// acknowledged is ever lost, but each write waits for the disk.
+	SyncAlways
+	// SyncNever leaves writing back to the OS: the background sync only
+	// hands buffered entries over, and SyncEveryBytes and SyncEveryWrites
+	// are ignored. Writes are fastest, but a crash can lose whatever the OS
+	// had not written back yet. Sync, Roll and Close still fsync.
+	SyncNever
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncInterval:
+		return "interval"
+	case SyncAlways:
+		return "always"
+	case SyncNever:
+		return "never"
+	default:
+		return fmt.Sprintf("sync(%d)", uint8(p))
+	}
+}
+
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	for _, p := range []SyncPolicy{SyncInterval, SyncAlways, SyncNever} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sync policy %q", name)
+}
+
+// syncIfDue fsyncs once the log written since the last sync reaches
+// Options.SyncEveryBytes or Options.SyncEveryWrites. Any sync, including the
+// background one every Options.SyncInterval, resets both counts, so
+// whichever comes first bounds what a crash can lose. Callers hold bc.Mu.
+func (bc *BitCask) syncIfDue() error {
+	if bc.opts.SyncPolicy == SyncNever {
+		return nil
+	}
+	bytesDue := bc.opts.SyncEveryBytes > 0 && bc.unsynced >= bc.opts.SyncEveryBytes
+	writesDue := bc.opts.SyncEveryWrites > 0 && bc.unsyncedWrites >= bc.opts.SyncEveryWrites
+	if !bytesDue && !writesDue {
+		return nil
+	}
+	return bc.syncWrites()
+}
+
+// syncIfAlways fsyncs the Put or Delete just appended under SyncAlways.
+// Callers hold bc.Mu for writing.
+func (bc *BitCask) syncIfAlways() error {
+	if bc.opts.SyncPolicy != SyncAlways {
+		return nil
+	}
+	return bc.syncWrites()
+}
+
+// syncWrites fsyncs from the write path. Callers hold bc.Mu for writing.
+func (bc *BitCask) syncWrites() error {
+	if err := bc.fsync(); err != nil {
+		bc.recordWriteResult(err)
+		return fmt.Errorf("failed to sync: %w", err)
+	}
+	return nil
+}
+
+// scheduleIdleFlush restarts the Options.IdleFlush countdown after an entry
+// was left in a write buffer, so the buffer is flushed once writes pause.
+// Callers hold bc.Mu for writing.
+func (bc *BitCask) scheduleIdleFlush() {
+	if bc.opts.IdleFlush <= 0 {
+		return
+	}
+	if bc.idleFlush == nil {
+		bc.idleFlush = time.AfterFunc(bc.opts.IdleFlush, bc.flushIdle)
+		return
+	}
+	bc.idleFlush.Reset(bc.opts.IdleFlush)
+}
+
+func (bc *BitCask) flushIdle() {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	// The timer may have fired just as Close stopped it
+	if bc.closed.Load() {
+		return
+	}
+	bc.recordWriteResult(bc.flush())
+}
@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSyncEveryWrites(t *testing.T) {
+	bc, err := Open(t.TempDir(), WithSyncEvery(0, 3))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	for i := 1; i <= 7; i++ {
+		if err := bc.Put(fmt.Sprintf("key_%d", i), "value"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if got, want := bc.Stats().UnsyncedBytes == 0, i%3 == 0; got != want {
+			t.Fatalf("after write %d: synced=%v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestSyncEveryBytes(t *testing.T) {
+	size := NewLogEntry("key_1", "value", false).Size()
+	bc, err := Open(t.TempDir(), WithSyncEvery(2*size, 0))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	if err := bc.Put("key_1", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got := bc.Stats().UnsyncedBytes; got != size {
+		t.Fatalf("got %d unsynced bytes, want %d", got, size)
+	}
+	if _, err := bc.Delete("key_1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := bc.Put("key_2", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got := bc.Stats().UnsyncedBytes; got != 0 {
+		t.Fatalf("got %d unsynced bytes after crossing the threshold, want 0", got)
+	}
+}
+
+func TestIdleFlush(t *testing.T) {
+	const idle = 20 * time.Millisecond
+	bc, err := Open(t.TempDir(), WithIdleFlush(idle))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	bc.Mu.RLock()
+	path := bc.Files[bc.CurrentFileId].path
+	bc.Mu.RUnlock()
+	onDisk := func() int64 {
+		t.Helper()
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		return fi.Size()
+	}
+	before := onDisk()
+
+	// Tombstones stay buffered until something flushes them, and the
+	// background sync is a second away
+	start := time.Now()
+	if _, err := bc.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if onDisk() != before {
+		t.Fatalf("tombstone flushed right away")
+	}
+	for onDisk() == before {
+		if time.Since(start) > defaultSyncInterval/2 {
+			t.Fatalf("tombstone not flushed after %v", time.Since(start))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < idle {
+		t.Fatalf("flushed after %v, before the idle period of %v", elapsed, idle)
+	}
+}
+
+func TestSyncIntervalAndWriteBufferSize(t *testing.T) {
+	if _, err := Open(t.TempDir(), WithSyncInterval(0)); err == nil {
+		t.Fatalf("expected a zero sync interval to be rejected")
+	}
+
+	bc, err := Open(t.TempDir(), WithSyncInterval(20*time.Millisecond), WithWriteBufferSize(4096))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	bc.Mu.RLock()
+	path := bc.Files[bc.CurrentFileId].path
+	size := bc.shards[0].writer.Size()
+	bc.Mu.RUnlock()
+	if size != 4096 {
+		t.Fatalf("write buffer holds %d bytes, want 4096", size)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	before := fi.Size()
+
+	// The tombstone stays buffered until the next background sync
+	start := time.Now()
+	if _, err := bc.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	for {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if fi.Size() != before {
+			break
+		}
+		if time.Since(start) > defaultSyncInterval/2 {
+			t.Fatalf("tombstone not synced after %v", time.Since(start))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncPolicy(t *testing.T) {
+	if _, err := Open(t.TempDir(), WithSyncPolicy(SyncNever), WithMaxUnsyncedBytes(1<<20)); err == nil {
+		t.Fatalf("expected backpressure without syncs to be rejected")
+	}
+
+	for _, policy := range []SyncPolicy{SyncInterval, SyncAlways, SyncNever} {
+		t.Run(policy.String(), func(t *testing.T) {
+			bc, err := Open(t.TempDir(), WithSyncPolicy(policy), WithSyncEvery(0, 1000),
+				WithSyncInterval(10*time.Millisecond))
+			if err != nil {
+				t.Fatalf("failed to open: %v", err)
+			}
+			defer bc.Close()
+
+			if err := bc.Put("key", "value"); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			if _, err := bc.Delete("key"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			bc.Mu.RLock()
+			unsynced := bc.unsyncedWrites
+			bc.Mu.RUnlock()
+			if policy == SyncAlways && unsynced > 0 {
+				t.Fatalf("%d writes left unsynced", unsynced)
+			}
+
+			// The background sync always empties the write buffer, but
+			// only syncs under SyncInterval
+			time.Sleep(50 * time.Millisecond)
+			bc.Mu.RLock()
+			buffered := bc.shards[0].writer.Buffered()
+			unsynced = bc.unsyncedWrites
+			bc.Mu.RUnlock()
+			if buffered != 0 {
+				t.Fatalf("%d bytes still buffered after the background sync", buffered)
+			}
+			if (unsynced > 0) != (policy == SyncNever) {
+				t.Fatalf("%d writes left unsynced after the background sync", unsynced)
+			}
+		})
+	}
+}
+
+// BenchmarkPutSyncPolicy compares the write throughput of each SyncPolicy,
+// for Puts and for Puts followed by a Delete.
+func BenchmarkPutSyncPolicy(b *testing.B) {
+	for _, policy := range []SyncPolicy{SyncInterval, SyncAlways, SyncNever} {
+		for _, deletes := range []bool{false, true} {
+			name := policy.String() + "/Put"
+			if deletes {
+				name += "Delete"
+			}
+			b.Run(name, func(b *testing.B) {
+				bc, err := Open(b.TempDir(), WithSyncPolicy(policy))
+				if err != nil {
+					b.Fatalf("failed to open: %v", err)
+				}
+				defer bc.Close()
+
+				value := string(make([]byte, 1024))
+				b.SetBytes(1024)
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					key := fmt.Sprintf("key_%d", i)
+					if err := bc.Put(key, value); err != nil {
+						b.Fatalf("Put failed: %v", err)
+					}
+					if deletes {
+						if _, err := bc.Delete(key); err != nil {
+							b.Fatalf("Delete failed: %v", err)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkPutSyncEvery shows what each bound on unsynced data costs in
+// write throughput, against the background sync alone.
+func BenchmarkPutSyncEvery(b *testing.B) {
+	for _, tc := range []struct {
+		name   string
+		bytes  int64
+		writes int64
+	}{
+		{"IntervalOnly", 0, 0},
+		{"Writes1", 0, 1},
+		{"Writes100", 0, 100},
+		{"Bytes1MiB", 1 << 20, 0},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			bc, err := Open(b.TempDir(), WithSyncEvery(tc.bytes, tc.writes))
+			if err != nil {
+				b.Fatalf("failed to open: %v", err)
+			}
+			defer bc.Close()
+
+			value := string(make([]byte, 1024))
+			b.SetBytes(1024)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := bc.Put(fmt.Sprintf("key_%d", i), value); err != nil {
+					b.Fatalf("Put failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"errors"
+	"math"
+)
+
+// The errors below describe what went wrong in terms callers can act on;
+// test for them with errors.Is, as they are usually returned wrapped with
+// the key or file involved. Errors specific to one feature are declared
+// next to it: ErrBackpressure, ErrDegraded (an ErrReadOnly), ErrCorruptedEntry,
+// ErrVersionMismatch, ErrNotFloat, ErrNotInteger, ErrDumpCorrupt, ErrLazyIndex
+// and ErrCrossShardBatch.
+var (
+	// ErrKeyNotFound is returned for a key that is absent, deleted or
+	// expired.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrFileNotFound is returned when a data file that was asked for, or
+	// that an index entry points at, is not part of the database.
+	ErrFileNotFound = errors.New("data file not found")
+	// ErrClosed is returned by reads and writes after Close.
+	ErrClosed = errors.New("database is closed")
+	// ErrReadOnly is returned by writes while the database refuses them.
+	ErrReadOnly = errors.New("database is read-only")
+	// ErrValueTooLarge is returned by writes of a value larger than an
+	// entry can record.
+	ErrValueTooLarge = errors.New("value too large")
+)
+
+// maxValueSize is the largest value an entry can hold, its size being
+// stored in 32 bits.
+var maxValueSize int64 = math.MaxUint32
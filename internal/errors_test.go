@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrorsIs(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := bc.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := bc.Get("key"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a deleted key: got %v, want ErrKeyNotFound", err)
+	}
+	// Wrapped errors still name what failed
+	if _, err := bc.MergeFile(1000); !errors.Is(err, ErrFileNotFound) || !strings.Contains(err.Error(), "1000") {
+		t.Fatalf("MergeFile of a missing file: got %v, want ErrFileNotFound for file 1000", err)
+	}
+
+	defer func(max int64) { maxValueSize = max }(maxValueSize)
+	maxValueSize = 4
+	if err := bc.Put("key", "12345"); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Put of a large value: got %v, want ErrValueTooLarge", err)
+	}
+	if err := bc.Put("key", "1234"); err != nil {
+		t.Fatalf("Put at the limit failed: %v", err)
+	}
+
+	bc.Mu.Lock()
+	bc.degraded = true
+	bc.Mu.Unlock()
+	err := bc.Put("key", "value")
+	if !errors.Is(err, ErrReadOnly) || !errors.Is(err, ErrDegraded) {
+		t.Fatalf("Put while degraded: got %v, want ErrDegraded and ErrReadOnly", err)
+	}
+	bc.ResetDegraded()
+
+	if err := bc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := bc.Get("key"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get after Close: got %v, want ErrClosed", err)
+	}
+	if err := bc.Put("key", "value"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Put after Close: got %v, want ErrClosed", err)
+	}
+	if err := bc.Ping(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Ping after Close: got %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// PutWithTTL is Put for a key that expires after ttl. Once it has expired,
+// reads treat the key as missing and it is no longer indexed on the next
+// Open. Like Put, a later write of the key without a TTL clears the expiry.
+func (bc *BitCask) PutWithTTL(key string, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("invalid ttl %v for key %q", ttl, key)
+	}
+
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	return bc.putExpiring(key, value, time.Now().Add(ttl).UnixNano())
+}
+
+// TTL returns how long key has left to live, or -1 if it never expires.
+// Missing and expired keys return ErrKeyNotFound.
+func (bc *BitCask) TTL(key string) (time.Duration, error) {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	now := time.Now()
+	vp, ok := bc.lookup(key)
+	if !ok || vp.expired(now) {
+		return 0, ErrKeyNotFound
+	}
+	if vp.ExpireAt == 0 {
+		return -1, nil
+	}
+	return time.Duration(vp.ExpireAt - now.UnixNano()), nil
+}
+
+// Persist removes the expiry of key by writing its value again without one.
+// A key that never expires is left untouched. Missing and expired keys
+// return ErrKeyNotFound.
+func (bc *BitCask) Persist(key string) error {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	value, vp, ok, err := bc.getLive(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if vp.ExpireAt == 0 {
+		return nil
+	}
+	return bc.putExpiring(key, value, 0)
+}
+
+// expired reports whether the key behind vp has an expiry at or before now.
+// Expired keys stay in KeyDir until they are overwritten or deleted, but
+// reads treat them as missing.
+func (vp ValuePointer) expired(now time.Time) bool {
+	return vp.ExpireAt != 0 && vp.ExpireAt <= now.UnixNano()
+}
+
+// expireOnRead deletes key if it is still in KeyDir with an expired value,
+// for Get under Options.ExpireOnRead. The check is repeated under the write
+// lock, so when several readers hit the same expired key only the first one
+// writes a tombstone. Failing to write it is not an error for the read.
+func (bc *BitCask) expireOnRead(key string) {
+	bc.Mu.RLock()
+	vp, ok := bc.lookup(key)
+	bc.Mu.RUnlock()
+	if !ok || !vp.expired(time.Now()) {
+		return
+	}
+
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if vp, ok := bc.lookup(key); !ok || !vp.expired(time.Now()) {
+		return
+	}
+	if err := bc.delete(key); err != nil {
+		log.Printf("Failed to delete expired key %q: %v", key, err)
+	}
+}
+
+// ExpiringBefore returns the keys with an expiry before t, including keys
+// that already expired but were not cleaned up yet. It only scans the
+// in-memory index, so it is cheap enough for a periodic refresh job. Under
+// a lazy index it returns ErrLazyIndex.
+func (bc *BitCask) ExpiringBefore(t time.Time) ([]string, error) {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	if err := bc.checkFullIndex(); err != nil {
+		return nil, err
+	}
+
+	deadline := t.UnixNano()
+	var keys []string
+	for key, vp := range bc.KeyDir {
+		if vp.ExpireAt != 0 && vp.ExpireAt < deadline {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpiringBefore(t *testing.T) {
+	bc := openTestDB(t)
+	now := time.Now()
+
+	bc.Mu.Lock()
+	bc.putExpiring("soon", "v", now.Add(time.Minute).UnixNano())
+	bc.putExpiring("later", "v", now.Add(time.Hour).UnixNano())
+	bc.putExpiring("past", "v", now.Add(-time.Second).UnixNano())
+	bc.put("forever", "v")
+	bc.Mu.Unlock()
+
+	keys, err := bc.ExpiringBefore(now.Add(10 * time.Minute))
+	if err != nil {
+		t.Fatalf("ExpiringBefore failed: %v", err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "past" || keys[1] != "soon" {
+		t.Fatalf("ExpiringBefore = %v, want [past soon]", keys)
+	}
+
+	if _, err := bc.Get("past"); err == nil {
+		t.Fatalf("expected an expired key to read as missing")
+	}
+	if v, err := bc.Get("soon"); err != nil || v != "v" {
+		t.Fatalf("Get(soon) = %q, %v", v, err)
+	}
+}
+
+func TestExpireOnRead(t *testing.T) {
+	for _, expireOnRead := range []bool{false, true} {
+		bc, err := Open(t.TempDir(), WithExpireOnRead(expireOnRead))
+		if err != nil {
+			t.Fatalf("failed to open: %v", err)
+		}
+
+		bc.Mu.Lock()
+		bc.putExpiring("past", "v", time.Now().Add(-time.Second).UnixNano())
+		bc.Mu.Unlock()
+		written := bc.Stats().EntriesWritten
+
+		// Concurrent reads of the same expired key write one tombstone
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := bc.Get("past"); !errors.Is(err, ErrKeyNotFound) {
+					t.Errorf("Get(past): got %v, want ErrKeyNotFound", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		_, indexed := bc.KeyDir["past"]
+		tombstones := bc.Stats().EntriesWritten - written
+		if expireOnRead && (indexed || tombstones != 1) {
+			t.Fatalf("delete-on-read: key indexed %v, %d tombstones, want gone and 1", indexed, tombstones)
+		}
+		if !expireOnRead && (!indexed || tombstones != 0) {
+			t.Fatalf("passive: key indexed %v, %d tombstones, want kept and 0", indexed, tombstones)
+		}
+		bc.Close()
+	}
+}
+
+func TestPutWithTTL(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	if err := bc.PutWithTTL("k", "v", 0); err == nil {
+		t.Fatalf("expected a zero ttl to be rejected")
+	}
+	if err := bc.Put("session", "old"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := bc.PutWithTTL("session", "new", 50*time.Millisecond); err != nil {
+		t.Fatalf("PutWithTTL failed: %v", err)
+	}
+	if err := bc.PutWithTTL("kept", "v", time.Hour); err != nil {
+		t.Fatalf("PutWithTTL failed: %v", err)
+	}
+	if v, err := bc.Get("session"); err != nil || v != "new" {
+		t.Fatalf("Get before expiry = %q, %v", v, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := bc.Get("session"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get after expiry: got %v, want ErrKeyNotFound", err)
+	}
+	bc.Close()
+
+	// The expired entry is not indexed on load, and doesn't bring back the
+	// value it replaced
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if _, ok := bc.KeyDir["session"]; ok {
+		t.Fatalf("expired key was indexed on load")
+	}
+	if _, err := bc.Get("session"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get after reopen: got %v, want ErrKeyNotFound", err)
+	}
+	if v, err := bc.Get("kept"); err != nil || v != "v" {
+		t.Fatalf("Get(kept) = %q, %v", v, err)
+	}
+}
+
+func TestTTLAndPersist(t *testing.T) {
+	bc := openTestDB(t)
+
+	if _, err := bc.TTL("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("TTL of a missing key: got %v, want ErrKeyNotFound", err)
+	}
+	bc.Put("forever", "v")
+	if ttl, err := bc.TTL("forever"); err != nil || ttl != -1 {
+		t.Fatalf("TTL of a key without expiry = %v, %v", ttl, err)
+	}
+
+	bc.Mu.Lock()
+	bc.putExpiring("past", "v", time.Now().Add(-time.Second).UnixNano())
+	bc.Mu.Unlock()
+	if _, err := bc.TTL("past"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("TTL of an expired key: got %v, want ErrKeyNotFound", err)
+	}
+	if err := bc.Persist("past"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Persist of an expired key: got %v, want ErrKeyNotFound", err)
+	}
+
+	if err := bc.PutWithTTL("session", "v", time.Hour); err != nil {
+		t.Fatalf("PutWithTTL failed: %v", err)
+	}
+	if ttl, err := bc.TTL("session"); err != nil || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("TTL = %v, %v, want about an hour", ttl, err)
+	}
+	if err := bc.Persist("session"); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	if ttl, err := bc.TTL("session"); err != nil || ttl != -1 {
+		t.Fatalf("TTL after Persist = %v, %v", ttl, err)
+	}
+	if v, err := bc.Get("session"); err != nil || v != "v" {
+		t.Fatalf("Get after Persist = %q, %v", v, err)
+	}
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ExportAOF writes the live keyspace to w as RESP-encoded commands that a
+// real Redis can replay with `redis-cli --pipe`: one SET per key, followed by
+// a PEXPIREAT for keys with an expiry. Values are written as length-prefixed
+// bulk strings, so binary values survive unchanged.
+//
+// Keys are read one at a time, so writes that happen during the export may or
+// may not be included. Under a lazy index it returns ErrLazyIndex rather than
+// export only the keys in KeyDir.
+func (bc *BitCask) ExportAOF(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	var exportErr error
+	err := bc.ForEachKey(func(key string, _ ValuePointer) {
+		if exportErr != nil {
+			return
+		}
+
+		bc.Mu.RLock()
+		value, vp, err := bc.get(key)
+		bc.Mu.RUnlock()
+		if err != nil {
+			// Deleted or expired since the walk started
+			return
+		}
+
+		if err := writeRESPCommand(bw, "SET", key, value); err != nil {
+			exportErr = err
+			return
+		}
+		if vp.ExpireAt != 0 {
+			ms := strconv.FormatInt(time.Unix(0, vp.ExpireAt).UnixMilli(), 10)
+			if err := writeRESPCommand(bw, "PEXPIREAT", key, ms); err != nil {
+				exportErr = err
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if exportErr != nil {
+		return exportErr
+	}
+
+	return bw.Flush()
+}
+
+// writeRESPCommand encodes args as a RESP array of bulk strings.
+func writeRESPCommand(w *bufio.Writer, args ...string) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
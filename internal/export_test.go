@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readRESPCommand parses one RESP array of bulk strings.
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "*"), "\r\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "$"), "\r\n"))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestExportAOFRoundTrip(t *testing.T) {
+	bc := openTestDB(t)
+
+	want := map[string]string{
+		"plain":  "value",
+		"spaces": "hello world",
+		"binary": "line\r\nbreak\x00nul",
+		"empty":  "",
+	}
+	for k, v := range want {
+		if err := bc.Put(k, v); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	bc.Mu.Lock()
+	bc.putExpiring("ttl", "soon", expireAt.UnixNano())
+	bc.Mu.Unlock()
+	bc.Put("deleted", "x")
+	bc.Delete("deleted")
+
+	var out bytes.Buffer
+	if err := bc.ExportAOF(&out); err != nil {
+		t.Fatalf("ExportAOF failed: %v", err)
+	}
+
+	// Replay against a minimal in-memory executor
+	got := make(map[string]string)
+	expiries := make(map[string]int64)
+	r := bufio.NewReader(&out)
+	for {
+		args, err := readRESPCommand(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("malformed export: %v", err)
+		}
+		switch args[0] {
+		case "SET":
+			got[args[1]] = args[2]
+		case "PEXPIREAT":
+			ms, _ := strconv.ParseInt(args[2], 10, 64)
+			expiries[args[1]] = ms
+		default:
+			t.Fatalf("unexpected command %q", args[0])
+		}
+	}
+
+	want["ttl"] = "soon"
+	if len(got) != len(want) {
+		t.Fatalf("replayed %d keys, want %d: %q", len(got), len(want), got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("key %q = %q, want %q", k, got[k], v)
+		}
+	}
+	if len(expiries) != 1 || expiries["ttl"] != expireAt.UnixMilli() {
+		t.Fatalf("expiries = %v, want ttl at %d", expiries, expireAt.UnixMilli())
+	}
+}
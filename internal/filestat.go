@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"sort"
+	"time"
+)
+
+// fileUsage tracks how much of a data file is still referenced by KeyDir.
+// Everything else in the file is dead: overwritten values and tombstones
+// that a merge would reclaim.
+type fileUsage struct {
+	keys  int
+	bytes int64
+}
+
+type FileStat struct {
+	Id        int
+	Size      int64
+	LiveKeys  int
+	LiveBytes int64
+	DeadBytes int64
+}
+
+// indexKey points key at vp in KeyDir and moves its live bytes from the file
+// holding the previous version (if any) to the new one. Callers hold bc.Mu.
+func (bc *BitCask) indexKey(key string, vp ValuePointer) {
+	if old, ok := bc.KeyDir[key]; ok {
+		bc.releaseUsage(old)
+	} else {
+		bc.keyBytes += int64(len(key))
+	}
+	bc.KeyDir[key] = vp
+	if id, ok := bc.lazyTombstones[key]; ok && id <= vp.FileId {
+		delete(bc.lazyTombstones, key)
+	}
+
+	u, ok := bc.usage[vp.FileId]
+	if !ok {
+		u = &fileUsage{}
+		bc.usage[vp.FileId] = u
+	}
+	u.keys++
+	u.bytes += vp.Size
+}
+
+// unindexKey removes key from KeyDir. Callers hold bc.Mu.
+func (bc *BitCask) unindexKey(key string) {
+	if old, ok := bc.KeyDir[key]; ok {
+		bc.releaseUsage(old)
+		bc.keyBytes -= int64(len(key))
+		delete(bc.KeyDir, key)
+	}
+}
+
+func (bc *BitCask) releaseUsage(vp ValuePointer) {
+	if u, ok := bc.usage[vp.FileId]; ok {
+		u.keys--
+		u.bytes -= vp.Size
+	}
+}
+
+// FileStats returns the size and live/dead byte split of every data file,
+// ordered by file id.
+func (bc *BitCask) FileStats() []FileStat {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	stats := make([]FileStat, 0, len(bc.Files))
+	for _, id := range bc.sortedFileIds() {
+		stats = append(stats, bc.fileStat(id))
+	}
+	return stats
+}
+
+// fileStat computes the FileStat of one data file. Callers hold bc.Mu.
+func (bc *BitCask) fileStat(id int) FileStat {
+	size, _ := bc.fileSize(id)
+
+	st := FileStat{Id: id, Size: size}
+	if u, ok := bc.usage[id]; ok {
+		st.LiveKeys = u.keys
+		st.LiveBytes = u.bytes
+	}
+	st.DeadBytes = st.Size - bc.Files[id].header.dataStart() - st.LiveBytes
+	return st
+}
+
+// FileInfo describes one data file for administrative tools.
+type FileInfo struct {
+	FileStat
+	Path   string
+	Active bool // an active file is still appended to by its shard
+	// CreatedAt comes from the file header; it is zero for legacy files
+	// written before the header existed.
+	CreatedAt time.Time
+}
+
+// FileInfos returns every data file of the database, ordered by file id.
+// It only holds the read lock while copying the file set, so writers are
+// stalled no longer than by a Get.
+func (bc *BitCask) FileInfos() []FileInfo {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	infos := make([]FileInfo, 0, len(bc.Files))
+	for _, id := range bc.sortedFileIds() {
+		df := bc.Files[id]
+		info := FileInfo{
+			FileStat: bc.fileStat(id),
+			Path:     df.path,
+			Active:   bc.activeShard(id) != nil,
+		}
+		if df.header.Version > 0 {
+			info.CreatedAt = time.Unix(0, df.header.CreatedAt)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// KeysInFile returns the live keys whose current value is stored in the data
+// file fileId. It walks the whole KeyDir under the read lock, so it is O(n)
+// in the number of keys and meant for maintenance and debugging. Under a
+// lazy index it returns ErrLazyIndex.
+func (bc *BitCask) KeysInFile(fileId int) ([]string, error) {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	if err := bc.checkFullIndex(); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key, vp := range bc.KeyDir {
+		if vp.FileId == fileId {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKeysInFile(t *testing.T) {
+	bc := openTestDB(t)
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := bc.Put(key, "old"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	first := bc.CurrentFileId
+
+	bc.Mu.Lock()
+	if err := bc.RollNewFile(); err != nil {
+		t.Fatalf("RollNewFile failed: %v", err)
+	}
+	bc.Mu.Unlock()
+
+	if err := bc.Put("b", "new"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := bc.Delete("c"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	if got, _ := bc.KeysInFile(first); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("file %d: got %v, want [a]", first, got)
+	}
+	if got, _ := bc.KeysInFile(bc.CurrentFileId); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("file %d: got %v, want [b]", bc.CurrentFileId, got)
+	}
+	if got, _ := bc.KeysInFile(999); len(got) != 0 {
+		t.Fatalf("unknown file: got %v, want none", got)
+	}
+}
+
+func TestFileInfos(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("a", "1"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	sealed := bc.CurrentFileId
+
+	bc.Mu.Lock()
+	if err := bc.RollNewFile(); err != nil {
+		t.Fatalf("RollNewFile failed: %v", err)
+	}
+	bc.Mu.Unlock()
+
+	infos := bc.FileInfos()
+	if len(infos) != 2 {
+		t.Fatalf("got %d files, want 2", len(infos))
+	}
+	if infos[0].Id != sealed || infos[0].Active || infos[0].LiveKeys != 1 {
+		t.Fatalf("sealed file: got %+v", infos[0])
+	}
+	if infos[1].Id != bc.CurrentFileId || !infos[1].Active || infos[1].LiveKeys != 0 {
+		t.Fatalf("active file: got %+v", infos[1])
+	}
+	for _, fi := range infos {
+		if filepath.Dir(fi.Path) != bc.dir || fi.CreatedAt.IsZero() {
+			t.Fatalf("file %d: got path %q, created at %v", fi.Id, fi.Path, fi.CreatedAt)
+		}
+	}
+}
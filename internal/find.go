@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// FindByValue returns the keys whose current value satisfies match, sorted.
+// It is a slow scan meant for ad-hoc queries and admin tooling: every live
+// value is read from disk, one at a time, so memory stays bounded by the
+// largest value but the time grows with the size of the whole keyspace.
+// Like ForEachKey it is not a point-in-time view. It stops early and
+// returns ctx.Err() when ctx is cancelled.
+//
+// match must not keep the slice it is given.
+func (bc *BitCask) FindByValue(ctx context.Context, match func(value []byte) bool) ([]string, error) {
+	var keys []string
+	var findErr error
+	err := bc.ForEachKey(func(key string, _ ValuePointer) {
+		if findErr != nil {
+			return
+		}
+		if findErr = ctx.Err(); findErr != nil {
+			return
+		}
+
+		value, err := bc.loadBytes(key)
+		if errors.Is(err, ErrKeyNotFound) {
+			// Deleted or expired since the walk started
+			return
+		}
+		if err != nil {
+			findErr = err
+			return
+		}
+		if match(value) {
+			keys = append(keys, key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if findErr != nil {
+		return nil, findErr
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// loadBytes is load returning the value as read, without copying it.
+func (bc *BitCask) loadBytes(key string) ([]byte, error) {
+	vp, df, err := bc.pinFlushed(key)
+	if err != nil {
+		return nil, err
+	}
+	defer df.release()
+
+	return bc.readValueBytes(df, vp)
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFindByValue(t *testing.T) {
+	bc := openTestDB(t)
+
+	for i := 0; i < 10; i++ {
+		if err := bc.Put(fmt.Sprintf("session-%d", i), fmt.Sprintf(`{"user":"u%d"}`, i%3)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	bc.Delete("session-3")
+	bc.Mu.Lock()
+	bc.putExpiring("session-6", `{"user":"u0"}`, time.Now().Add(-time.Second).UnixNano())
+	bc.Mu.Unlock()
+
+	keys, err := bc.FindByValue(context.Background(), func(value []byte) bool {
+		return bytes.Contains(value, []byte(`"u0"`))
+	})
+	if err != nil {
+		t.Fatalf("FindByValue failed: %v", err)
+	}
+	if fmt.Sprint(keys) != "[session-0 session-9]" {
+		t.Fatalf("FindByValue = %v, want [session-0 session-9]", keys)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bc.FindByValue(ctx, func([]byte) bool { return true }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("FindByValue with a cancelled context: got %v, want context.Canceled", err)
+	}
+}
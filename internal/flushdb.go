@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// FlushDB deletes every key and the data files holding them. Every shard is
+// rolled onto a fresh file first, then the manifest records that files
+// below the first new id are dropped, and only then are they deleted. The
+// manifest is replaced atomically, so a crash leaves either the whole
+// database or none of it: if the files are not all gone yet, the next Open
+// finishes deleting them instead of loading them. File ids keep increasing
+// across a flush for the same reason.
+func (bc *BitCask) FlushDB() error {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+
+	barrier := bc.CurrentFileId + 1
+	if err := bc.RollNewFile(); err != nil {
+		bc.recordWriteResult(err)
+		return fmt.Errorf("failed to roll new file: %w", err)
+	}
+
+	m, err := loadManifest(bc.dir)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+	m.FlushedBelow = barrier
+	m.VersionFloor = 0
+	if err := m.save(bc.dir); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	bc.flushedBelow = barrier
+
+	bc.KeyDir = make(map[string]ValuePointer)
+	bc.keyBytes = 0
+	bc.lazy, bc.lazyTombstones = nil, make(map[string]int)
+	bc.versionFloor, bc.savedVersionFloor = 0, 0
+	bc.freqMu.Lock()
+	bc.freq = make(map[string]*lfuCounter)
+	bc.freqMu.Unlock()
+
+	// The flush has happened once the manifest is saved, so a file that
+	// fails to go away is only logged; the next Open retries it
+	var removed int
+	for id := range bc.Files {
+		if id >= barrier {
+			continue
+		}
+		if err := bc.removeFile(id); err != nil {
+			log.Printf("Failed to remove data file %d after FLUSHDB: %v", id, err)
+			continue
+		}
+		removed++
+	}
+	log.Printf("FLUSHDB removed %d data files", removed)
+	return nil
+}
+
+// removeDroppedFile deletes data file id of dir, found at path, and its hint
+// file, for a file that FlushDB dropped but didn't delete.
+func removeDroppedFile(dir string, id int, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove dropped file %s: %w", path, err)
+	}
+	if err := os.Remove(hintPath(dir, id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove hint of dropped file %d: %w", id, err)
+	}
+	return syncDir(dir)
+}
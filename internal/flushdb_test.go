@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFlushDB(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		bc.Put(fmt.Sprintf("key-%d", i), "old")
+		if i%3 == 0 {
+			bc.Roll()
+		}
+	}
+	if err := bc.FlushDB(); err != nil {
+		t.Fatalf("FlushDB failed: %v", err)
+	}
+
+	if keys, _ := bc.Scan(""); len(keys) != 0 {
+		t.Fatalf("keys left after FlushDB: %v", keys)
+	}
+	if _, err := bc.Get("key-1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get after FlushDB: got %v, want ErrKeyNotFound", err)
+	}
+	files, err := listDataFiles(dir, bc.opts.DataFileExtension)
+	if err != nil {
+		t.Fatalf("listDataFiles failed: %v", err)
+	}
+	if len(files) != len(bc.Files) || len(files) != bc.opts.Shards {
+		t.Fatalf("%d data files on disk and %d open after FlushDB, want only the active ones", len(files), len(bc.Files))
+	}
+
+	bc.Put("key-1", "new")
+	bc.Close()
+
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	if keys, _ := bc.Scan(""); len(keys) != 1 {
+		t.Fatalf("keys after reopen = %v, want [key-1]", keys)
+	}
+	if v, err := bc.Get("key-1"); err != nil || v != "new" {
+		t.Fatalf("Get(key-1) = %q, %v", v, err)
+	}
+}
+
+func TestFlushDBInterruptedIsFinishedOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		bc.Put(fmt.Sprintf("key-%d", i), "old")
+		bc.Roll()
+	}
+	barrier := bc.CurrentFileId + 1
+	bc.Close()
+
+	// A FlushDB that crashed after saving the manifest, having deleted
+	// only some of the files
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatalf("loadManifest failed: %v", err)
+	}
+	m.FlushedBelow = barrier
+	if err := m.save(dir); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	files, _ := listDataFiles(dir, DefaultOptions().DataFileExtension)
+	for id, path := range files {
+		if id%2 == 0 {
+			removeDroppedFile(dir, id, path)
+		}
+	}
+
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if keys, _ := bc.Scan(""); len(keys) != 0 {
+		t.Fatalf("keys came back after an interrupted FlushDB: %v", keys)
+	}
+	for id := range bc.Files {
+		if id < barrier {
+			t.Fatalf("dropped file %d was loaded", id)
+		}
+	}
+	files, _ = listDataFiles(dir, bc.opts.DataFileExtension)
+	if len(files) != len(bc.Files) {
+		t.Fatalf("%d data files on disk, want %d", len(files), len(bc.Files))
+	}
+	if err := bc.Put("k", "v"); err != nil {
+		t.Fatalf("Put after reopen failed: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrDegraded is the ErrReadOnly of an engine that turned read-only after
+// repeated write failures, see recordWriteResult.
+var ErrDegraded = fmt.Errorf("engine degraded: %w", ErrReadOnly)
+
+// Ping is a cheap liveness check: it confirms the engine is open, the active
+// file is usable and the background sync goroutine ticked within the last
+// two sync intervals.
+func (bc *BitCask) Ping() error {
+	select {
+	case <-bc.done:
+		return ErrClosed
+	default:
+	}
+
+	lastTick := time.Unix(0, bc.lastSyncTick.Load())
+	if since := time.Since(lastTick); since > 2*bc.opts.SyncInterval {
+		return fmt.Errorf("background sync stalled, last tick %v ago", since.Round(time.Millisecond))
+	}
+
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	for _, s := range bc.shards {
+		if s.file == nil {
+			return errors.New("no active file")
+		}
+		if _, err := s.file.Stat(); err != nil {
+			return fmt.Errorf("active file unusable: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// recordWriteResult feeds the write circuit breaker. After
+// degradeAfterFailures consecutive write/sync failures within degradeWindow
+// the engine turns read-only so a failing disk doesn't get hammered by every
+// client. Callers hold bc.Mu.
+func (bc *BitCask) recordWriteResult(err error) {
+	if err == nil {
+		bc.writeFailures = 0
+		return
+	}
+
+	now := time.Now()
+	if bc.writeFailures == 0 || now.Sub(bc.firstFailureAt) > degradeWindow {
+		bc.writeFailures = 0
+		bc.firstFailureAt = now
+	}
+	bc.writeFailures++
+
+	if bc.writeFailures >= degradeAfterFailures && !bc.degraded {
+		bc.degraded = true
+		log.Printf("BitCask degraded to read-only after %d write failures: %v", bc.writeFailures, err)
+	}
+}
+
+// checkWritable returns ErrDegraded while the breaker is open. Callers hold bc.Mu.
+func (bc *BitCask) checkWritable() error {
+	if bc.closed.Load() {
+		return ErrClosed
+	}
+	if bc.degraded {
+		return ErrDegraded
+	}
+	return nil
+}
+
+// Degraded reports whether the engine is rejecting writes.
+func (bc *BitCask) Degraded() bool {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+	return bc.degraded
+}
+
+// HealthCheck flushes and fsyncs the active file. On success a degraded
+// engine becomes writable again.
+func (bc *BitCask) HealthCheck() error {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if err := bc.fsync(); err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+
+	bc.degraded = false
+	bc.writeFailures = 0
+	return nil
+}
+
+// ResetDegraded manually closes the breaker, e.g. after an operator freed
+// disk space.
+func (bc *BitCask) ResetDegraded() {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	bc.degraded = false
+	bc.writeFailures = 0
+}
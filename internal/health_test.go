@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRepeatedWriteFailuresDegradeEngine(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("a", "1"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// Simulate a dead disk: every flush to the active file now fails
+	bc.shards[0].file.Close()
+
+	for i := 0; i < degradeAfterFailures; i++ {
+		err := bc.Put("a", "2")
+		if err == nil {
+			t.Fatalf("expected Put to fail on a closed file")
+		}
+		if errors.Is(err, ErrDegraded) {
+			t.Fatalf("degraded after only %d failures", i)
+		}
+	}
+
+	if !bc.Degraded() {
+		t.Fatalf("expected engine to be degraded")
+	}
+	if err := bc.Put("a", "3"); !errors.Is(err, ErrDegraded) {
+		t.Fatalf("expected ErrDegraded, got %v", err)
+	}
+	if _, err := bc.Delete("a"); !errors.Is(err, ErrDegraded) {
+		t.Fatalf("expected ErrDegraded on Delete, got %v", err)
+	}
+
+	if err := bc.HealthCheck(); err == nil {
+		t.Fatalf("expected health check to fail on a closed file")
+	}
+	if !bc.Degraded() {
+		t.Fatalf("failed health check must not clear degraded mode")
+	}
+
+	bc.ResetDegraded()
+	if bc.Degraded() {
+		t.Fatalf("expected manual reset to clear degraded mode")
+	}
+}
+
+func TestPingReportsStalledSync(t *testing.T) {
+	stall := make(chan struct{})
+	testHookSyncTick = func() { <-stall }
+	// Cleanups run last-in first-out: unblock the goroutine, Close, then
+	// clear the hook once nothing can read it anymore
+	t.Cleanup(func() { testHookSyncTick = nil })
+
+	bc := openTestDB(t)
+	t.Cleanup(func() { close(stall) })
+
+	if err := bc.Ping(); err != nil {
+		t.Fatalf("expected a fresh engine to be healthy, got %v", err)
+	}
+
+	time.Sleep(2*defaultSyncInterval + 200*time.Millisecond)
+
+	if err := bc.Ping(); err == nil {
+		t.Fatalf("expected Ping to report the stalled sync goroutine")
+	}
+}
@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// A hint file sits next to a sealed data file and lists what KeyDir needs
+// from it, so Open can index the file without scanning every entry:
+//
+//	magic "GCHT" (4) | data file size (8)
+//	records: tombstone (1) | key size (4) | version (8) | expire at (8) | offset (8) | entry size (8) | key
+//	crc32c of everything before it (4)
+//
+// A hint whose data file size no longer matches, or whose checksum fails, is
+// ignored and the data file is scanned instead.
+const hintMagic = "GCHT"
+const hintRecordHeaderSize = 1 + 4 + 8 + 8 + 8 + 8
+
+func hintPath(dir string, fileId int) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.hint", fileId))
+}
+
+// hintRecord is one entry of a hint file.
+type hintRecord struct {
+	Key       string
+	Tombstone bool
+	Version   uint64
+	ExpireAt  int64
+	Offset    int64
+	Size      int64
+	// Timestamp is only known for records scanned from the data file, hint
+	// files don't store it.
+	Timestamp int64
+}
+
+func encodeHint(dataSize int64, records []hintRecord) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(hintMagic)
+	binary.Write(&buf, binary.BigEndian, dataSize)
+
+	rec := make([]byte, hintRecordHeaderSize)
+	for _, r := range records {
+		rec[0] = 0
+		if r.Tombstone {
+			rec[0] = 1
+		}
+		binary.BigEndian.PutUint32(rec[1:5], uint32(len(r.Key)))
+		binary.BigEndian.PutUint64(rec[5:13], r.Version)
+		binary.BigEndian.PutUint64(rec[13:21], uint64(r.ExpireAt))
+		binary.BigEndian.PutUint64(rec[21:29], uint64(r.Offset))
+		binary.BigEndian.PutUint64(rec[29:37], uint64(r.Size))
+		buf.Write(rec)
+		buf.WriteString(r.Key)
+	}
+
+	binary.Write(&buf, binary.BigEndian, crc32.Checksum(buf.Bytes(), castagnoliTable))
+	return buf.Bytes()
+}
+
+var errInvalidHint = errors.New("invalid hint file")
+
+func decodeHint(buf []byte) (int64, []hintRecord, error) {
+	if len(buf) < len(hintMagic)+8+4 || string(buf[:len(hintMagic)]) != hintMagic {
+		return 0, nil, errInvalidHint
+	}
+	body, sum := buf[:len(buf)-4], binary.BigEndian.Uint32(buf[len(buf)-4:])
+	if crc32.Checksum(body, castagnoliTable) != sum {
+		return 0, nil, errInvalidHint
+	}
+
+	dataSize := int64(binary.BigEndian.Uint64(body[4:12]))
+	var records []hintRecord
+	for rest := body[12:]; len(rest) > 0; {
+		if len(rest) < hintRecordHeaderSize {
+			return 0, nil, errInvalidHint
+		}
+		keySize := int(binary.BigEndian.Uint32(rest[1:5]))
+		if len(rest) < hintRecordHeaderSize+keySize {
+			return 0, nil, errInvalidHint
+		}
+		r := hintRecord{
+			Tombstone: rest[0] == 1,
+			Version:   binary.BigEndian.Uint64(rest[5:13]),
+			ExpireAt:  int64(binary.BigEndian.Uint64(rest[13:21])),
+			Offset:    int64(binary.BigEndian.Uint64(rest[21:29])),
+			Size:      int64(binary.BigEndian.Uint64(rest[29:37])),
+			Key:       string(rest[hintRecordHeaderSize : hintRecordHeaderSize+keySize]),
+		}
+		// Reads allocate the size of the entry, so it must lie within
+		// the data file
+		if r.Offset < 0 || r.Size <= 0 || r.Size > dataSize-r.Offset {
+			return 0, nil, errInvalidHint
+		}
+		records = append(records, r)
+		rest = rest[hintRecordHeaderSize+keySize:]
+	}
+	return dataSize, records, nil
+}
+
+// loadHint returns the records of the hint file of fileId if it is intact
+// and still describes a data file of dataSize bytes.
+func loadHint(dir string, fileId int, dataSize int64) ([]hintRecord, bool) {
+	buf, err := os.ReadFile(hintPath(dir, fileId))
+	if err != nil {
+		return nil, false
+	}
+	size, records, err := decodeHint(buf)
+	if err != nil || size != dataSize {
+		return nil, false
+	}
+	return records, true
+}
+
+// hintRecords scans a data file with the header-and-key decoder.
+func hintRecords(file io.ReaderAt, header fileHeader, fileSize int64) ([]hintRecord, error) {
+	records, err := scanRecords(file, header, fileSize)
+	return records.committed, err
+}
+
+// scanRecords is hintRecords that also tells how the file ends. An entry
+// that runs past the end of the file is a torn tail only if it is the last
+// one, see tornTail; otherwise its sizes are corrupt and so is the file.
+func scanRecords(file io.ReaderAt, header fileHeader, fileSize int64) (batchRecords, error) {
+	var records batchRecords
+	for offset := header.dataStart(); ; {
+		entry, size, err := readLogEntryHeaderAndKey(file, header.Version, offset, fileSize)
+		if err == io.EOF {
+			return records, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			if !tornTail(file, header, offset, fileSize) {
+				return records, fmt.Errorf("%w: entry at offset %d runs past the end of the file", ErrCorruptedEntry, offset)
+			}
+			records.torn = true
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+
+		records.add(entry.Header.BatchContinues, hintRecord{
+			Key:       string(entry.Key),
+			Tombstone: entry.IsDeleted(),
+			Version:   entry.Header.Version,
+			ExpireAt:  entry.Header.ExpireAt,
+			Offset:    offset,
+			Size:      size,
+			Timestamp: entry.Header.Timestamp,
+		})
+		offset += size
+	}
+}
+
+// batchRecords collects the records of a data file in order, holding back
+// the entries of a WriteBatch until the entry committing it is added. A
+// batch cut short by a crash is never committed, so none of it is indexed.
+type batchRecords struct {
+	committed []hintRecord
+	pending   []hintRecord
+	// torn is set when the file ends in a partly written entry
+	torn bool
+}
+
+func (b *batchRecords) add(continues bool, r hintRecord) {
+	if continues {
+		b.pending = append(b.pending, r)
+		return
+	}
+	b.committed = append(b.committed, b.pending...)
+	b.committed = append(b.committed, r)
+	b.pending = b.pending[:0]
+}
+
+// abandon drops the entries of the batch being collected.
+func (b *batchRecords) abandon() {
+	b.pending = b.pending[:0]
+}
+
+// clean reports whether the file ended after a complete entry that was not
+// part of an unfinished batch, so more entries can be appended to it.
+// Appending after a torn entry would hide the new entries from the next
+// scan, and after an unfinished batch would complete it.
+func (b *batchRecords) clean() bool {
+	return !b.torn && len(b.pending) == 0
+}
+
+// writeHint atomically replaces the hint file of fileId.
+func writeHint(dir string, fileId int, data []byte) error {
+	path := hintPath(dir, fileId)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RebuildHints regenerates the hint file of every sealed data file from its
+// contents, without rewriting any data. Sealed files never change, so they
+// are scanned without holding bc.Mu and writers are not blocked. Files in a
+// legacy format without versions get no hint and are always scanned.
+func (bc *BitCask) RebuildHints() error {
+	type sealed struct {
+		id int
+		df *dataFile
+	}
+
+	bc.Mu.RLock()
+	var files []sealed
+	for id, df := range bc.Files {
+		if bc.activeShard(id) != nil || df.header.Version < 2 {
+			continue
+		}
+		df.acquire()
+		files = append(files, sealed{id, df})
+	}
+	bc.Mu.RUnlock()
+
+	defer func() {
+		for _, f := range files {
+			f.df.release()
+		}
+	}()
+
+	for _, f := range files {
+		fi, err := f.df.file.Stat()
+		if err != nil {
+			return err
+		}
+		records, err := hintRecords(f.df.file, f.df.header, fi.Size())
+		if err != nil {
+			return fmt.Errorf("failed to scan file %d: %w", f.id, err)
+		}
+		if err := writeHint(bc.dir, f.id, encodeHint(fi.Size(), records)); err != nil {
+			return fmt.Errorf("failed to write hint of file %d: %w", f.id, err)
+		}
+	}
+
+	return syncDir(bc.dir)
+}
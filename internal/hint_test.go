@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestOpenWithHintsMatchesFullScan(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 20; i++ {
+			if err := bc.Put(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d-%d", round, i)); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		if _, err := bc.Delete(fmt.Sprintf("key-%d", round)); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		bc.Mu.Lock()
+		if err := bc.RollNewFile(); err != nil {
+			t.Fatalf("RollNewFile failed: %v", err)
+		}
+		bc.Mu.Unlock()
+	}
+	sealed, active := 1, bc.CurrentFileId
+
+	if err := bc.RebuildHints(); err != nil {
+		t.Fatalf("RebuildHints failed: %v", err)
+	}
+	bc.Close()
+
+	if _, err := os.Stat(hintPath(dir, sealed)); err != nil {
+		t.Fatalf("expected a hint for sealed file %d: %v", sealed, err)
+	}
+	if _, err := os.Stat(hintPath(dir, active)); !os.IsNotExist(err) {
+		t.Fatalf("expected no hint for active file %d, got %v", active, err)
+	}
+
+	keyDir := func() map[string]ValuePointer {
+		t.Helper()
+		bc, err := Open(dir)
+		if err != nil {
+			t.Fatalf("failed to reopen: %v", err)
+		}
+		defer bc.Close()
+		snapshot, err := bc.KeyDirSnapshot()
+		if err != nil {
+			t.Fatalf("KeyDirSnapshot failed: %v", err)
+		}
+		return snapshot
+	}
+
+	withHints := keyDir()
+
+	// A corrupt hint must fall back to scanning its data file
+	if err := os.WriteFile(hintPath(dir, sealed), []byte("garbage"), 0644); err != nil {
+		t.Fatalf("failed to corrupt hint: %v", err)
+	}
+	if got := keyDir(); !reflect.DeepEqual(got, withHints) {
+		t.Fatalf("KeyDir with a corrupt hint differs from the hinted one")
+	}
+
+	for id := sealed; id < active; id++ {
+		os.Remove(hintPath(dir, id))
+	}
+	if got := keyDir(); !reflect.DeepEqual(got, withHints) {
+		t.Fatalf("KeyDir from a full scan differs from the hinted one:\n%v\n%v", got, withHints)
+	}
+}
+
+func TestHintPointingOutsideDataFileIsInvalid(t *testing.T) {
+	const dataSize = 1000
+	for _, r := range []hintRecord{
+		{Key: "k", Offset: 16, Size: 3 << 30},
+		{Key: "k", Offset: dataSize, Size: 50},
+		{Key: "k", Offset: -1, Size: 50},
+		{Key: "k", Offset: 16, Size: 0},
+	} {
+		if _, _, err := decodeHint(encodeHint(dataSize, []hintRecord{r})); err != errInvalidHint {
+			t.Fatalf("record at %d of %d bytes: got %v, want errInvalidHint", r.Offset, r.Size, err)
+		}
+	}
+
+	ok := hintRecord{Key: "k", Offset: 16, Size: dataSize - 16}
+	if _, records, err := decodeHint(encodeHint(dataSize, []hintRecord{ok})); err != nil || len(records) != 1 {
+		t.Fatalf("valid record: got %v, %v", records, err)
+	}
+}
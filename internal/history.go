@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// EntryInfo describes one on-disk entry, live or not.
+type EntryInfo struct {
+	Key       string
+	FileId    int
+	Offset    int64
+	Timestamp int64
+	Version   uint64
+	ExpireAt  int64
+	Tombstone bool
+	Value     string
+}
+
+// scanFile calls fn with the header and key of every entry of a data file in
+// write order, stopping at the end of the file or at a torn tail. Callers
+// hold bc.Mu.
+func (bc *BitCask) scanFile(fileId int, fn func(entry *LogEntry, offset int64, size int64) error) error {
+	df, ok := bc.Files[fileId]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrFileNotFound, fileId)
+	}
+
+	size, err := bc.fileSize(fileId)
+	if err != nil {
+		return err
+	}
+
+	file, header := df.file, df.header
+	for offset := header.dataStart(); ; {
+		entry, n, err := readLogEntryHeaderAndKey(file, header.Version, offset, size)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(entry, offset, n); err != nil {
+			return err
+		}
+		offset += n
+	}
+}
+
+// sortedFileIds returns the ids of all data files, oldest first. Callers
+// hold bc.Mu.
+func (bc *BitCask) sortedFileIds() []int {
+	ids := make([]int, 0, len(bc.Files))
+	for id := range bc.Files {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// entryInfo reads the full entry behind a scanned header. Callers hold bc.Mu.
+func (bc *BitCask) entryInfo(fileId int, offset int64, size int64) (EntryInfo, error) {
+	df := bc.Files[fileId]
+	entry, err := readLogEntry(df.file, df.header.Version, offset, size)
+	if err != nil {
+		return EntryInfo{}, err
+	}
+
+	return EntryInfo{
+		Key:       string(entry.Key),
+		FileId:    fileId,
+		Offset:    offset,
+		Timestamp: entry.Header.Timestamp,
+		Version:   entry.Header.Version,
+		ExpireAt:  entry.Header.ExpireAt,
+		Tombstone: entry.Header.Tombstone,
+		Value:     string(entry.Value),
+	}, nil
+}
+
+// History returns every entry still on disk for key, oldest first,
+// including overwritten values and tombstones that a merge has not
+// reclaimed yet. It scans every data file, so it is O(total entries) and
+// meant for debugging and recovering overwritten values, not for hot paths.
+// Writes are blocked while it runs.
+func (bc *BitCask) History(key string) ([]EntryInfo, error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	// Make buffered entries visible to the scan
+	if err := bc.flush(); err != nil {
+		return nil, err
+	}
+
+	var history []EntryInfo
+	for _, id := range bc.sortedFileIds() {
+		err := bc.scanFile(id, func(entry *LogEntry, offset int64, size int64) error {
+			if string(entry.Key) != key {
+				return nil
+			}
+			info, err := bc.entryInfo(id, offset, size)
+			if err != nil {
+				return err
+			}
+			history = append(history, info)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return history, nil
+}
+
+// Tail returns the last n entries written, most recent first, whether they
+// are still live or not. Like History it is a forensic tool that blocks
+// writes while it runs.
+//
+// Entries have variable length and no back links, so a file can't be read
+// backward. Instead each file is scanned forward, headers and keys only,
+// keeping its last entries in a buffer of at most 2n. Files are visited
+// newest first and, since a shard only appends to its newest file, every
+// entry of a file is older than those of the shard's later files: a shard's
+// older files are skipped once it has contributed n entries. The entries of
+// all shards are then ordered by timestamp, which never goes back.
+func (bc *BitCask) Tail(n int) ([]EntryInfo, error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if err := bc.flush(); err != nil {
+		return nil, err
+	}
+
+	type location struct {
+		fileId       int
+		offset, size int64
+		timestamp    int64
+	}
+	var found []location
+	perShard := make(map[uint8]int)
+
+	ids := bc.sortedFileIds()
+	for i := len(ids) - 1; i >= 0 && n > 0; i-- {
+		id := ids[i]
+		shard := bc.Files[id].header.Shard
+		want := n - perShard[shard]
+		if want <= 0 {
+			continue
+		}
+
+		var last []location
+		err := bc.scanFile(id, func(entry *LogEntry, offset int64, size int64) error {
+			if len(last) == 2*want {
+				last = append(last[:0], last[want:]...)
+			}
+			last = append(last, location{id, offset, size, entry.Header.Timestamp})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(last) > want {
+			last = last[len(last)-want:]
+		}
+		found = append(found, last...)
+		perShard[shard] += len(last)
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.timestamp != b.timestamp {
+			return a.timestamp > b.timestamp
+		}
+		if a.fileId != b.fileId {
+			return a.fileId > b.fileId
+		}
+		return a.offset > b.offset
+	})
+	if len(found) > n {
+		found = found[:n]
+	}
+
+	entries := make([]EntryInfo, 0, len(found))
+	for _, loc := range found {
+		info, err := bc.entryInfo(loc.fileId, loc.offset, loc.size)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, info)
+	}
+	return entries, nil
+}
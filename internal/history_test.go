@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	bc := openTestDB(t)
+
+	bc.Put("k", "v1")
+	bc.Put("other", "x")
+	bc.Put("k", "v2")
+	bc.Delete("k")
+	bc.Put("k", "v3")
+
+	history, err := bc.History("k")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+
+	want := []struct {
+		value     string
+		tombstone bool
+	}{{"v1", false}, {"v2", false}, {"", true}, {"v3", false}}
+	if len(history) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), history)
+	}
+	for i, w := range want {
+		if history[i].Value != w.value || history[i].Tombstone != w.tombstone {
+			t.Fatalf("entry %d = %+v, want %+v", i, history[i], w)
+		}
+		if i > 0 && history[i].Offset <= history[i-1].Offset {
+			t.Fatalf("entries out of order: %+v", history)
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	for _, shards := range []int{1, 3} {
+		bc, err := Open(t.TempDir(), WithShards(shards, ""))
+		if err != nil {
+			t.Fatalf("failed to open: %v", err)
+		}
+
+		type op struct {
+			key, value string
+			del        bool
+		}
+		ops := []op{{"a", "1", false}, {"b", "1", false}, {"a", "", true}, {"c", "1", false}}
+		for i := 0; i < 3; i++ {
+			for _, o := range ops {
+				var err error
+				if o.del {
+					_, err = bc.Delete(o.key)
+				} else {
+					err = bc.Put(o.key, o.value+fmt.Sprint(i))
+				}
+				if err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+			}
+			if err := bc.Roll(); err != nil {
+				t.Fatalf("Roll failed: %v", err)
+			}
+		}
+		if err := bc.Put("b", "last"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+
+		// Most recent first, across files and shards
+		want := []op{{"b", "last", false}, {"c", "12", false}, {"a", "", true}, {"b", "12", false}, {"a", "12", false}, {"c", "11", false}}
+		tail, err := bc.Tail(len(want))
+		if err != nil {
+			t.Fatalf("Tail failed: %v", err)
+		}
+		if len(tail) != len(want) {
+			t.Fatalf("%d shards: got %d entries, want %d", shards, len(tail), len(want))
+		}
+		for i, w := range want {
+			if got := tail[i]; got.Key != w.key || got.Value != w.value || got.Tombstone != w.del {
+				t.Fatalf("%d shards: entry %d = %+v, want %+v", shards, i, got, w)
+			}
+		}
+
+		if all, err := bc.Tail(100); err != nil || len(all) != 3*len(ops)+1 {
+			t.Fatalf("%d shards: Tail(100) returned %d entries, %v", shards, len(all), err)
+		}
+		if none, err := bc.Tail(0); err != nil || len(none) != 0 {
+			t.Fatalf("%d shards: Tail(0) returned %d entries, %v", shards, len(none), err)
+		}
+		bc.Close()
+	}
+}
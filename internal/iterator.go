@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"sort"
+	"time"
+)
+
+// Iterator walks the live keys of a BitCask in key order. The keys and
+// where their values were are captured when it is created, so writes made
+// while iterating don't disturb it, and values are only read from disk when
+// Value is called. An iterator is not safe for concurrent use.
+//
+//	it := bc.NewIterator()
+//	defer it.Close()
+//	for it.Next() {
+//		value, err := it.Value()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	bc       *BitCask
+	keys     []string
+	pointers []ValuePointer
+	pos      int
+	err      error
+}
+
+// NewIterator returns an iterator over the keys that are live now. Taking
+// the snapshot copies every key pointer under one read lock, like
+// KeyDirSnapshot. With a lazy index the iterator is empty and Err returns
+// ErrLazyIndex.
+func (bc *BitCask) NewIterator() *Iterator {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	it := &Iterator{bc: bc, pos: -1}
+	if it.err = bc.checkFullIndex(); it.err != nil {
+		return it
+	}
+
+	now := time.Now()
+	it.keys = make([]string, 0, len(bc.KeyDir))
+	for key, vp := range bc.KeyDir {
+		if !vp.expired(now) {
+			it.keys = append(it.keys, key)
+		}
+	}
+	sort.Strings(it.keys)
+
+	it.pointers = make([]ValuePointer, len(it.keys))
+	for i, key := range it.keys {
+		it.pointers[i] = bc.KeyDir[key]
+	}
+	return it
+}
+
+// Next advances to the next key, returning false once there is none left.
+func (it *Iterator) Next() bool {
+	if it.pos+1 >= len(it.keys) {
+		it.pos = len(it.keys)
+		return false
+	}
+	it.pos++
+	return true
+}
+
+// Key returns the current key.
+func (it *Iterator) Key() string {
+	return it.keys[it.pos]
+}
+
+// Value reads the value the current key had when the iterator was created.
+// It returns ErrKeyNotFound if the key has been deleted or has expired
+// since. If the value was overwritten and the file holding the old one was
+// merged away in the meantime, the current value is returned instead.
+func (it *Iterator) Value() (string, error) {
+	bc := it.bc
+	key, vp := it.keys[it.pos], it.pointers[it.pos]
+
+	bc.Mu.RLock()
+	if bc.closed.Load() {
+		bc.Mu.RUnlock()
+		return "", ErrClosed
+	}
+	if cur, ok := bc.lookup(key); !ok || cur.expired(time.Now()) {
+		bc.Mu.RUnlock()
+		return "", ErrKeyNotFound
+	}
+	df, ok := bc.Files[vp.FileId]
+	if !ok {
+		bc.Mu.RUnlock()
+		value, _, err := bc.load(key)
+		return value, err
+	}
+	df.acquire()
+	needsFlush := bc.unflushed(vp)
+	bc.Mu.RUnlock()
+
+	if needsFlush {
+		if err := bc.flushPinned(df); err != nil {
+			return "", err
+		}
+	}
+	defer df.release()
+
+	return bc.readValue(df, vp)
+}
+
+// Err returns the error that kept the iterator from walking the keys, if
+// any. Errors reading single values are returned by Value.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close releases the snapshot. Next returns false afterwards.
+func (it *Iterator) Close() {
+	it.keys, it.pointers = nil, nil
+	it.pos = -1
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	bc := openTestDB(t)
+
+	for _, key := range []string{"c", "a", "d", "b"} {
+		if err := bc.Put(key, "old-"+key); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	it := bc.NewIterator()
+	defer it.Close()
+
+	// Writes after the snapshot don't change what the iterator sees,
+	// except that deleted keys no longer have a value
+	bc.Put("a", "new-a")
+	bc.Put("e", "new-e")
+	bc.Delete("c")
+
+	var got []string
+	for it.Next() {
+		value, err := it.Value()
+		if errors.Is(err, ErrKeyNotFound) {
+			value = "<deleted>"
+		} else if err != nil {
+			t.Fatalf("Value(%q) failed: %v", it.Key(), err)
+		}
+		got = append(got, it.Key()+"="+value)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	want := "[a=old-a b=old-b c=<deleted> d=old-d]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("iterated %v, want %v", got, want)
+	}
+
+	it.Close()
+	if it.Next() {
+		t.Fatalf("Next returned true after Close")
+	}
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KeyDirSnapshot returns a copy of the in-memory index taken under a single
+// read lock. The copy is a consistent point-in-time view, but it costs one
+// allocation per key, so prefer ForEachKey for large keyspaces. Under a lazy
+// index KeyDir doesn't hold every key and it returns ErrLazyIndex.
+func (bc *BitCask) KeyDirSnapshot() (map[string]ValuePointer, error) {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	if err := bc.checkFullIndex(); err != nil {
+		return nil, err
+	}
+	snapshot := make(map[string]ValuePointer, len(bc.KeyDir))
+	for key, vp := range bc.KeyDir {
+		snapshot[key] = vp
+	}
+	return snapshot, nil
+}
+
+// ForEachKey calls fn for every live key without holding the read lock for
+// the whole walk. The range over KeyDir is suspended between batches of
+// forEachBatchSize keys: the read lock is only held while a batch is pulled,
+// and fn runs with no lock held. Nothing is copied up front, so a walk costs
+// one batch of memory whatever the size of the keyspace.
+//
+// The walk is not a point-in-time view. Keys deleted or expired before the
+// walk reaches them are skipped, keys added after it started may or may not
+// be visited, and a key is reported with whichever pointer was current when
+// its batch was pulled. A key that is deleted and written again mid-walk
+// may be visited twice. fn may call back into bc. Under a lazy index it
+// returns ErrLazyIndex without calling fn.
+func (bc *BitCask) ForEachKey(fn func(key string, vp ValuePointer)) error {
+	bc.Mu.RLock()
+	if err := bc.checkFullIndex(); err != nil {
+		bc.Mu.RUnlock()
+		return err
+	}
+	// Writers may change the map between pulls, which a range allows; the
+	// lock keeps them from doing so while the range is running
+	next, stop := iter.Pull2(maps.All(bc.KeyDir))
+	bc.Mu.RUnlock()
+	defer stop()
+
+	type item struct {
+		key string
+		vp  ValuePointer
+	}
+	batch := make([]item, 0, forEachBatchSize)
+	for done := false; !done; {
+		batch = batch[:0]
+		now := time.Now()
+		bc.Mu.RLock()
+		for len(batch) < forEachBatchSize {
+			key, vp, ok := next()
+			if !ok {
+				done = true
+				break
+			}
+			if !vp.expired(now) {
+				batch = append(batch, item{key, vp})
+			}
+		}
+		bc.Mu.RUnlock()
+
+		for _, it := range batch {
+			fn(it.key, it.vp)
+		}
+	}
+	return nil
+}
+
+// Exists reports whether key has a live, unexpired value, without reading
+// it from disk.
+func (bc *BitCask) Exists(key string) bool {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	vp, ok := bc.lookup(key)
+	return ok && !vp.expired(time.Now())
+}
+
+// Strlen returns the length of the value of key. It is worked out from the
+// size of the entry in KeyDir without reading the value, so it costs the
+// same for any value size. Missing and expired keys return ErrKeyNotFound.
+func (bc *BitCask) Strlen(key string) (int64, error) {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	vp, ok := bc.lookup(key)
+	if !ok || vp.expired(time.Now()) {
+		return 0, ErrKeyNotFound
+	}
+	df, ok := bc.Files[vp.FileId]
+	if !ok {
+		return 0, fmt.Errorf("%w: %d", ErrFileNotFound, vp.FileId)
+	}
+	return vp.Size - entryHeaderSize(df.header.Version) - int64(len(key)), nil
+}
+
+// Scan returns the live keys starting with prefix, an empty prefix matching
+// every key. KeyDir is a map, so every key is looked at under one read lock
+// and the result is in no particular order; see ScanSorted.
+func (bc *BitCask) Scan(prefix string) ([]string, error) {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	if bc.closed.Load() {
+		return nil, ErrClosed
+	}
+	if err := bc.checkFullIndex(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var keys []string
+	for key, vp := range bc.KeyDir {
+		if strings.HasPrefix(key, prefix) && !vp.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// ScanSorted is Scan with the keys sorted.
+func (bc *BitCask) ScanSorted(prefix string) ([]string, error) {
+	keys, err := bc.Scan(prefix)
+	sort.Strings(keys)
+	return keys, err
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	bc := openTestDB(t)
+
+	for _, key := range []string{"user:2", "user:1", "order:1", "user:3"} {
+		if err := bc.Put(key, "v"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	bc.Delete("user:3")
+	bc.Mu.Lock()
+	bc.putExpiring("user:4", "v", time.Now().Add(-time.Second).UnixNano())
+	bc.Mu.Unlock()
+
+	for _, tc := range []struct {
+		prefix string
+		want   string
+	}{
+		{"user:", "[user:1 user:2]"},
+		{"", "[order:1 user:1 user:2]"},
+		{"nope", "[]"},
+		{"user:1", "[user:1]"},
+	} {
+		keys, err := bc.ScanSorted(tc.prefix)
+		if err != nil {
+			t.Fatalf("ScanSorted(%q) failed: %v", tc.prefix, err)
+		}
+		if fmt.Sprint(keys) != tc.want {
+			t.Fatalf("ScanSorted(%q) = %v, want %v", tc.prefix, keys, tc.want)
+		}
+	}
+
+	if keys, err := bc.Scan("user:"); err != nil || len(keys) != 2 {
+		t.Fatalf("Scan = %v, %v", keys, err)
+	}
+}
+
+func TestStrlen(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	large := strings.Repeat("x", 1<<20)
+	bc.Put("large", large)
+	bc.Put("empty", "")
+	bc.Put("k", "hello")
+	bc.Put("k", "hi")
+
+	check := func(stage string) {
+		t.Helper()
+		read := bc.bytesRead.Load()
+		for key, want := range map[string]int64{"large": 1 << 20, "empty": 0, "k": 2} {
+			if n, err := bc.Strlen(key); err != nil || n != want {
+				t.Fatalf("%s: Strlen(%q) = %d, %v, want %d", stage, key, n, err, want)
+			}
+		}
+		if _, err := bc.Strlen("missing"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("%s: Strlen of a missing key: got %v, want ErrKeyNotFound", stage, err)
+		}
+		if got := bc.bytesRead.Load(); got != read {
+			t.Fatalf("%s: Strlen read %d bytes from disk", stage, got-read)
+		}
+	}
+
+	check("open")
+	if _, err := bc.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	check("merged")
+	bc.Close()
+
+	if bc, err = Open(dir); err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	check("reopened")
+}
+
+func TestKeyDirSnapshotIsolation(t *testing.T) {
+	bc := openTestDB(t)
+
+	bc.Put("a", "1")
+	bc.Put("b", "2")
+	snapshot, err := bc.KeyDirSnapshot()
+	if err != nil {
+		t.Fatalf("KeyDirSnapshot failed: %v", err)
+	}
+	want := snapshot["a"]
+
+	bc.Put("a", "3")
+	bc.Delete("b")
+	bc.Put("c", "4")
+	if len(snapshot) != 2 || snapshot["a"] != want {
+		t.Fatalf("snapshot changed by later writes: %v", snapshot)
+	}
+	if _, ok := snapshot["b"]; !ok {
+		t.Fatal("deleted key missing from the snapshot")
+	}
+
+	// Nor does changing the snapshot reach the index
+	delete(snapshot, "a")
+	if _, err := bc.Get("a"); err != nil {
+		t.Fatalf("Get after editing the snapshot: %v", err)
+	}
+}
+
+func TestForEachKeyUnderConcurrentWrites(t *testing.T) {
+	bc := openTestDB(t)
+
+	const n = 3 * forEachBatchSize
+	for i := 0; i < n; i++ {
+		bc.Put(fmt.Sprintf("stable:%d", i), "v")
+		bc.Put(fmt.Sprintf("gone:%d", i), "v")
+	}
+	bc.Mu.Lock()
+	bc.putExpiring("expired", "v", time.Now().Add(-time.Second).UnixNano())
+	bc.Mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			bc.Put(fmt.Sprintf("new:%d", i), "v")
+			bc.Delete(fmt.Sprintf("gone:%d", i))
+		}
+	}()
+
+	seen := make(map[string]int)
+	err := bc.ForEachKey(func(key string, _ ValuePointer) {
+		seen[key]++
+	})
+	<-done
+	if err != nil {
+		t.Fatalf("ForEachKey failed: %v", err)
+	}
+
+	for key, count := range seen {
+		if count != 1 {
+			t.Errorf("%s visited %d times", key, count)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if key := fmt.Sprintf("stable:%d", i); seen[key] != 1 {
+			t.Fatalf("%s not visited", key)
+		}
+	}
+	if seen["expired"] != 0 {
+		t.Fatal("expired key visited")
+	}
+
+	// Once the writes are over, a walk sees exactly the live keys
+	clear(seen)
+	bc.ForEachKey(func(key string, _ ValuePointer) {
+		seen[key]++
+	})
+	if len(seen) != 2*n || seen["gone:0"] != 0 || seen["new:0"] != 1 {
+		t.Fatalf("got %d keys after the writes, want %d", len(seen), 2*n)
+	}
+}
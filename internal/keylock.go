@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// keyLocks serializes read-modify-write operations per key without a lock
+// per key: keys are hashed onto a fixed set of mutexes, so operations on
+// unrelated keys rarely wait for each other.
+type keyLocks [keyLockStripes]sync.Mutex
+
+func (l *keyLocks) forKey(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &l[h.Sum32()%keyLockStripes]
+}
+
+// update replaces the value of key with fn applied to its current value,
+// exists being false when the key is absent or expired. Only the append
+// takes bc.Mu for writing: the read and fn run under the key's lock, so
+// updates of different keys proceed in parallel. Writers that don't take
+// key locks, like Put, can still change key in between; update then notices
+// the pointer moved and starts over. An existing expiry is kept.
+func (bc *BitCask) update(key string, fn func(old string, exists bool) (string, error)) (string, error) {
+	mu := bc.keyLocks.forKey(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	for {
+		old, vp, err := bc.load(key)
+		exists := err == nil
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return "", err
+		}
+
+		value, err := fn(old, exists)
+		if err != nil {
+			return "", err
+		}
+
+		bc.Mu.Lock()
+		cur, ok := bc.lookup(key)
+		live := ok && !cur.expired(time.Now())
+		if live == exists && (!exists || cur == vp) {
+			var expireAt int64
+			if exists {
+				expireAt = vp.ExpireAt
+			}
+			err = bc.putExpiring(key, value, expireAt)
+			bc.Mu.Unlock()
+			return value, err
+		}
+		bc.Mu.Unlock()
+	}
+}
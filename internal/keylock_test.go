@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// incr adds one to the integer stored at key, as INCR would.
+func incr(bc *BitCask, key string) (string, error) {
+	return bc.update(key, func(old string, exists bool) (string, error) {
+		n := 0
+		if exists {
+			var err error
+			if n, err = strconv.Atoi(old); err != nil {
+				return "", err
+			}
+		}
+		return strconv.Itoa(n + 1), nil
+	})
+}
+
+func TestUpdateConcurrentIncrements(t *testing.T) {
+	bc := openTestDB(t)
+
+	const workers, rounds = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if _, err := incr(bc, fmt.Sprintf("counter:%d", i%2)); err != nil {
+					t.Errorf("update failed: %v", err)
+					return
+				}
+				if err := bc.Put(fmt.Sprintf("other:%d", w), "x"); err != nil {
+					t.Errorf("Put failed: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for i := 0; i < 2; i++ {
+		want := strconv.Itoa(workers * rounds / 2)
+		if got, err := bc.Get(fmt.Sprintf("counter:%d", i)); err != nil || got != want {
+			t.Fatalf("counter:%d: got %q, %v, want %s", i, got, err, want)
+		}
+	}
+}
+
+func TestUpdateRetriesAfterConcurrentPut(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("key", "1"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	calls := 0
+	got, err := bc.update("key", func(old string, exists bool) (string, error) {
+		calls++
+		if calls == 1 {
+			// A plain writer slips in between the read and the append
+			if err := bc.Put("key", "10"); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		return old + "+", nil
+	})
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if calls != 2 || got != "10+" {
+		t.Fatalf("got %q after %d calls, want \"10+\" after 2", got, calls)
+	}
+}
+
+func BenchmarkIncrDistinctKeys(b *testing.B) {
+	bc, err := Open(b.TempDir())
+	if err != nil {
+		b.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	var worker atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		key := fmt.Sprintf("counter:%d", worker.Add(1))
+		for pb.Next() {
+			if _, err := incr(bc, key); err != nil {
+				b.Errorf("update failed: %v", err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"errors"
+	"hash/fnv"
+	"log"
+	"math"
+	"sort"
+)
+
+// With Options.LazyIndex, sealed files that have a valid hint file are not
+// loaded into KeyDir. Each gets a lazyFile instead: one fixed-width slot per
+// key holding a hash of the key and where its latest entry in the file is,
+// 16 bytes in all against the key itself plus a ValuePointer and map
+// overhead for a KeyDir entry. A lookup that misses KeyDir searches these
+// files newest first and reads the entry header and key from disk to
+// confirm a match, which costs one read per candidate file.
+//
+// KeyDir then only holds keys read from scanned files or written since
+// Open, shadowing the lazy files, and lazyTombstones remembers deletions of
+// keys that may still be found in them. Everything that walks KeyDir sees
+// only those keys, so merges, retention and dumps, which would need every
+// key, are refused with ErrLazyIndex.
+
+// ErrLazyIndex is returned by operations that need every key in memory when
+// the database was opened with Options.LazyIndex and files were loaded
+// lazily.
+var ErrLazyIndex = errors.New("not supported with a lazy index")
+
+// lazySlot locates the latest entry of one key within a lazyFile.
+type lazySlot struct {
+	hash   uint64
+	offset uint32
+	size   uint32
+}
+
+// lazyFile is the compact index of one sealed file, sorted by hash.
+type lazyFile struct {
+	fileId int
+	slots  []lazySlot
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// lazyIndexable reports whether the records of a file can go into a
+// lazyFile: offsets and sizes must fit in 32 bits and entries must carry
+// versions.
+func lazyIndexable(header fileHeader, fileSize int64) bool {
+	return header.Version >= 2 && fileSize <= math.MaxUint32
+}
+
+// newLazyFile builds the index of fileId from its hint records, keeping the
+// last record of every key.
+func newLazyFile(fileId int, records []hintRecord) *lazyFile {
+	latest := make(map[string]int, len(records))
+	for i, r := range records {
+		latest[r.Key] = i
+	}
+
+	lf := &lazyFile{fileId: fileId, slots: make([]lazySlot, 0, len(latest))}
+	for key, i := range latest {
+		lf.slots = append(lf.slots, lazySlot{
+			hash:   hashKey(key),
+			offset: uint32(records[i].Offset),
+			size:   uint32(records[i].Size),
+		})
+	}
+	sort.Slice(lf.slots, func(i, j int) bool { return lf.slots[i].hash < lf.slots[j].hash })
+	return lf
+}
+
+// find looks key up in lf, reading candidate entries from df. deleted is
+// true if the latest entry of key in the file is a tombstone.
+func (lf *lazyFile) find(df *dataFile, key string) (vp ValuePointer, found, deleted bool, err error) {
+	h := hashKey(key)
+	i := sort.Search(len(lf.slots), func(i int) bool { return lf.slots[i].hash >= h })
+	for ; i < len(lf.slots) && lf.slots[i].hash == h; i++ {
+		slot := lf.slots[i]
+		offset, size := int64(slot.offset), int64(slot.size)
+		entry, _, err := readLogEntryHeaderAndKey(df.file, df.header.Version, offset, offset+size)
+		if err != nil {
+			return ValuePointer{}, false, false, err
+		}
+		if string(entry.Key) != key {
+			continue
+		}
+		if entry.IsDeleted() {
+			return ValuePointer{}, true, true, nil
+		}
+		return ValuePointer{
+			FileId:   lf.fileId,
+			Offset:   offset,
+			Size:     size,
+			Version:  entry.Header.Version,
+			ExpireAt: entry.Header.ExpireAt,
+		}, true, false, nil
+	}
+	return ValuePointer{}, false, false, nil
+}
+
+// lookup returns the pointer to the current value of key, from KeyDir or
+// the lazily indexed files that are newer than what KeyDir knows. Callers
+// hold bc.Mu.
+func (bc *BitCask) lookup(key string) (ValuePointer, bool) {
+	vp, ok := bc.KeyDir[key]
+	if len(bc.lazy) == 0 {
+		return vp, ok
+	}
+
+	floor := -1
+	if ok {
+		floor = vp.FileId
+	}
+	if id, dead := bc.lazyTombstones[key]; dead && id > floor {
+		vp, ok, floor = ValuePointer{}, false, id
+	}
+
+	for i := len(bc.lazy) - 1; i >= 0 && bc.lazy[i].fileId > floor; i-- {
+		lf := bc.lazy[i]
+		df, exists := bc.Files[lf.fileId]
+		if !exists {
+			continue
+		}
+		found, hit, deleted, err := lf.find(df, key)
+		if err != nil {
+			log.Printf("Lazy index: failed to look up %q in file %d: %v", key, lf.fileId, err)
+			continue
+		}
+		if hit {
+			return found, !deleted
+		}
+	}
+	return vp, ok
+}
+
+// shadowLazy records that key was deleted by a tombstone in fileId, so the
+// lazily indexed files older than it no longer provide its value. Callers
+// hold bc.Mu for writing.
+func (bc *BitCask) shadowLazy(key string, fileId int) {
+	if len(bc.lazy) > 0 {
+		bc.lazyTombstones[key] = fileId
+	}
+}
+
+// checkFullIndex fails with ErrLazyIndex if some keys are only in lazily
+// indexed files. Callers hold bc.Mu.
+func (bc *BitCask) checkFullIndex() error {
+	if len(bc.lazy) > 0 {
+		return ErrLazyIndex
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLazyIndex(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	put := func(key, value string) {
+		t.Helper()
+		if err := bc.Put(key, value); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// Two sealed files with hints, c deleted in the newer one, and d in
+	// the active file, which has no hint and is loaded into KeyDir
+	for _, key := range []string{"a", "b", "c"} {
+		put(key, "1")
+	}
+	if err := bc.Roll(); err != nil {
+		t.Fatalf("Roll failed: %v", err)
+	}
+	put("b", "2")
+	if _, err := bc.Delete("c"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := bc.Roll(); err != nil {
+		t.Fatalf("Roll failed: %v", err)
+	}
+	if err := bc.RebuildHints(); err != nil {
+		t.Fatalf("RebuildHints failed: %v", err)
+	}
+	put("d", "1")
+	bc.Close()
+
+	bc, err = Open(dir, WithLazyIndex(true))
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if len(bc.lazy) != 2 || len(bc.KeyDir) != 1 {
+		t.Fatalf("got %d lazy files and %d keys in KeyDir, want 2 and 1", len(bc.lazy), len(bc.KeyDir))
+	}
+	check := func(want map[string]string) {
+		t.Helper()
+		for key, value := range want {
+			got, err := bc.Get(key)
+			if value == "" {
+				if err == nil || bc.Exists(key) {
+					t.Fatalf("Get(%q): got %q, want not found", key, got)
+				}
+				continue
+			}
+			if err != nil || got != value {
+				t.Fatalf("Get(%q): got %q, %v, want %q", key, got, err, value)
+			}
+		}
+	}
+	check(map[string]string{"a": "1", "b": "2", "c": "", "d": "1", "missing": ""})
+
+	// Writes continue the versions of lazily indexed keys and shadow them
+	if v, _ := bc.Version("b"); v != 2 {
+		t.Fatalf("version of b: got %d, want 2", v)
+	}
+	put("b", "3")
+	if v, _ := bc.Version("b"); v != 3 {
+		t.Fatalf("version of b after Put: got %d, want 3", v)
+	}
+	if _, err := bc.Delete("a"); err != nil {
+		t.Fatalf("Delete of a lazily indexed key failed: %v", err)
+	}
+	check(map[string]string{"a": "", "b": "3"})
+
+	if _, err := bc.Merge(); !errors.Is(err, ErrLazyIndex) {
+		t.Fatalf("Merge: got %v, want ErrLazyIndex", err)
+	}
+	if err := bc.Dump(io.Discard); !errors.Is(err, ErrLazyIndex) {
+		t.Fatalf("Dump: got %v, want ErrLazyIndex", err)
+	}
+	// Walkers of KeyDir would silently miss the lazily indexed keys
+	var out bytes.Buffer
+	if err := bc.ExportAOF(&out); !errors.Is(err, ErrLazyIndex) || out.Len() != 0 {
+		t.Fatalf("ExportAOF: got %v and %d bytes, want ErrLazyIndex and none", err, out.Len())
+	}
+	if err := bc.WarmUp(context.Background()); !errors.Is(err, ErrLazyIndex) {
+		t.Fatalf("WarmUp: got %v, want ErrLazyIndex", err)
+	}
+	if _, err := bc.KeyDirSnapshot(); !errors.Is(err, ErrLazyIndex) {
+		t.Fatalf("KeyDirSnapshot: got %v, want ErrLazyIndex", err)
+	}
+	if err := bc.ForEachKey(func(string, ValuePointer) {}); !errors.Is(err, ErrLazyIndex) {
+		t.Fatalf("ForEachKey: got %v, want ErrLazyIndex", err)
+	}
+	if _, err := bc.KeysInFile(bc.CurrentFileId); !errors.Is(err, ErrLazyIndex) {
+		t.Fatalf("KeysInFile: got %v, want ErrLazyIndex", err)
+	}
+	if _, err := bc.ExpiringBefore(time.Now()); !errors.Is(err, ErrLazyIndex) {
+		t.Fatalf("ExpiringBefore: got %v, want ErrLazyIndex", err)
+	}
+
+	// A full load agrees with what the lazy one ended up with
+	bc.Close()
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	check(map[string]string{"a": "", "b": "3", "c": "", "d": "1"})
+}
+
+// BenchmarkLoadMemory reports the heap a loaded index takes per key, with
+// every key in KeyDir and with the lazy index.
+func BenchmarkLoadMemory(b *testing.B) {
+	const keys = 100000
+	dir := b.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		b.Fatalf("failed to open: %v", err)
+	}
+	for i := 0; i < keys; i++ {
+		if err := bc.Put(fmt.Sprintf("user:%08d:profile", i), "value"); err != nil {
+			b.Fatalf("Put failed: %v", err)
+		}
+	}
+	if err := bc.Roll(); err != nil {
+		b.Fatalf("Roll failed: %v", err)
+	}
+	if err := bc.RebuildHints(); err != nil {
+		b.Fatalf("RebuildHints failed: %v", err)
+	}
+	bc.Close()
+
+	for _, tc := range []struct {
+		name string
+		lazy bool
+	}{
+		{"KeyDir", false},
+		{"Lazy", true},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			var total uint64
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				bc, err := Open(dir, WithLazyIndex(tc.lazy))
+				if err != nil {
+					b.Fatalf("failed to open: %v", err)
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				total += after.HeapAlloc - before.HeapAlloc
+				bc.Close()
+			}
+			b.ReportMetric(float64(total)/float64(b.N)/keys, "heap-bytes/key")
+		})
+	}
+}
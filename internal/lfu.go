@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"math/rand"
+	"time"
+)
+
+// lfuCounter is a Redis-style logarithmic access counter. The counter grows
+// with the log of the number of accesses, so a single byte is enough to tell
+// hot keys from cold ones, and it decays by one for every elapsed decay period
+// so keys that were hot a long time ago fade out.
+type lfuCounter struct {
+	counter  uint8
+	lastDecr time.Time
+}
+
+func newLFUCounter(now time.Time) *lfuCounter {
+	return &lfuCounter{counter: lfuInitVal, lastDecr: now}
+}
+
+// decay lowers the counter by the number of decay periods elapsed since the
+// last decrement.
+func (c *lfuCounter) decay(now time.Time) {
+	periods := int(now.Sub(c.lastDecr) / lfuDecayTime)
+	if periods <= 0 {
+		return
+	}
+	if periods >= int(c.counter) {
+		c.counter = 0
+	} else {
+		c.counter -= uint8(periods)
+	}
+	c.lastDecr = c.lastDecr.Add(time.Duration(periods) * lfuDecayTime)
+}
+
+// incr bumps the counter with probability 1/((counter-init)*factor+1), r
+// being a random draw from [0, 1).
+func (c *lfuCounter) incr(r float64) {
+	if c.counter == 255 {
+		return
+	}
+	base := float64(c.counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if r < 1.0/(base*lfuLogFactor+1) {
+		c.counter++
+	}
+}
+
+// touchFreq records an access to key. Callers may hold either side of bc.Mu;
+// the counters have their own lock so reads can update them.
+func (bc *BitCask) touchFreq(key string) {
+	bc.freqMu.Lock()
+	defer bc.freqMu.Unlock()
+
+	now := bc.opts.Clock()
+	c, ok := bc.freq[key]
+	if !ok {
+		c = newLFUCounter(now)
+		bc.freq[key] = c
+	}
+	c.decay(now)
+	c.incr(rand.Float64())
+}
+
+func (bc *BitCask) dropFreq(key string) {
+	bc.freqMu.Lock()
+	delete(bc.freq, key)
+	bc.freqMu.Unlock()
+}
+
+// AccessFrequency returns the decayed logarithmic access counter of key, as
+// reported by OBJECT FREQ. Keys that were loaded from disk but never read
+// report the initial value.
+func (bc *BitCask) AccessFrequency(key string) (uint8, bool) {
+	bc.Mu.RLock()
+	_, ok := bc.lookup(key)
+	bc.Mu.RUnlock()
+	if !ok {
+		return 0, false
+	}
+
+	bc.freqMu.Lock()
+	defer bc.freqMu.Unlock()
+
+	c, ok := bc.freq[key]
+	if !ok {
+		return lfuInitVal, true
+	}
+	c.decay(bc.opts.Clock())
+	return c.counter, true
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLFUCounterIncrIsLogarithmic(t *testing.T) {
+	c := newLFUCounter(time.Now())
+
+	// At the initial value every access counts
+	c.incr(0.99)
+	if c.counter != lfuInitVal+1 {
+		t.Fatalf("counter %d, want %d", c.counter, lfuInitVal+1)
+	}
+
+	// One above it, an access counts with probability 1/(factor+1)
+	c.incr(1.0/(lfuLogFactor+1) + 0.001)
+	if c.counter != lfuInitVal+1 {
+		t.Fatalf("counter %d, want %d", c.counter, lfuInitVal+1)
+	}
+	c.incr(1.0/(lfuLogFactor+1) - 0.001)
+	if c.counter != lfuInitVal+2 {
+		t.Fatalf("counter %d, want %d", c.counter, lfuInitVal+2)
+	}
+
+	c.counter = 255
+	c.incr(0)
+	if c.counter != 255 {
+		t.Fatalf("counter overflowed to %d", c.counter)
+	}
+
+	// Reaching init+n takes about factor*n²/2 accesses
+	c = newLFUCounter(time.Now())
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		c.incr(rng.Float64())
+	}
+	if c.counter < lfuInitVal+8 || c.counter > lfuInitVal+20 {
+		t.Fatalf("counter %d after 1000 accesses, want about %d", c.counter, lfuInitVal+14)
+	}
+}
+
+func TestLFUCounterDecay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newLFUCounter(start)
+	c.counter = 10
+
+	c.decay(start.Add(lfuDecayTime - time.Second))
+	if c.counter != 10 {
+		t.Fatalf("counter %d after less than a period, want 10", c.counter)
+	}
+
+	// A partial period carries over to the next decay
+	c.decay(start.Add(3*lfuDecayTime + lfuDecayTime/2))
+	if c.counter != 7 {
+		t.Fatalf("counter %d after 3 periods, want 7", c.counter)
+	}
+	c.decay(start.Add(4 * lfuDecayTime))
+	if c.counter != 6 {
+		t.Fatalf("counter %d after 4 periods, want 6", c.counter)
+	}
+
+	c.decay(start.Add(100 * lfuDecayTime))
+	if c.counter != 0 {
+		t.Fatalf("counter %d, want it to stop at 0", c.counter)
+	}
+}
+
+func TestAccessFrequencyDecaysWithClock(t *testing.T) {
+	var now atomic.Int64
+	now.Store(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	clock := func() time.Time { return time.Unix(0, now.Load()) }
+
+	bc, err := Open(t.TempDir(), WithClock(clock))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	if err := bc.Put("k", "v"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if freq, ok := bc.AccessFrequency("k"); !ok || freq != lfuInitVal+1 {
+		t.Fatalf("got %d, %v, want %d after a write", freq, ok, lfuInitVal+1)
+	}
+
+	now.Add(int64(3 * lfuDecayTime))
+	if freq, _ := bc.AccessFrequency("k"); freq != lfuInitVal-2 {
+		t.Fatalf("got %d after 3 decay periods, want %d", freq, lfuInitVal-2)
+	}
+
+	if _, ok := bc.AccessFrequency("missing"); ok {
+		t.Fatal("expected no frequency for a missing key")
+	}
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// manifest holds instance-level metadata that must survive restarts. It is a
+// small text file in the data dir: a magic line followed by "name value" lines.
+type manifest struct {
+	RunId string
+	// Shard layout the data files were written with, see Options.Shards
+	Shards            int
+	ShardKeyDelimiter string
+	// Data files with a lower id were dropped by FlushDB, see LoadFiles
+	FlushedBelow int
+	// Versions of deleted keys whose entries are gone from disk stay below
+	// this, see lastVersion
+	VersionFloor uint64
+}
+
+func manifestPath(dir string) string {
+	return filepath.Join(dir, manifestFileName)
+}
+
+// loadManifest reads the manifest of dir, creating one with a fresh run id
+// the first time a directory is opened.
+func loadManifest(dir string) (*manifest, error) {
+	f, err := os.Open(manifestPath(dir))
+	if errors.Is(err, os.ErrNotExist) {
+		m := &manifest{RunId: newRunId(), Shards: 1}
+		if err := m.save(dir); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != manifestMagic {
+		return nil, fmt.Errorf("invalid manifest in %s", dir)
+	}
+
+	// Manifests written before sharding describe a single shard
+	m := &manifest{Shards: 1}
+	for scanner.Scan() {
+		name, value, _ := strings.Cut(scanner.Text(), " ")
+		switch name {
+		case "run_id":
+			m.RunId = value
+		case "shards":
+			if m.Shards, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid shards in manifest in %s: %w", dir, err)
+			}
+		case "shard_key_delimiter":
+			if m.ShardKeyDelimiter, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("invalid shard_key_delimiter in manifest in %s: %w", dir, err)
+			}
+		case "flushed_below":
+			if m.FlushedBelow, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid flushed_below in manifest in %s: %w", dir, err)
+			}
+		case "version_floor":
+			if m.VersionFloor, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid version_floor in manifest in %s: %w", dir, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if m.RunId == "" {
+		return nil, fmt.Errorf("manifest in %s has no run_id", dir)
+	}
+	return m, nil
+}
+
+// save atomically replaces the manifest via write-to-temp and rename.
+func (m *manifest) save(dir string) error {
+	tmp := manifestPath(dir) + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%s\nrun_id %s\nshards %d\nshard_key_delimiter %q\nflushed_below %d\nversion_floor %d\n",
+		manifestMagic, m.RunId, m.Shards, m.ShardKeyDelimiter, m.FlushedBelow, m.VersionFloor)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, manifestPath(dir)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// newRunId returns a random 40 hex character instance id, like Redis' run_id.
+func newRunId() string {
+	buf := make([]byte, 20)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
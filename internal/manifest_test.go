@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestRunIdPersistsAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	runId := bc.RunID()
+	bc.Close()
+
+	if !regexp.MustCompile(`^[0-9a-f]{40}$`).MatchString(runId) {
+		t.Fatalf("run id %q is not 40 hex chars", runId)
+	}
+
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if bc.RunID() != runId {
+		t.Fatalf("run id changed across reopen: %q -> %q", runId, bc.RunID())
+	}
+}
+
+func TestWipedDirGetsNewRunId(t *testing.T) {
+	dir := t.TempDir()
+
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	runId := bc.RunID()
+	bc.Close()
+
+	if err := os.Remove(manifestPath(dir)); err != nil {
+		t.Fatalf("failed to remove manifest: %v", err)
+	}
+
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if bc.RunID() == runId {
+		t.Fatalf("expected a new run id after wiping the manifest")
+	}
+}
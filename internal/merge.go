@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// MergeResult reports what a merge freed.
+type MergeResult struct {
+	Files int // data files merged and deleted
+	// ReclaimedBytes is the size of the merged files minus the size of
+	// the entries rewritten from them.
+	ReclaimedBytes int64
+	// DroppedEntries counts the stale entries left behind: overwritten
+	// values and tombstones that were no longer needed.
+	DroppedEntries int
+}
+
+func (r *MergeResult) add(o MergeResult) {
+	r.Files += o.Files
+	r.ReclaimedBytes += o.ReclaimedBytes
+	r.DroppedEntries += o.DroppedEntries
+}
+
+// Merge compacts every data file that is sealed when it starts, oldest
+// first, one MergeFile at a time so writers are only blocked for the merge
+// of a single file.
+func (bc *BitCask) Merge() (MergeResult, error) {
+	bc.Mu.RLock()
+	var ids []int
+	for _, id := range bc.sortedFileIds() {
+		if bc.activeShard(id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	bc.Mu.RUnlock()
+
+	var total MergeResult
+	for _, id := range ids {
+		res, err := bc.MergeFile(id)
+		if err != nil {
+			return total, fmt.Errorf("failed to merge file %d: %w", id, err)
+		}
+		total.add(res)
+	}
+	return total, nil
+}
+
+// MergeFile compacts the sealed data file fileId on its own: every entry
+// KeyDir still points into is appended again to the active file of its
+// shard, and the old file is then deleted. Readers that pinned the file
+// before the merge keep reading it until they release it.
+//
+// Tombstones of deleted keys are carried over too while older files exist,
+// since dropping them would let a value in one of those files come back on
+// the next Open. The versions of the entries dropped are kept by the version
+// floor, see lastVersion.
+func (bc *BitCask) MergeFile(fileId int) (MergeResult, error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return MergeResult{}, err
+	}
+	if err := bc.checkFullIndex(); err != nil {
+		return MergeResult{}, err
+	}
+
+	df, ok := bc.Files[fileId]
+	if !ok {
+		return MergeResult{}, fmt.Errorf("%w: %d", ErrFileNotFound, fileId)
+	}
+	if bc.activeShard(fileId) != nil {
+		return MergeResult{}, fmt.Errorf("file %d is active, roll it first", fileId)
+	}
+	size, err := bc.fileSize(fileId)
+	if err != nil {
+		return MergeResult{}, err
+	}
+
+	olderFiles := false
+	for id := range bc.Files {
+		if id < fileId {
+			olderFiles = true
+			break
+		}
+	}
+
+	type location struct {
+		offset, size int64
+	}
+	var live []location
+	tombstones := make(map[string]location)
+	scanned := 0
+
+	err = bc.scanFile(fileId, func(entry *LogEntry, offset int64, size int64) error {
+		scanned++
+		key := string(entry.Key)
+		if entry.Header.Tombstone {
+			if _, ok := bc.KeyDir[key]; !ok && olderFiles {
+				tombstones[key] = location{offset, size}
+			}
+			return nil
+		}
+		if vp, ok := bc.KeyDir[key]; ok && vp.FileId == fileId && vp.Offset == offset {
+			live = append(live, location{offset, size})
+		}
+		return nil
+	})
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to scan file %d: %w", fileId, err)
+	}
+	for _, loc := range tombstones {
+		live = append(live, loc)
+	}
+
+	var rewritten int64
+	for _, loc := range live {
+		entry, err := readLogEntry(df.file, df.header.Version, loc.offset, loc.size)
+		if err != nil {
+			return MergeResult{}, fmt.Errorf("failed to read entry at %d of file %d: %w", loc.offset, fileId, err)
+		}
+
+		// The entry keeps its timestamp, version and expiry; only its
+		// checksum is recomputed for the format of the active file. A live
+		// entry of a batch no longer needs the rest of it.
+		entry.Header.BatchContinues = false
+		vp, err := bc.appendEntry(entry, false)
+		if err != nil {
+			return MergeResult{}, err
+		}
+		rewritten += vp.Size
+		if !entry.Header.Tombstone {
+			bc.indexKey(string(entry.Key), vp)
+		}
+	}
+
+	if err := bc.fsync(); err != nil {
+		bc.recordWriteResult(err)
+		return MergeResult{}, err
+	}
+	if err := bc.saveVersionFloor(); err != nil {
+		return MergeResult{}, err
+	}
+
+	res := MergeResult{
+		Files:          1,
+		ReclaimedBytes: size - rewritten,
+		DroppedEntries: scanned - len(live),
+	}
+	return res, bc.removeFile(fileId)
+}
+
+// removeFile takes the sealed file fileId out of the database and deletes it
+// along with its hint file. Readers that pinned it keep it open until they
+// release it. Callers hold bc.Mu for writing and have moved or dropped every
+// KeyDir entry pointing into the file.
+func (bc *BitCask) removeFile(fileId int) error {
+	df := bc.Files[fileId]
+	delete(bc.Files, fileId)
+	delete(bc.usage, fileId)
+	if err := df.retire(true); err != nil {
+		log.Printf("Failed to close data file %d: %v", fileId, err)
+	}
+	if err := os.Remove(hintPath(bc.dir, fileId)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove hint of file %d: %w", fileId, err)
+	}
+
+	return syncDir(bc.dir)
+}
+
+// mergeCandidate returns the sealed file with the highest share of dead
+// bytes, if that share reaches minDeadRatio. Callers hold bc.Mu.
+func (bc *BitCask) mergeCandidate(minDeadRatio float64) (int, bool) {
+	best, bestRatio := 0, -1.0
+	for id, df := range bc.Files {
+		if bc.activeShard(id) != nil {
+			continue
+		}
+		size, err := bc.fileSize(id)
+		if err != nil {
+			continue
+		}
+		data := size - df.header.dataStart()
+		if data <= 0 {
+			continue
+		}
+
+		var live int64
+		if u, ok := bc.usage[id]; ok {
+			live = u.bytes
+		}
+		ratio := float64(data-live) / float64(data)
+		if ratio >= minDeadRatio && ratio > bestRatio {
+			best, bestRatio = id, ratio
+		}
+	}
+	return best, bestRatio >= 0
+}
+
+// autoMerge merges the best candidate file, if any, and reports which one.
+func (bc *BitCask) autoMerge() (int, bool, error) {
+	bc.Mu.RLock()
+	fileId, ok := bc.mergeCandidate(bc.opts.AutoMergeMinDeadRatio)
+	bc.Mu.RUnlock()
+	if !ok {
+		return 0, false, nil
+	}
+
+	_, err := bc.MergeFile(fileId)
+	return fileId, true, err
+}
+
+// startAutoMerge compacts one file per AutoMergeInterval so that merge work
+// is spread over time rather than done in one long pass.
+func (bc *BitCask) startAutoMerge() {
+	bc.syncWg.Add(1)
+
+	go func() {
+		defer bc.syncWg.Done()
+
+		ticker := time.NewTicker(bc.opts.AutoMergeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fileId, ok, err := bc.autoMerge()
+				if err != nil {
+					log.Printf("Auto-merge of file %d failed: %v", fileId, err)
+				} else if ok {
+					log.Printf("Auto-merged file %d", fileId)
+				}
+
+			case <-bc.done:
+				return
+			}
+		}
+	}()
+}
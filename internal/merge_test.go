@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMergeFile(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	roll := func() {
+		bc.Mu.Lock()
+		defer bc.Mu.Unlock()
+		if err := bc.RollNewFile(); err != nil {
+			t.Fatalf("RollNewFile failed: %v", err)
+		}
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := bc.Put(key, "old"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	roll()
+
+	// The merged file holds live values, an overwritten value and the
+	// tombstone of a key that still has a value in the older file.
+	merged := bc.CurrentFileId
+	for _, kv := range [][2]string{{"b", "new"}, {"c", "dead"}, {"c", "new"}, {"d", "new"}} {
+		if err := bc.Put(kv[0], kv[1]); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if _, err := bc.Delete("a"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	roll()
+
+	// A reader that pinned the file before the merge can still use it.
+	bc.Mu.RLock()
+	vp, df, err := bc.pin("d")
+	bc.Mu.RUnlock()
+	if err != nil {
+		t.Fatalf("pin failed: %v", err)
+	}
+
+	res, err := bc.MergeFile(merged)
+	if err != nil {
+		t.Fatalf("MergeFile failed: %v", err)
+	}
+	// Only the overwritten c=dead is dropped, the tombstone of a is kept.
+	// The file header goes away with the file.
+	want := MergeResult{Files: 1, ReclaimedBytes: fileHeaderSize + NewLogEntry("c", "dead", false).Size(), DroppedEntries: 1}
+	if res != want {
+		t.Fatalf("got %+v, want %+v", res, want)
+	}
+	if _, err := bc.MergeFile(bc.CurrentFileId); err == nil {
+		t.Fatalf("MergeFile of the active file succeeded")
+	}
+
+	if got, err := bc.readValue(df, vp); err != nil || got != "new" {
+		t.Fatalf("pinned read: got %q, %v", got, err)
+	}
+	df.release()
+	if _, err := os.Stat(df.path); !os.IsNotExist(err) {
+		t.Fatalf("merged file still on disk after last release: %v", err)
+	}
+
+	check := func(bc *BitCask) {
+		t.Helper()
+		if _, ok := bc.Files[merged]; ok {
+			t.Fatalf("file %d still open", merged)
+		}
+		for key, want := range map[string]string{"b": "new", "c": "new", "d": "new"} {
+			if got, err := bc.Get(key); err != nil || got != want {
+				t.Fatalf("Get(%q): got %q, %v, want %q", key, got, err, want)
+			}
+		}
+		if _, err := bc.Get("a"); err == nil {
+			t.Fatalf("deleted key a came back")
+		}
+	}
+	check(bc)
+
+	if err := bc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	check(bc)
+}
+
+func TestAutoMergePicksHighestDeadRatio(t *testing.T) {
+	bc, err := Open(t.TempDir(), WithAutoMerge(time.Hour, 0.5))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	roll := func() int {
+		bc.Mu.Lock()
+		defer bc.Mu.Unlock()
+		id := bc.CurrentFileId
+		if err := bc.RollNewFile(); err != nil {
+			t.Fatalf("RollNewFile failed: %v", err)
+		}
+		return id
+	}
+	put := func(key string) {
+		if err := bc.Put(key, "value"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// mostlyDead ends up 3/4 dead, halfDead 1/2 dead, live not dead at all.
+	for _, key := range []string{"a", "b", "c", "d"} {
+		put(key)
+	}
+	mostlyDead := roll()
+	for _, key := range []string{"b", "c", "e", "f"} {
+		put(key)
+	}
+	halfDead := roll()
+	for _, key := range []string{"d", "e", "f", "g"} {
+		put(key)
+	}
+	live := roll()
+
+	for _, want := range []int{mostlyDead, halfDead} {
+		got, ok, err := bc.autoMerge()
+		if err != nil {
+			t.Fatalf("autoMerge failed: %v", err)
+		}
+		if !ok || got != want {
+			t.Fatalf("autoMerge merged %d, %v, want %d", got, ok, want)
+		}
+	}
+	if got, ok, _ := bc.autoMerge(); ok {
+		t.Fatalf("autoMerge merged file %d, want nothing left to merge", got)
+	}
+	if _, ok := bc.Files[live]; !ok {
+		t.Fatalf("file %d without dead bytes was merged", live)
+	}
+
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		if got, err := bc.Get(key); err != nil || got != "value" {
+			t.Fatalf("Get(%q): got %q, %v", key, got, err)
+		}
+	}
+}
+
+func TestMergeReportsReclaimedSpace(t *testing.T) {
+	bc := openTestDB(t)
+
+	for i := 0; i < 10; i++ {
+		if err := bc.Put("key", fmt.Sprintf("value_%d", i)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		bc.Mu.Lock()
+		if err := bc.RollNewFile(); err != nil {
+			t.Fatalf("RollNewFile failed: %v", err)
+		}
+		bc.Mu.Unlock()
+	}
+	var before int64
+	for _, st := range bc.FileStats() {
+		before += st.Size
+	}
+
+	res, err := bc.Merge()
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	var after int64
+	for _, st := range bc.FileStats() {
+		after += st.Size
+	}
+	if res.Files != 10 || res.DroppedEntries != 9 || res.ReclaimedBytes != before-after {
+		t.Fatalf("got %+v, want 10 files, 9 dropped entries and %d bytes", res, before-after)
+	}
+	if got, err := bc.Get("key"); err != nil || got != "value_9" {
+		t.Fatalf("Get: got %q, %v", got, err)
+	}
+}
+
+func benchmarkPutWithAutoMerge(b *testing.B, opts ...Option) {
+	bc, err := Open(b.TempDir(), opts...)
+	if err != nil {
+		b.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	value := string(make([]byte, 1024))
+	b.SetBytes(1024)
+	b.ResetTimer()
+
+	// Overwrite a small key space and seal a file every 1000 writes so that
+	// auto-merge always has dead files to compact.
+	for i := 0; i < b.N; i++ {
+		if err := bc.Put(fmt.Sprintf("key_%d", i%1000), value); err != nil {
+			b.Fatalf("Put failed: %v", err)
+		}
+		if i%1000 == 999 {
+			bc.Mu.Lock()
+			err := bc.RollNewFile()
+			bc.Mu.Unlock()
+			if err != nil {
+				b.Fatalf("RollNewFile failed: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkPutSteadyState(b *testing.B) {
+	b.Run("AutoMergeOff", func(b *testing.B) {
+		benchmarkPutWithAutoMerge(b)
+	})
+	b.Run("AutoMergeOn", func(b *testing.B) {
+		benchmarkPutWithAutoMerge(b, WithAutoMerge(10*time.Millisecond, 0.5))
+	})
+}
+
+func TestMergeWhileWriting(t *testing.T) {
+	bc := openTestDB(t)
+
+	// Many overwrites of a few keys spread over sealed files
+	for i := 0; i < 20; i++ {
+		for k := 0; k < 10; k++ {
+			if err := bc.Put(fmt.Sprintf("key_%d", k), fmt.Sprintf("value_%d", i)); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		if err := bc.Roll(); err != nil {
+			t.Fatalf("Roll failed: %v", err)
+		}
+	}
+	var before int64
+	sealed := map[int]bool{}
+	for _, st := range bc.FileStats() {
+		if st.Id != bc.CurrentFileId {
+			before += st.Size
+			sealed[st.Id] = true
+		}
+	}
+
+	// Readers and writers carry on while the merge runs
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := bc.Put(fmt.Sprintf("new_%d", i%50), "x"); err != nil {
+				errs <- err
+				return
+			}
+			if got, err := bc.Get(fmt.Sprintf("key_%d", i%10)); err != nil || got != "value_19" {
+				errs <- fmt.Errorf("Get during merge: got %q, %v", got, err)
+				return
+			}
+		}
+	}()
+
+	res, err := bc.Merge()
+	close(done)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	// The concurrent writes make the total size move, so check what the
+	// merged files gave back: all but the 10 live entries
+	for _, st := range bc.FileStats() {
+		if sealed[st.Id] {
+			t.Fatalf("merged file %d still exists", st.Id)
+		}
+	}
+	if res.Files != len(sealed) || res.ReclaimedBytes <= before*9/10 {
+		t.Fatalf("got %+v, want %d files and most of %d bytes reclaimed", res, len(sealed), before)
+	}
+	for k := 0; k < 10; k++ {
+		if got, err := bc.Get(fmt.Sprintf("key_%d", k)); err != nil || got != "value_19" {
+			t.Fatalf("Get(key_%d): got %q, %v", k, got, err)
+		}
+	}
+}
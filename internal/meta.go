@@ -0,0 +1,34 @@
+package internal
+
+import "log"
+
+// Every entry header has room for 32 bits of application metadata, such as
+// a content type or a tag, which can be read back without reading the value.
+// Only PutWithMeta and Set store it; every other write clears it, the way
+// Put clears an expiry. Merges carry it over with the entry.
+
+// PutWithMeta is Put that also stores meta with the value.
+func (bc *BitCask) PutWithMeta(key string, value string, meta uint32) error {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	return bc.putEntry(key, value, 0, meta)
+}
+
+// GetMeta returns the metadata stored with the current value of key. It
+// reads only the entry header, never the value. Values written by older
+// formats, or without metadata, have 0.
+func (bc *BitCask) GetMeta(key string) (uint32, bool) {
+	vp, df, err := bc.pinFlushed(key)
+	if err != nil {
+		return 0, false
+	}
+	defer df.release()
+
+	header, err := readLogEntryHeader(df.file, df.header.Version, vp.Offset)
+	if err != nil {
+		log.Printf("Failed to read header of %q in file %d: %v", key, vp.FileId, err)
+		return 0, false
+	}
+	return header.Meta, true
+}
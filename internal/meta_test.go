@@ -0,0 +1,78 @@
+package internal
+
+import "testing"
+
+func TestPutWithMeta(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	if err := bc.PutWithMeta("tagged", "value", 0xCAFE); err != nil {
+		t.Fatalf("PutWithMeta failed: %v", err)
+	}
+	if err := bc.PutWithMeta("cleared", "value", 7); err != nil {
+		t.Fatalf("PutWithMeta failed: %v", err)
+	}
+	if err := bc.Put("cleared", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	check := func(bc *BitCask) {
+		t.Helper()
+		if meta, ok := bc.GetMeta("tagged"); !ok || meta != 0xCAFE {
+			t.Fatalf("GetMeta(tagged): got %#x, %v", meta, ok)
+		}
+		if meta, ok := bc.GetMeta("cleared"); !ok || meta != 0 {
+			t.Fatalf("GetMeta(cleared): got %d, %v, want a Put to clear it", meta, ok)
+		}
+		if _, ok := bc.GetMeta("missing"); ok {
+			t.Fatalf("GetMeta of a missing key succeeded")
+		}
+		if got, err := bc.Get("tagged"); err != nil || got != "value" {
+			t.Fatalf("Get: got %q, %v", got, err)
+		}
+	}
+	check(bc)
+
+	// Merging the file carries the metadata over with the entry
+	bc.Mu.Lock()
+	sealed := bc.CurrentFileId
+	err = bc.RollNewFile()
+	bc.Mu.Unlock()
+	if err != nil {
+		t.Fatalf("RollNewFile failed: %v", err)
+	}
+	if _, err := bc.MergeFile(sealed); err != nil {
+		t.Fatalf("MergeFile failed: %v", err)
+	}
+	check(bc)
+
+	if err := bc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	check(bc)
+}
+
+func TestDecodeFormat3HasNoMeta(t *testing.T) {
+	entry := NewLogEntry("key", "value", false)
+	entry.Header.ExpireAt = 42
+	entry.Header.Meta = 9
+	buf := entry.Serialize()
+
+	// Format 3 ends the header right before the meta field
+	format3 := append(append([]byte{}, buf[:37]...), buf[logEntryHeaderSize:]...)
+	got, err := decodeEntry(format3, 3)
+	if err != nil {
+		t.Fatalf("decodeEntry failed: %v", err)
+	}
+	if string(got.Key) != "key" || string(got.Value) != "value" || got.Header.ExpireAt != 42 || got.Header.Meta != 0 {
+		t.Fatalf("got %q=%q expire %d meta %d", got.Key, got.Value, got.Header.ExpireAt, got.Header.Meta)
+	}
+}
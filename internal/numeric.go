@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var ErrNotFloat = errors.New("value is not a float")
+
+// ErrNotInteger is returned by Incr for a value that is not a 64-bit
+// integer.
+var ErrNotInteger = errors.New("value is not an integer or out of range")
+
+// Incr adds delta to the integer stored at key, treating a missing key as
+// 0, and stores and returns the result, atomically with respect to other
+// updates of key. Like Redis' INCRBY it keeps the key's expiry and refuses
+// to overflow.
+func (bc *BitCask) Incr(key string, delta int64) (int64, error) {
+	var n int64
+	_, err := bc.update(key, func(old string, exists bool) (string, error) {
+		n = 0
+		if exists {
+			var err error
+			if n, err = strconv.ParseInt(old, 10, 64); err != nil {
+				return "", ErrNotInteger
+			}
+		}
+
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return "", errors.New("increment or decrement would overflow")
+		}
+		n += delta
+		return strconv.FormatInt(n, 10), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// IncrByFloat adds delta to the float stored at key, treating a missing key
+// as 0, and stores and returns the result. Like Redis' INCRBYFLOAT it keeps
+// the key's expiry and refuses results that are not finite. The result is
+// stored in its shortest exact form, without trailing zeros or an exponent.
+func (bc *BitCask) IncrByFloat(key string, delta float64) (string, error) {
+	return bc.update(key, func(old string, exists bool) (string, error) {
+		var n float64
+		if exists {
+			var err error
+			if n, err = strconv.ParseFloat(old, 64); err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+				return "", ErrNotFloat
+			}
+		}
+
+		n += delta
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return "", errors.New("increment would produce NaN or Infinity")
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	})
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestIncrByFloat(t *testing.T) {
+	bc := openTestDB(t)
+
+	for _, tc := range []struct {
+		delta float64
+		want  string
+	}{
+		{10.5, "10.5"},
+		{0.1, "10.6"},
+		{-5, "5.6"},
+		{-5.6, "0"},
+		{-0.25, "-0.25"},
+		{3e6, "2999999.75"},
+	} {
+		got, err := bc.IncrByFloat("f", tc.delta)
+		if err != nil || got != tc.want {
+			t.Fatalf("IncrByFloat(%v): got %q, %v, want %q", tc.delta, got, err, tc.want)
+		}
+	}
+	if got, err := bc.Get("f"); err != nil || got != "2999999.75" {
+		t.Fatalf("Get: got %q, %v", got, err)
+	}
+
+	if err := bc.Put("int", "3"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got, err := bc.IncrByFloat("int", 1.5); err != nil || got != "4.5" {
+		t.Fatalf("IncrByFloat of an integer: got %q, %v", got, err)
+	}
+
+	for _, value := range []string{"abc", "", "inf", "1.5x"} {
+		if err := bc.Put("bad", value); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if _, err := bc.IncrByFloat("bad", 1); !errors.Is(err, ErrNotFloat) {
+			t.Fatalf("IncrByFloat of %q: got %v, want ErrNotFloat", value, err)
+		}
+	}
+	if _, err := bc.IncrByFloat("f", math.Inf(1)); err == nil {
+		t.Fatalf("IncrByFloat to infinity succeeded")
+	}
+	if got, _ := bc.Get("f"); got != "2999999.75" {
+		t.Fatalf("failed increment changed the value to %q", got)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	bc := openTestDB(t)
+
+	if n, err := bc.Incr("counter", 1); err != nil || n != 1 {
+		t.Fatalf("Incr of a missing key: got %d, %v", n, err)
+	}
+	if n, err := bc.Incr("counter", -5); err != nil || n != -4 {
+		t.Fatalf("Incr(-5): got %d, %v", n, err)
+	}
+
+	bc.Put("bad", "1.5")
+	if _, err := bc.Incr("bad", 1); !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("Incr of a float: got %v, want ErrNotInteger", err)
+	}
+	bc.Put("max", strconv.FormatInt(math.MaxInt64, 10))
+	if _, err := bc.Incr("max", 1); err == nil {
+		t.Fatalf("Incr past MaxInt64 succeeded")
+	}
+
+	// Concurrent increments are not lost
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := bc.Incr("shared", 1); err != nil {
+					t.Errorf("Incr failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, err := bc.Get("shared"); err != nil || got != "800" {
+		t.Fatalf("after concurrent increments: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,274 @@
+package internal
+
+import "time"
+
+// Options tunes a BitCask instance. Build them with the With* functions
+// passed to Open; anything not set keeps its default.
+type Options struct {
+	// Checksum selects the algorithm protecting new entries. It is recorded
+	// in each data file's header, so files written under different
+	// settings can live in the same directory.
+	Checksum ChecksumType
+
+	// WarmUpConcurrency bounds the number of concurrent reads issued by WarmUp.
+	WarmUpConcurrency int
+
+	// MaxUnsyncedBytes caps how much of the log may be written but not yet
+	// fsynced. Once reached, Put and Delete fail with ErrBackpressure until
+	// the next sync. 0 means no limit.
+	MaxUnsyncedBytes int64
+
+	// SyncEveryBytes and SyncEveryWrites fsync from the write path once that
+	// many bytes or entries have been written since the last sync. The
+	// background sync still runs every SyncInterval and resets both counts,
+	// so a crash loses at most whichever bound is hit first. Lower values
+	// trade write throughput for durability. 0 disables a threshold.
+	SyncEveryBytes  int64
+	SyncEveryWrites int64
+
+	// SyncPolicy decides when writes are fsynced, see SyncPolicy.
+	SyncPolicy SyncPolicy
+
+	// SyncInterval is how often the background sync fsyncs the active
+	// files. Longer intervals mean fewer fsyncs but more writes lost in a
+	// crash. Ping reports the engine unhealthy once two intervals pass
+	// without a sync.
+	SyncInterval time.Duration
+
+	// WriteBufferSize is the size of the buffer in front of each active
+	// file. Tombstones and merged entries wait in it until it fills up or
+	// is flushed, so larger buffers mean fewer write syscalls for batches
+	// of deletes.
+	WriteBufferSize int
+
+	// IdleFlush, when set, hands buffered entries to the OS once no write
+	// has come in for that long, so a lone tombstone is visible to other
+	// readers of the files well before the next background sync. 0 leaves
+	// them to the background sync.
+	IdleFlush time.Duration
+
+	// MaxActiveFileSize is the size at which an active file is sealed and
+	// its shard rolls to a new one.
+	MaxActiveFileSize int64
+
+	// MaxActiveFileAge, when set, also seals an active file once it is that
+	// old, whichever of the size and the age limit comes first. Files then
+	// line up with time windows, which makes archiving and retention by age
+	// straightforward. The background sync seals aged files that hold
+	// entries; an empty one is rolled by the next write.
+	MaxActiveFileAge time.Duration
+
+	// Clock tells the time for entry timestamps, data file creation times,
+	// MaxActiveFileAge and the decay of access counters. Tests replace it;
+	// expiry always uses time.Now.
+	Clock func() time.Time
+
+	// Shards is the number of active files written in parallel. Each key
+	// is routed to one of them by hash, so keys that hash alike cluster in
+	// the same files. Changing it, or ShardKeyDelimiter, between opens
+	// seals all active files.
+	Shards int
+
+	// ShardKeyDelimiter, when set, routes keys by the part before its first
+	// occurrence, e.g. ":" keeps every "user:*" key in one shard.
+	ShardKeyDelimiter string
+
+	// DataFileExtension names new data files, e.g. 000001.gcask. Files with
+	// the legacy .log extension are loaded as well.
+	DataFileExtension string
+
+	// ExpireOnRead makes Get delete an expired key it runs into, so its
+	// space is reclaimed by the next merge. Otherwise expired keys are only
+	// reported as missing and stay in KeyDir until overwritten or deleted.
+	ExpireOnRead bool
+
+	// ValidateOnLoad makes recovery check that every entry of a later file
+	// carries a newer version than the one it replaces. A key failing the
+	// check was copied without its original being removed, which points at
+	// a compaction bug; each one is logged and counted in Stats. Recovery
+	// without it does no extra work.
+	ValidateOnLoad bool
+
+	// LazyIndex, an experimental mode for keyspaces too large for KeyDir,
+	// indexes sealed files that have a hint file in a compact per-file
+	// form of 16 bytes per key instead of loading their keys into KeyDir;
+	// BenchmarkLoadMemory measures about 20 bytes of heap per key against
+	// over 100 with short keys, and the gap grows with key length.
+	// Keys are then no longer held in memory: a lookup that misses KeyDir
+	// reads an entry header from each lazily indexed file, newest first,
+	// until it finds the key, so reads of old keys and misses get slower
+	// the more files there are. KEYS, SCANEXPIRE and Stats only see keys
+	// written since Open or read from files without hints, and merges,
+	// retention and dumps fail with ErrLazyIndex.
+	LazyIndex bool
+
+	// RecoverCorrupt makes recovery of files without a hint read every
+	// entry in full and check its checksum. A corrupt entry is logged,
+	// counted in Stats and skipped along with anything up to the next entry
+	// that checks out, so one bad entry doesn't make the database
+	// unopenable; the keys it held fall back to older versions, if any.
+	// Without it recovery only reads keys, stops at the first entry that
+	// can't be decoded and leaves corrupt values to be found by Get.
+	RecoverCorrupt bool
+
+	// AutoMergeInterval is how often the background auto-merge looks for a
+	// sealed file to compact. Each cycle merges at most one file, the one
+	// with the highest share of dead bytes. 0 disables auto-merge.
+	AutoMergeInterval time.Duration
+
+	// RetentionAge, when set, deletes sealed data files whose newest entry
+	// is older than this, along with every key whose current value lives
+	// in them. It suits logging-style use where old data expires
+	// wholesale; unlike a merge nothing is rewritten. Checked once a
+	// minute. 0 keeps data forever.
+	RetentionAge time.Duration
+
+	// StatsLogInterval, when set, logs a one-line summary of Stats every
+	// interval: keys, files, bytes written and operations per second since
+	// the previous line. 0 disables it.
+	StatsLogInterval time.Duration
+
+	// AutoMergeMinDeadRatio is the share of dead bytes, between 0 and 1, a
+	// sealed file needs before auto-merge picks it.
+	AutoMergeMinDeadRatio float64
+}
+
+type Option func(*Options)
+
+func DefaultOptions() Options {
+	return Options{
+		Checksum:          ChecksumCRC32C,
+		WarmUpConcurrency: 4,
+		Shards:            1,
+		MaxActiveFileSize: MaxActiveFileSize,
+		SyncInterval:      defaultSyncInterval,
+		WriteBufferSize:   defaultWriteBufferSize,
+		Clock:             time.Now,
+		DataFileExtension: defaultDataFileExtension,
+
+		AutoMergeMinDeadRatio: 0.5,
+	}
+}
+
+func WithChecksum(checksum ChecksumType) Option {
+	return func(o *Options) {
+		o.Checksum = checksum
+	}
+}
+
+func WithWarmUpConcurrency(n int) Option {
+	return func(o *Options) {
+		o.WarmUpConcurrency = n
+	}
+}
+
+func WithMaxUnsyncedBytes(n int64) Option {
+	return func(o *Options) {
+		o.MaxUnsyncedBytes = n
+	}
+}
+
+func WithSyncEvery(bytes, writes int64) Option {
+	return func(o *Options) {
+		o.SyncEveryBytes = bytes
+		o.SyncEveryWrites = writes
+	}
+}
+
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(o *Options) {
+		o.SyncPolicy = policy
+	}
+}
+
+func WithSyncInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.SyncInterval = interval
+	}
+}
+
+func WithWriteBufferSize(n int) Option {
+	return func(o *Options) {
+		o.WriteBufferSize = n
+	}
+}
+
+func WithIdleFlush(idle time.Duration) Option {
+	return func(o *Options) {
+		o.IdleFlush = idle
+	}
+}
+
+func WithMaxActiveFileSize(n int64) Option {
+	return func(o *Options) {
+		o.MaxActiveFileSize = n
+	}
+}
+
+func WithMaxActiveFileAge(age time.Duration) Option {
+	return func(o *Options) {
+		o.MaxActiveFileAge = age
+	}
+}
+
+func WithClock(clock func() time.Time) Option {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
+func WithShards(n int, keyDelimiter string) Option {
+	return func(o *Options) {
+		o.Shards = n
+		o.ShardKeyDelimiter = keyDelimiter
+	}
+}
+
+func WithDataFileExtension(ext string) Option {
+	return func(o *Options) {
+		o.DataFileExtension = ext
+	}
+}
+
+func WithExpireOnRead(enabled bool) Option {
+	return func(o *Options) {
+		o.ExpireOnRead = enabled
+	}
+}
+
+func WithValidateOnLoad(enabled bool) Option {
+	return func(o *Options) {
+		o.ValidateOnLoad = enabled
+	}
+}
+
+func WithRecoverCorrupt(enabled bool) Option {
+	return func(o *Options) {
+		o.RecoverCorrupt = enabled
+	}
+}
+
+func WithLazyIndex(enabled bool) Option {
+	return func(o *Options) {
+		o.LazyIndex = enabled
+	}
+}
+
+func WithRetentionAge(age time.Duration) Option {
+	return func(o *Options) {
+		o.RetentionAge = age
+	}
+}
+
+func WithStatsLogInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.StatsLogInterval = interval
+	}
+}
+
+func WithAutoMerge(interval time.Duration, minDeadRatio float64) Option {
+	return func(o *Options) {
+		o.AutoMergeInterval = interval
+		o.AutoMergeMinDeadRatio = minDeadRatio
+	}
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GetRange returns the bytes of the value of key from start to end, both
+// inclusive. Like Redis, negative offsets count from the end of the value
+// and out-of-range offsets are clamped, so a range outside the value is
+// empty rather than an error. Missing keys return ErrKeyNotFound.
+func (bc *BitCask) GetRange(key string, start, end int) (string, error) {
+	value, err := bc.Get(key)
+	if err != nil {
+		return "", err
+	}
+
+	n := len(value)
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	start = max(start, 0)
+	end = min(end, n-1)
+	if start > end {
+		return "", nil
+	}
+	return value[start : end+1], nil
+}
+
+// SetRange overwrites the value of key with value starting at offset,
+// padding with zero bytes when offset is past its end, and returns the new
+// length. A missing key counts as empty. Entries are immutable, so like
+// Append this writes the whole resulting value as a new entry, however
+// small the range: changing a few bytes of a large value rewrites all of
+// it. Setting an empty range changes nothing and creates no key.
+func (bc *BitCask) SetRange(key string, offset int, value string) (int64, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid offset %d for key %q", offset, key)
+	}
+	if int64(offset)+int64(len(value)) > maxValueSize {
+		return 0, fmt.Errorf("%w: %d bytes, at most %d", ErrValueTooLarge, int64(offset)+int64(len(value)), maxValueSize)
+	}
+	if value == "" {
+		n, err := bc.Strlen(key)
+		if errors.Is(err, ErrKeyNotFound) {
+			return 0, nil
+		}
+		return n, err
+	}
+
+	result, err := bc.update(key, func(old string, exists bool) (string, error) {
+		if offset > len(old) {
+			old += strings.Repeat("\x00", offset-len(old))
+		}
+		tail := ""
+		if end := offset + len(value); end < len(old) {
+			tail = old[end:]
+		}
+		return old[:offset] + value + tail, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(result)), nil
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetRange(t *testing.T) {
+	bc := openTestDB(t)
+	bc.Put("k", "This is a string")
+
+	for _, tc := range []struct {
+		start, end int
+		want       string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{-100, 3, "This"},
+		{5, 2, ""},
+		{100, 200, ""},
+	} {
+		if got, err := bc.GetRange("k", tc.start, tc.end); err != nil || got != tc.want {
+			t.Errorf("GetRange(%d, %d) = %q, %v, want %q", tc.start, tc.end, got, err, tc.want)
+		}
+	}
+	if _, err := bc.GetRange("missing", 0, -1); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("GetRange of a missing key: got %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestSetRange(t *testing.T) {
+	bc := openTestDB(t)
+	bc.Put("k", "Hello World")
+
+	if n, err := bc.SetRange("k", 6, "Redis"); err != nil || n != 11 {
+		t.Fatalf("SetRange inside the value: got %d, %v", n, err)
+	}
+	if got, _ := bc.Get("k"); got != "Hello Redis" {
+		t.Fatalf("got %q, want %q", got, "Hello Redis")
+	}
+	if n, err := bc.SetRange("k", 6, "GoCask!"); err != nil || n != 13 {
+		t.Fatalf("SetRange past the end: got %d, %v", n, err)
+	}
+	if got, _ := bc.Get("k"); got != "Hello GoCask!" {
+		t.Fatalf("got %q, want %q", got, "Hello GoCask!")
+	}
+
+	if n, err := bc.SetRange("padded", 3, "x"); err != nil || n != 4 {
+		t.Fatalf("SetRange of a missing key: got %d, %v", n, err)
+	}
+	if got, _ := bc.Get("padded"); got != "\x00\x00\x00x" {
+		t.Fatalf("got %q, want zero padding", got)
+	}
+
+	if n, err := bc.SetRange("empty", 5, ""); err != nil || n != 0 || bc.Exists("empty") {
+		t.Fatalf("empty SetRange of a missing key: got %d, %v, exists=%v", n, err, bc.Exists("empty"))
+	}
+	if _, err := bc.SetRange("k", -1, "x"); err == nil {
+		t.Fatalf("expected an error for a negative offset")
+	}
+}
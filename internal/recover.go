@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+)
+
+// recoverRecords is hintRecords for Options.RecoverCorrupt: every entry is
+// read in full and checked against its checksum. An entry that fails the
+// check, or claims to run past the end of the file, is logged and skipped,
+// and the scan resumes at the next offset holding a complete entry that
+// passes it. If there is none, the rest of the file is dropped as a torn
+// tail. A WriteBatch that loses an entry to corruption is dropped whole.
+// Files without checksums can't tell entries from garbage and are
+// scanned as usual.
+//
+// The file is read through a window of recoverWindowSize bytes, so memory
+// stays bounded by the window and the largest entry whatever the size of
+// the file.
+func (bc *BitCask) recoverRecords(file *os.File, fileId int, header fileHeader, fileSize int64) (batchRecords, error) {
+	if header.Checksum == ChecksumNone {
+		return scanRecords(file, header, fileSize)
+	}
+
+	var records batchRecords
+	r := newWindowReader(file, fileSize)
+
+	for offset := header.dataStart(); offset < fileSize; {
+		entry, size, err := readCheckedEntry(r, header, offset, fileSize)
+		if err == nil {
+			records.add(entry.Header.BatchContinues, hintRecord{
+				Key:       string(entry.Key),
+				Tombstone: entry.IsDeleted(),
+				Version:   entry.Header.Version,
+				ExpireAt:  entry.Header.ExpireAt,
+				Offset:    offset,
+				Size:      size,
+				Timestamp: entry.Header.Timestamp,
+			})
+			offset += size
+			continue
+		}
+		if !errors.Is(err, ErrCorruptedEntry) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return records, err
+		}
+
+		next := nextCheckedEntry(r, header, offset+1, fileSize)
+		if next == fileSize {
+			log.Printf("Recovery: dropped %d bytes at the end of file %d from offset %d: %v",
+				fileSize-offset, fileId, offset, err)
+			records.torn = true
+			break
+		}
+		// A batch with a corrupt entry can't be applied whole
+		records.abandon()
+		bc.loadCorrupt++
+		log.Printf("Recovery: skipped %d corrupt bytes of file %d at offset %d: %v",
+			next-offset, fileId, offset, err)
+		offset = next
+	}
+	return records, nil
+}
+
+// readCheckedEntry reads the whole entry at offset and verifies it.
+func readCheckedEntry(r io.ReaderAt, header fileHeader, offset int64, fileSize int64) (*LogEntry, int64, error) {
+	_, size, err := readLogEntryHeaderAndKey(r, header.Version, offset, fileSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	buf, err := readEntryBytes(r, offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := header.Checksum.verify(buf); err != nil {
+		return nil, 0, err
+	}
+	entry, err := decodeEntry(buf, header.Version)
+	return entry, size, err
+}
+
+// tornTail reports whether the entry at offset, which runs past fileSize,
+// can be the last one written before a crash: no entry that verifies
+// follows it. Without checksums garbage can't be told from an entry, so any
+// entry running past the end is taken for a torn one.
+func tornTail(file io.ReaderAt, header fileHeader, offset int64, fileSize int64) bool {
+	if header.Checksum == ChecksumNone {
+		return true
+	}
+	r := newWindowReader(file, fileSize)
+	return nextCheckedEntry(r, header, offset+1, fileSize) == fileSize
+}
+
+// nextCheckedEntry returns the first offset from start holding an entry that
+// verifies, or fileSize if there is none. The scan moves forward through the
+// window of r one byte at a time, and only reads and verifies an entry whose
+// header could be one, see plausibleHeader.
+func nextCheckedEntry(r *windowReader, header fileHeader, start int64, fileSize int64) int64 {
+	buf := make([]byte, entryHeaderSize(header.Version))
+	for offset := start; offset+int64(len(buf)) <= fileSize; offset++ {
+		if _, err := r.ReadAt(buf, offset); err != nil {
+			break
+		}
+		if !plausibleHeader(buf, header.Version, fileSize-offset) {
+			continue
+		}
+		if _, _, err := readCheckedEntry(r, header, offset, fileSize); err == nil {
+			return offset
+		}
+	}
+	return fileSize
+}
+
+// plausibleHeader reports whether buf could be the header of an entry with
+// at most remaining bytes left in the file: its flags are ones a writer
+// sets and it fits. It is a cheap filter, the checksum decides.
+func plausibleHeader(buf []byte, format uint8, remaining int64) bool {
+	h, err := decodeHeader(buf, format)
+	if err != nil {
+		return false
+	}
+	if format >= 5 {
+		if buf[20]&^(entryFlagTombstone|entryFlagBatchContinues) != 0 {
+			return false
+		}
+	} else if buf[20] > 1 {
+		return false
+	}
+	if format >= 2 && h.Version == 0 {
+		return false
+	}
+	return entryHeaderSize(format)+int64(h.KeySize)+int64(h.ValueSize) <= remaining
+}
+
+// windowReader reads the first size bytes of a file through a buffer of
+// recoverWindowSize bytes, so reads that move forward through the file cost
+// one read per window rather than one per call. Reads larger than the
+// window go to the file.
+type windowReader struct {
+	r     io.ReaderAt
+	buf   []byte
+	start int64
+}
+
+func newWindowReader(file io.ReaderAt, size int64) *windowReader {
+	return &windowReader{r: io.NewSectionReader(file, 0, size)}
+}
+
+func (w *windowReader) ReadAt(p []byte, off int64) (int, error) {
+	end := w.start + int64(len(w.buf))
+	if off >= w.start && off+int64(len(p)) <= end {
+		return copy(p, w.buf[off-w.start:]), nil
+	}
+	if len(p) > recoverWindowSize {
+		return w.r.ReadAt(p, off)
+	}
+
+	if w.buf == nil {
+		w.buf = make([]byte, recoverWindowSize)
+	}
+	n, err := w.r.ReadAt(w.buf[:cap(w.buf)], off)
+	w.buf, w.start = w.buf[:n], off
+	if n >= len(p) {
+		return copy(p, w.buf), nil
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	return copy(p, w.buf), err
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// enforceRetention deletes the sealed data files whose newest entry is older
+// than Options.RetentionAge and returns how many it removed. Files go oldest
+// first and the first one that must stay ends the pass, so a tombstone is
+// never deleted while an older file might still hold the value it deleted.
+func (bc *BitCask) enforceRetention() (int, error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return 0, err
+	}
+	if err := bc.checkFullIndex(); err != nil {
+		return 0, err
+	}
+
+	cutoff := bc.opts.Clock().Add(-bc.opts.RetentionAge).UnixNano()
+	removed := 0
+	for _, id := range bc.sortedFileIds() {
+		if bc.activeShard(id) != nil {
+			break
+		}
+		newest, err := bc.newestEntryAt(id)
+		if err != nil {
+			return removed, fmt.Errorf("failed to scan file %d: %w", id, err)
+		}
+		if newest >= cutoff {
+			break
+		}
+
+		// Keys rewritten since point into newer files and stay
+		for key, vp := range bc.KeyDir {
+			if vp.FileId == id {
+				bc.unindexKey(key)
+				bc.raiseVersionFloor(vp.Version)
+				bc.dropFreq(key)
+			}
+		}
+		if err := bc.saveVersionFloor(); err != nil {
+			return removed, err
+		}
+		if err := bc.removeFile(id); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// newestEntryAt returns the timestamp of the newest entry of the sealed file
+// fileId, or its creation time if it has no entries. Sealed files never
+// change, so each one is scanned once. Callers hold bc.Mu for writing.
+func (bc *BitCask) newestEntryAt(fileId int) (int64, error) {
+	df := bc.Files[fileId]
+	if df.newestKnown {
+		return df.newestAt, nil
+	}
+
+	newest := df.header.CreatedAt
+	err := bc.scanFile(fileId, func(entry *LogEntry, offset int64, size int64) error {
+		newest = max(newest, entry.Header.Timestamp)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	df.newestAt, df.newestKnown = newest, true
+	return newest, nil
+}
+
+// startRetention runs enforceRetention every retentionCheckInterval.
+func (bc *BitCask) startRetention() {
+	bc.syncWg.Add(1)
+
+	go func() {
+		defer bc.syncWg.Done()
+
+		ticker := time.NewTicker(retentionCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				removed, err := bc.enforceRetention()
+				if err != nil {
+					log.Printf("Retention failed: %v", err)
+				} else if removed > 0 {
+					log.Printf("Retention removed %d data files", removed)
+				}
+
+			case <-bc.done:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionDeletesExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir, WithRetentionAge(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	put := func(key, value string) {
+		t.Helper()
+		if err := bc.Put(key, value); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// The old file holds keys that are only there, one that is rewritten
+	// below and the tombstone of a key deleted for good
+	put("a", "old")
+	put("b", "old")
+	put("gone", "old")
+	if _, err := bc.Delete("gone"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := bc.Roll(); err != nil {
+		t.Fatalf("Roll failed: %v", err)
+	}
+	old := bc.KeyDir["a"].FileId
+
+	time.Sleep(200 * time.Millisecond)
+	put("b", "new")
+	put("c", "new")
+	if err := bc.Roll(); err != nil {
+		t.Fatalf("Roll failed: %v", err)
+	}
+	recent := bc.KeyDir["c"].FileId
+
+	removed, err := bc.enforceRetention()
+	if err != nil {
+		t.Fatalf("enforceRetention failed: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("removed %d files, want 1", removed)
+	}
+
+	check := func(bc *BitCask) {
+		t.Helper()
+		if _, ok := bc.Files[old]; ok {
+			t.Fatalf("expired file %d still open", old)
+		}
+		if _, ok := bc.Files[recent]; !ok {
+			t.Fatalf("recent file %d was removed", recent)
+		}
+		for _, key := range []string{"a", "gone"} {
+			if _, err := bc.Get(key); err == nil {
+				t.Fatalf("key %q of the expired file still readable", key)
+			}
+		}
+		for _, key := range []string{"b", "c"} {
+			if got, err := bc.Get(key); err != nil || got != "new" {
+				t.Fatalf("Get(%q): got %q, %v", key, got, err)
+			}
+		}
+		if st := bc.Stats(); st.Keys != 2 {
+			t.Fatalf("got %d keys, want 2", st.Keys)
+		}
+	}
+	check(bc)
+
+	if err := bc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	check(bc)
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// SecureDelete deletes key like Delete and then overwrites the value of the
+// entry it pointed at with zeros, in place, so the plaintext is gone from
+// disk without waiting for a merge. The entry is also flagged as a
+// tombstone and gets a fresh checksum, so it stays a valid entry that
+// Undelete and History won't take for a value.
+//
+// Only the latest version is scrubbed. Values that key held before it, and
+// copies in backups or dumps, remain until a merge drops them.
+func (bc *BitCask) SecureDelete(key string) error {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	vp, ok := bc.lookup(key)
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if err := bc.delete(key); err != nil {
+		return err
+	}
+
+	// The old entry may still be in the writer's buffer
+	if err := bc.flush(); err != nil {
+		bc.recordWriteResult(err)
+		return err
+	}
+	if err := bc.scrubEntry(vp); err != nil {
+		return fmt.Errorf("failed to scrub the old value of %q: %w", key, err)
+	}
+	return nil
+}
+
+// scrubEntry zeroes the value of the entry behind vp on disk, marks it as a
+// tombstone, reseals it with the checksum of its file and fsyncs it. Callers
+// hold bc.Mu for writing.
+func (bc *BitCask) scrubEntry(vp ValuePointer) error {
+	df, ok := bc.Files[vp.FileId]
+	if !ok {
+		return fmt.Errorf("file %d not found", vp.FileId)
+	}
+
+	buf, err := readEntryBytes(df.file, vp.Offset, vp.Size)
+	if err != nil {
+		return err
+	}
+	entry, err := decodeEntry(buf, df.header.Version)
+	if err != nil {
+		return err
+	}
+	clear(entry.Value) // aliases buf
+	if df.header.Version >= 5 {
+		buf[20] |= entryFlagTombstone
+	} else {
+		buf[20] = 1
+	}
+	binary.BigEndian.PutUint32(buf[0:4], df.header.Checksum.sum(buf[4:]))
+
+	// Data files are opened read-only or for appending, neither of which
+	// can write at an offset
+	f, err := os.OpenFile(df.path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(buf, vp.Offset); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSecureDelete(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	if err := bc.Put("secret", "first-password"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := bc.Put("secret", "second-password"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	fileId := bc.KeyDir["secret"].FileId
+	path := bc.Files[fileId].path
+
+	if err := bc.SecureDelete("secret"); err != nil {
+		t.Fatalf("SecureDelete failed: %v", err)
+	}
+	if err := bc.SecureDelete("secret"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("SecureDelete of a missing key: got %v, want ErrKeyNotFound", err)
+	}
+	if _, err := bc.Get("secret"); err == nil {
+		t.Fatalf("deleted key still readable")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+	if bytes.Contains(data, []byte("second-password")) {
+		t.Fatalf("latest value still on disk")
+	}
+	// Only the latest version is scrubbed
+	if !bytes.Contains(data, []byte("first-password")) {
+		t.Fatalf("older value was scrubbed too")
+	}
+
+	// The scrubbed entry survives a reload and still matches its checksum
+	if err := bc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	if _, err := bc.Get("secret"); err == nil {
+		t.Fatalf("deleted key came back after reopen")
+	}
+
+	df := bc.Files[fileId]
+	var last []byte
+	err = bc.scanFile(fileId, func(entry *LogEntry, offset, size int64) error {
+		// The scrubbed entry is a tombstone that still has a value
+		if entry.Header.Tombstone && entry.Header.ValueSize > 0 {
+			last, err = readEntryBytes(df.file, offset, size)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("scanFile failed: %v", err)
+	}
+	if last == nil {
+		t.Fatalf("scrubbed entry not marked as a tombstone")
+	}
+	entry, err := decodeEntry(last, df.header.Version)
+	if err != nil {
+		t.Fatalf("decodeEntry failed: %v", err)
+	}
+	if !bytes.Equal(entry.Value, make([]byte, len("second-password"))) {
+		t.Fatalf("got value %q, want zeros", entry.Value)
+	}
+	if got, want := binary.BigEndian.Uint32(last[0:4]), df.header.Checksum.sum(last[4:]); got != want {
+		t.Fatalf("checksum %08x, want %08x", got, want)
+	}
+}
+
+func TestSecureDeleteCannotBeUndeleted(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("k", "secret"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := bc.SecureDelete("k"); err != nil {
+		t.Fatalf("SecureDelete failed: %v", err)
+	}
+
+	if ok, err := bc.Undelete("k"); err != nil || ok {
+		t.Fatalf("Undelete: got %v, %v, want false", ok, err)
+	}
+	if _, err := bc.Get("k"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get: got %v, want ErrKeyNotFound", err)
+	}
+
+	history, err := bc.History("k")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	for _, info := range history {
+		if !info.Tombstone {
+			t.Fatalf("History still lists a value: %q", info.Value)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package internal
+
+import "time"
+
+// SetCondition restricts which keys a Set may write.
+type SetCondition int
+
+const (
+	SetAlways    SetCondition = iota
+	SetIfAbsent               // NX
+	SetIfPresent              // XX
+)
+
+// SetOptions are the options of Set, mirroring the Redis SET command.
+type SetOptions struct {
+	Condition SetCondition
+	// ExpireAt makes the key expire at that time. The zero value means the
+	// key never expires.
+	ExpireAt time.Time
+	// GetOld asks Set to also return the value it replaces.
+	GetOld bool
+	// Meta is stored alongside the value, see PutWithMeta.
+	Meta uint32
+}
+
+// Set checks the condition and writes key in one step under the write lock,
+// so concurrent writers can't slip in between. It reports whether the key
+// was written and whether it existed before, along with its previous value
+// when opts.GetOld is set. Expired keys count as absent.
+func (bc *BitCask) Set(key string, value string, opts SetOptions) (old string, existed bool, written bool, err error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	vp, ok := bc.lookup(key)
+	existed = ok && !vp.expired(time.Now())
+
+	if existed && opts.GetOld {
+		if old, _, err = bc.get(key); err != nil {
+			return "", existed, false, err
+		}
+	}
+
+	if (opts.Condition == SetIfAbsent && existed) || (opts.Condition == SetIfPresent && !existed) {
+		return old, existed, false, nil
+	}
+
+	var expireAt int64
+	if !opts.ExpireAt.IsZero() {
+		expireAt = opts.ExpireAt.UnixNano()
+	}
+	if err := bc.putEntry(key, value, expireAt, opts.Meta); err != nil {
+		return old, existed, false, err
+	}
+	return old, existed, true, nil
+}
+
+// PutIfAbsent writes key only if it has no live value, reporting whether it
+// did. The check and the write happen under one write lock, so of several
+// concurrent calls for the same key exactly one succeeds, which makes it
+// usable as a lock. Expired keys count as absent.
+func (bc *BitCask) PutIfAbsent(key string, value string) (bool, error) {
+	_, _, written, err := bc.Set(key, value, SetOptions{Condition: SetIfAbsent})
+	return written, err
+}
+
+// GetSet writes value to key and returns the value it replaced, reporting
+// whether there was one. Like SET it drops any expiry the key had.
+func (bc *BitCask) GetSet(key string, value string) (string, bool, error) {
+	old, existed, _, err := bc.Set(key, value, SetOptions{GetOld: true})
+	return old, existed, err
+}
+
+// GetDel deletes key and returns the value it held, reporting whether there
+// was one. The read and the delete happen under one write lock, so of
+// several concurrent calls for the same key only one sees the value.
+func (bc *BitCask) GetDel(key string) (string, bool, error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	value, _, ok, err := bc.getLive(key)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	if err := bc.delete(key); err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetConditions(t *testing.T) {
+	bc := openTestDB(t)
+
+	if _, _, written, err := bc.Set("k", "v1", SetOptions{Condition: SetIfPresent}); err != nil || written {
+		t.Fatalf("XX on a missing key: written=%v err=%v", written, err)
+	}
+	if _, existed, written, err := bc.Set("k", "v1", SetOptions{Condition: SetIfAbsent}); err != nil || !written || existed {
+		t.Fatalf("NX on a missing key: written=%v existed=%v err=%v", written, existed, err)
+	}
+
+	old, existed, written, err := bc.Set("k", "v2", SetOptions{Condition: SetIfAbsent, GetOld: true})
+	if err != nil || written || !existed || old != "v1" {
+		t.Fatalf("NX GET on an existing key: old=%q existed=%v written=%v err=%v", old, existed, written, err)
+	}
+
+	expireAt := time.Now().Add(time.Hour)
+	if _, _, _, err := bc.Set("k", "v3", SetOptions{ExpireAt: expireAt}); err != nil {
+		t.Fatalf("Set with expiry failed: %v", err)
+	}
+	if got := bc.KeyDir["k"].ExpireAt; got != expireAt.UnixNano() {
+		t.Fatalf("got expiry %d, want %d", got, expireAt.UnixNano())
+	}
+}
+
+func TestPutIfAbsentHasOneWinner(t *testing.T) {
+	bc := openTestDB(t)
+
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			written, err := bc.PutIfAbsent("lock", fmt.Sprint(i))
+			if err != nil {
+				t.Errorf("PutIfAbsent failed: %v", err)
+			}
+			if written {
+				wins.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if wins.Load() != 1 {
+		t.Fatalf("%d callers took the lock, want 1", wins.Load())
+	}
+	bc.Delete("lock")
+	if written, err := bc.PutIfAbsent("lock", "again"); err != nil || !written {
+		t.Fatalf("PutIfAbsent after the lock was released: %v, %v", written, err)
+	}
+}
+
+func TestGetSetReturnsEachValueOnce(t *testing.T) {
+	bc := openTestDB(t)
+
+	if _, existed, err := bc.GetSet("k", "init"); err != nil || existed {
+		t.Fatalf("GetSet on a missing key: existed=%v err=%v", existed, err)
+	}
+
+	// Every value written is replaced exactly once, so the old values seen
+	// plus the final one are all values ever written.
+	const writers = 32
+	olds := make(chan string, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			old, existed, err := bc.GetSet("k", fmt.Sprint(i))
+			if err != nil || !existed {
+				t.Errorf("GetSet: existed=%v err=%v", existed, err)
+			}
+			olds <- old
+		}(i)
+	}
+	wg.Wait()
+	close(olds)
+
+	seen := make(map[string]bool)
+	for old := range olds {
+		seen[old] = true
+	}
+	final, err := bc.Get("k")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	seen[final] = true
+	if len(seen) != writers+1 || !seen["init"] {
+		t.Fatalf("saw %d distinct values, want %d", len(seen), writers+1)
+	}
+}
+
+func TestGetDel(t *testing.T) {
+	bc := openTestDB(t)
+
+	if _, ok, err := bc.GetDel("k"); err != nil || ok {
+		t.Fatalf("GetDel on a missing key: ok=%v err=%v", ok, err)
+	}
+	bc.Put("k", "v")
+
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, ok, err := bc.GetDel("k")
+			if err != nil {
+				t.Errorf("GetDel failed: %v", err)
+			}
+			if ok {
+				if value != "v" {
+					t.Errorf("GetDel returned %q, want %q", value, "v")
+				}
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if wins.Load() != 1 {
+		t.Fatalf("%d callers got the value, want 1", wins.Load())
+	}
+	if _, err := bc.Get("k"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get after GetDel: %v", err)
+	}
+}
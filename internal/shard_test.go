@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardsGroupKeysByNamespace(t *testing.T) {
+	bc, err := Open(t.TempDir(), WithShards(4, ":"))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	if len(bc.Files) != 4 {
+		t.Fatalf("expected one active file per shard, got %d files", len(bc.Files))
+	}
+
+	for _, ns := range []string{"user", "order", "session"} {
+		for i := 0; i < 10; i++ {
+			if err := bc.Put(fmt.Sprintf("%s:%d", ns, i), "v"); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+	}
+
+	for _, ns := range []string{"user", "order", "session"} {
+		fileId := bc.KeyDir[ns+":0"].FileId
+		for i := 1; i < 10; i++ {
+			if got := bc.KeyDir[fmt.Sprintf("%s:%d", ns, i)].FileId; got != fileId {
+				t.Fatalf("%s:%d is in file %d, want %d like %s:0", ns, i, got, fileId, ns)
+			}
+		}
+	}
+}
+
+func TestShardLayoutChangeKeepsNewestValues(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(shards int, value string) {
+		t.Helper()
+		bc, err := Open(dir, WithShards(shards, ""))
+		if err != nil {
+			t.Fatalf("failed to open with %d shards: %v", shards, err)
+		}
+		defer bc.Close()
+
+		for i := 0; i < 50; i++ {
+			if err := bc.Put(fmt.Sprintf("key-%d", i), value); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		if _, err := bc.Delete("key-0"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+	}
+
+	write(4, "a")
+	write(3, "b")
+	write(1, "c")
+
+	for _, shards := range []int{1, 5} {
+		bc, err := Open(dir, WithShards(shards, ""))
+		if err != nil {
+			t.Fatalf("failed to reopen: %v", err)
+		}
+		if _, err := bc.Get("key-0"); err == nil {
+			t.Fatalf("deleted key-0 is back with %d shards", shards)
+		}
+		for i := 1; i < 50; i++ {
+			value, err := bc.Get(fmt.Sprintf("key-%d", i))
+			if err != nil || value != "c" {
+				t.Fatalf("key-%d with %d shards: got %q, %v, want c", i, shards, value, err)
+			}
+		}
+		bc.Close()
+	}
+}
+
+func TestInvalidShardCount(t *testing.T) {
+	for _, n := range []int{0, maxShards + 1} {
+		if _, err := Open(t.TempDir(), WithShards(n, "")); err == nil {
+			t.Fatalf("expected Open to reject %d shards", n)
+		}
+	}
+}
+
+func TestMaxActiveFileAge(t *testing.T) {
+	var now atomic.Int64
+	now.Store(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	advance := func(d time.Duration) { now.Add(int64(d)) }
+	clock := func() time.Time { return time.Unix(0, now.Load()) }
+
+	bc, err := Open(t.TempDir(), WithMaxActiveFileAge(time.Hour), WithClock(clock))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer bc.Close()
+
+	put := func(key string) int {
+		t.Helper()
+		if err := bc.Put(key, "v"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		return bc.KeyDir[key].FileId
+	}
+	rollExpired := func() {
+		t.Helper()
+		bc.Mu.Lock()
+		defer bc.Mu.Unlock()
+		if err := bc.rollExpiredShards(); err != nil {
+			t.Fatalf("rollExpiredShards failed: %v", err)
+		}
+	}
+
+	first := put("a")
+	advance(30 * time.Minute)
+	if got := put("b"); got != first {
+		t.Fatalf("write within the hour went to file %d, want %d", got, first)
+	}
+	advance(31 * time.Minute)
+	second := put("c")
+	if second <= first {
+		t.Fatalf("write after the hour went to file %d, want a file after %d", second, first)
+	}
+
+	// The background sync seals a file that aged without further writes
+	advance(2 * time.Hour)
+	rollExpired()
+	if bc.CurrentFileId <= second || bc.activeShard(second) != nil {
+		t.Fatalf("file %d still active after aging, current file %d", second, bc.CurrentFileId)
+	}
+
+	// but leaves an aged empty file to the next write
+	advance(2 * time.Hour)
+	empty := bc.CurrentFileId
+	rollExpired()
+	if bc.CurrentFileId != empty {
+		t.Fatalf("empty file %d was rolled to %d", empty, bc.CurrentFileId)
+	}
+	if got := put("d"); got != empty+1 {
+		t.Fatalf("write went to file %d, want %d", got, empty+1)
+	}
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if got, err := bc.Get(key); err != nil || got != "v" {
+			t.Fatalf("Get(%q): got %q, %v", key, got, err)
+		}
+	}
+}
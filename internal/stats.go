@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"unsafe"
+)
+
+// Stats is a point-in-time snapshot of engine counters. The JSON names
+// match the fields of the INFO reply.
+type Stats struct {
+	Keys  int `json:"keys"`
+	Files int `json:"files"`
+	// LiveBytes is the on-disk size of the entries KeyDir points at, so
+	// LiveBytes/Keys is the average entry size. Values are always stored
+	// raw, there is no int or compressed encoding to break this down by.
+	LiveBytes int64 `json:"live_bytes"`
+	// UnsyncedBytes is the size of the log written since the last fsync,
+	// bounded by Options.MaxUnsyncedBytes.
+	UnsyncedBytes int64 `json:"unsynced_bytes"`
+	// BytesRead and BytesWritten count log bytes fetched by reads and
+	// appended by writes since Open.
+	BytesRead    int64 `json:"total_disk_read_bytes"`
+	BytesWritten int64 `json:"total_disk_written_bytes"`
+	// EntriesRead and EntriesWritten count values read and entries
+	// appended since Open, the engine's operations.
+	EntriesRead    int64 `json:"total_entries_read"`
+	EntriesWritten int64 `json:"total_entries_written"`
+	// LoadDuplicates counts the entries Options.ValidateOnLoad found in a
+	// later file without a newer version when the database was opened.
+	LoadDuplicates int `json:"recovery_duplicate_keys"`
+	// LoadCorrupt counts the corrupt stretches of data files that
+	// Options.RecoverCorrupt skipped when the database was opened.
+	LoadCorrupt int `json:"recovery_corrupt_entries"`
+}
+
+func (bc *BitCask) Stats() Stats {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	var live int64
+	for _, u := range bc.usage {
+		live += u.bytes
+	}
+
+	return Stats{
+		Keys:          len(bc.KeyDir),
+		Files:         len(bc.Files),
+		LiveBytes:     live,
+		UnsyncedBytes: bc.unsynced,
+		BytesRead:     bc.bytesRead.Load(),
+		BytesWritten:  bc.bytesWritten.Load(),
+
+		EntriesRead:    bc.entriesRead.Load(),
+		EntriesWritten: bc.entriesWritten.Load(),
+
+		LoadDuplicates: bc.loadDuplicates,
+		LoadCorrupt:    bc.loadCorrupt,
+	}
+}
+
+// keyDirEntryBytes estimates the memory one KeyDir entry takes besides the
+// bytes of its key: the string header, the ValuePointer and the map's own
+// per-slot overhead (control byte, alignment and free slots).
+const keyDirEntryBytes = int64(unsafe.Sizeof("")+unsafe.Sizeof(ValuePointer{})) + keyDirSlotOverhead
+
+const keyDirSlotOverhead = 16
+
+// MemoryStats splits what the database holds in memory from what it keeps
+// on disk. Every key stays in memory, so KeyDirBytes grows with the key
+// count no matter how large the values are.
+type MemoryStats struct {
+	Keys     int
+	KeyBytes int64 // total length of the keys
+	// KeyDirBytes estimates the memory of the whole KeyDir: the keys, their
+	// ValuePointers and the map overhead.
+	KeyDirBytes int64
+	DataBytes   int64 // size of every data file on disk
+	// ReclaimableBytes is the part of DataBytes no key points at, which
+	// a merge would free once the file holding it is sealed.
+	ReclaimableBytes int64
+}
+
+func (bc *BitCask) MemoryStats() MemoryStats {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	ms := MemoryStats{
+		Keys:        len(bc.KeyDir),
+		KeyBytes:    bc.keyBytes,
+		KeyDirBytes: bc.keyBytes + int64(len(bc.KeyDir))*keyDirEntryBytes,
+	}
+	for id := range bc.Files {
+		st := bc.fileStat(id)
+		ms.DataBytes += st.Size
+		ms.ReclaimableBytes += st.DeadBytes
+	}
+	return ms
+}
+
+// statsLine formats the periodic stats log line for cur, with rates computed
+// against prev taken elapsed earlier.
+func statsLine(prev, cur Stats, elapsed time.Duration) string {
+	ops := (cur.EntriesRead - prev.EntriesRead) + (cur.EntriesWritten - prev.EntriesWritten)
+	qps := float64(ops) / elapsed.Seconds()
+	return fmt.Sprintf("Stats: keys=%d files=%d written_bytes=%d qps=%.1f",
+		cur.Keys, cur.Files, cur.BytesWritten-prev.BytesWritten, qps)
+}
+
+// startStatsLog logs statsLine every Options.StatsLogInterval. Stats only
+// takes the read lock, so logging never holds up writers for longer than a
+// Get would.
+func (bc *BitCask) startStatsLog() {
+	bc.syncWg.Add(1)
+
+	go func() {
+		defer bc.syncWg.Done()
+
+		ticker := time.NewTicker(bc.opts.StatsLogInterval)
+		defer ticker.Stop()
+
+		prev, prevAt := bc.Stats(), time.Now()
+		for {
+			select {
+			case now := <-ticker.C:
+				cur := bc.Stats()
+				log.Print(statsLine(prev, cur, now.Sub(prevAt)))
+				prev, prevAt = cur, now
+
+			case <-bc.done:
+				return
+			}
+		}
+	}()
+}
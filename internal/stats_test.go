@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsCountsBytesReadAndWritten(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("key", "value"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	size := NewLogEntry("key", "value", false).Size()
+
+	stats := bc.Stats()
+	if stats.BytesWritten != size || stats.BytesRead != 0 {
+		t.Fatalf("after Put: got written=%d read=%d, want %d and 0", stats.BytesWritten, stats.BytesRead, size)
+	}
+	if stats.LiveBytes != size {
+		t.Fatalf("got %d live bytes, want %d", stats.LiveBytes, size)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := bc.Get("key"); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	if _, err := bc.Get("missing"); err == nil {
+		t.Fatalf("expected Get of a missing key to fail")
+	}
+
+	stats = bc.Stats()
+	if stats.BytesRead != 3*size {
+		t.Fatalf("got %d bytes read, want %d", stats.BytesRead, 3*size)
+	}
+	if stats.EntriesRead != 3 || stats.EntriesWritten != 1 {
+		t.Fatalf("got %d entries read and %d written, want 3 and 1", stats.EntriesRead, stats.EntriesWritten)
+	}
+}
+
+func TestStatsLine(t *testing.T) {
+	prev := Stats{Keys: 1, Files: 1, BytesWritten: 100, EntriesRead: 10, EntriesWritten: 5}
+	cur := Stats{Keys: 4, Files: 2, BytesWritten: 350, EntriesRead: 30, EntriesWritten: 15}
+
+	want := "Stats: keys=4 files=2 written_bytes=250 qps=15.0"
+	if got := statsLine(prev, cur, 2*time.Second); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	bc := openTestDB(t)
+
+	for _, kv := range [][2]string{{"a", "1"}, {"bb", "2"}, {"ccc", "3"}, {"bb", "22"}} {
+		if err := bc.Put(kv[0], kv[1]); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if _, err := bc.Delete("ccc"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	ms := bc.MemoryStats()
+	if ms.Keys != 2 || ms.KeyBytes != 3 {
+		t.Fatalf("got %d keys of %d bytes, want 2 keys of 3 bytes", ms.Keys, ms.KeyBytes)
+	}
+	if want := 3 + 2*keyDirEntryBytes; ms.KeyDirBytes != want {
+		t.Fatalf("got %d KeyDir bytes, want %d", ms.KeyDirBytes, want)
+	}
+
+	var size, dead int64
+	for _, st := range bc.FileStats() {
+		size += st.Size
+		dead += st.DeadBytes
+	}
+	// bb=2, ccc=3 and the tombstone of ccc are dead
+	wantDead := NewLogEntry("bb", "2", false).Size() + NewLogEntry("ccc", "3", false).Size() + NewLogEntry("ccc", "", true).Size()
+	if ms.DataBytes != size || ms.ReclaimableBytes != dead || dead != wantDead {
+		t.Fatalf("got %+v, want %d data bytes and %d reclaimable", ms, size, wantDead)
+	}
+}
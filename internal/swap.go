@@ -0,0 +1,86 @@
+package internal
+
+import "time"
+
+// Swap exchanges the values of k1 and k2, expiries included, under one write
+// lock so no reader sees a half-done swap. If only one of the keys exists,
+// its value moves to the other one and it is deleted. Swapping two missing
+// keys, or a key with itself, does nothing.
+//
+// The two writes are separate log entries: a crash in between can leave the
+// value under both keys.
+func (bc *BitCask) Swap(k1, k2 string) error {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if k1 == k2 {
+		return nil
+	}
+
+	v1, vp1, ok1, err := bc.getLive(k1)
+	if err != nil {
+		return err
+	}
+	v2, vp2, ok2, err := bc.getLive(k2)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case ok1 && ok2:
+		if err := bc.putExpiring(k1, v2, vp2.ExpireAt); err != nil {
+			return err
+		}
+		return bc.putExpiring(k2, v1, vp1.ExpireAt)
+	case ok1:
+		if err := bc.putExpiring(k2, v1, vp1.ExpireAt); err != nil {
+			return err
+		}
+		return bc.delete(k1)
+	case ok2:
+		if err := bc.putExpiring(k1, v2, vp2.ExpireAt); err != nil {
+			return err
+		}
+		return bc.delete(k2)
+	}
+	return nil
+}
+
+// getLive is get that reports an absent or expired key as not found rather
+// than as an error. Callers hold bc.Mu.
+func (bc *BitCask) getLive(key string) (string, ValuePointer, bool, error) {
+	if vp, ok := bc.lookup(key); !ok || vp.expired(time.Now()) {
+		return "", vp, false, nil
+	}
+	value, vp, err := bc.get(key)
+	if err != nil {
+		return "", vp, false, err
+	}
+	return value, vp, true, nil
+}
+
+// CompareAndSwap writes new to key only if its current value is expected,
+// reporting whether it did. A missing or expired key matches an empty
+// expected, so CompareAndSwap(key, "", v) creates key. The key's expiry is
+// kept.
+func (bc *BitCask) CompareAndSwap(key, expected, new string) (bool, error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	cur, vp, ok, err := bc.getLive(key)
+	if err != nil {
+		return false, err
+	}
+	if cur != expected {
+		return false, nil
+	}
+
+	var expireAt int64
+	if ok {
+		expireAt = vp.ExpireAt
+	}
+	if err := bc.putExpiring(key, new, expireAt); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSwapBothPresent(t *testing.T) {
+	bc := openTestDB(t)
+
+	if err := bc.Put("a", "1"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, _, _, err := bc.Set("b", "2", SetOptions{ExpireAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if err := bc.Swap("a", "b"); err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+
+	for key, want := range map[string]string{"a": "2", "b": "1"} {
+		if got, err := bc.Get(key); err != nil || got != want {
+			t.Fatalf("Get(%q): got %q, %v, want %q", key, got, err, want)
+		}
+	}
+	// The expiry travels with the value
+	if bc.KeyDir["a"].ExpireAt == 0 || bc.KeyDir["b"].ExpireAt != 0 {
+		t.Fatalf("expiries not swapped: a=%d b=%d", bc.KeyDir["a"].ExpireAt, bc.KeyDir["b"].ExpireAt)
+	}
+}
+
+func TestSwapOneMissing(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	if err := bc.Put("a", "1"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := bc.Swap("a", "b"); err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if err := bc.Swap("missing", "other"); err != nil {
+		t.Fatalf("Swap of missing keys failed: %v", err)
+	}
+
+	check := func(bc *BitCask) {
+		t.Helper()
+		if _, err := bc.Get("a"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Get(a): got %v, want ErrKeyNotFound", err)
+		}
+		if got, err := bc.Get("b"); err != nil || got != "1" {
+			t.Fatalf("Get(b): got %q, %v", got, err)
+		}
+		if len(bc.KeyDir) != 1 {
+			t.Fatalf("got %d keys, want 1", len(bc.KeyDir))
+		}
+	}
+	check(bc)
+
+	// The moved-away key is deleted with a tombstone, not just dropped
+	bc.Close()
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	check(bc)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	bc := openTestDB(t)
+
+	if swapped, err := bc.CompareAndSwap("k", "x", "1"); err != nil || swapped {
+		t.Fatalf("CAS on a missing key with a non-empty expected: %v, %v", swapped, err)
+	}
+	if swapped, err := bc.CompareAndSwap("k", "", "1"); err != nil || !swapped {
+		t.Fatalf("CAS creating a key: %v, %v", swapped, err)
+	}
+	if swapped, err := bc.CompareAndSwap("k", "2", "3"); err != nil || swapped {
+		t.Fatalf("CAS with a stale expected: %v, %v", swapped, err)
+	}
+	if got, _ := bc.Get("k"); got != "1" {
+		t.Fatalf("failed CAS changed the value to %q", got)
+	}
+
+	// All callers expect the same value, so exactly one of them wins.
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			swapped, err := bc.CompareAndSwap("k", "1", strconv.Itoa(100+i))
+			if err != nil {
+				t.Errorf("CompareAndSwap failed: %v", err)
+			}
+			if swapped {
+				wins.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if wins.Load() != 1 {
+		t.Fatalf("%d CAS calls won, want 1", wins.Load())
+	}
+}
+
+func TestCompareAndSwapCounter(t *testing.T) {
+	bc := openTestDB(t)
+	if err := bc.Put("n", "0"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// Each goroutine increments the counter with a CAS loop. No increment
+	// may be lost, and every success must be one increment.
+	const workers, perWorker = 8, 50
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for done := 0; done < perWorker; {
+				cur, err := bc.Get("n")
+				if err != nil {
+					t.Errorf("Get failed: %v", err)
+					return
+				}
+				n, _ := strconv.Atoi(cur)
+				swapped, err := bc.CompareAndSwap("n", cur, strconv.Itoa(n+1))
+				if err != nil {
+					t.Errorf("CompareAndSwap failed: %v", err)
+					return
+				}
+				if swapped {
+					wins.Add(1)
+					done++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, _ := bc.Get("n"); got != strconv.Itoa(workers*perWorker) || wins.Load() != workers*perWorker {
+		t.Fatalf("counter = %s after %d wins, want %d", got, wins.Load(), workers*perWorker)
+	}
+}
@@ -0,0 +1,59 @@
+package internal
+
+import "time"
+
+// Undelete restores a deleted key from the last value it had on disk, as
+// long as a merge has not reclaimed that entry yet. It returns false when
+// the key is live, was never written, or has no recoverable value left. The
+// value is restored by appending a fresh entry, with its original expiry.
+func (bc *BitCask) Undelete(key string) (bool, error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return false, err
+	}
+	if _, ok := bc.lookup(key); ok {
+		return false, nil
+	}
+
+	// Make a buffered tombstone visible to the scan
+	if err := bc.flush(); err != nil {
+		return false, err
+	}
+
+	// Walk files newest first; within a file entries can only be read
+	// forward, so remember the last live entry seen.
+	ids := bc.sortedFileIds()
+	for i := len(ids) - 1; i >= 0; i-- {
+		var found bool
+		var lastOffset, lastSize int64
+
+		err := bc.scanFile(ids[i], func(entry *LogEntry, offset int64, size int64) error {
+			if string(entry.Key) == key && !entry.IsDeleted() {
+				found, lastOffset, lastSize = true, offset, size
+			}
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			continue
+		}
+
+		info, err := bc.entryInfo(ids[i], lastOffset, lastSize)
+		if err != nil {
+			return false, err
+		}
+		if info.ExpireAt != 0 && info.ExpireAt <= time.Now().UnixNano() {
+			return false, nil
+		}
+		if err := bc.putExpiring(key, info.Value, info.ExpireAt); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,44 @@
+package internal
+
+import "testing"
+
+func TestUndelete(t *testing.T) {
+	bc := openTestDB(t)
+
+	bc.Put("k", "old")
+	bc.Put("k", "latest")
+	bc.Delete("k")
+
+	ok, err := bc.Undelete("k")
+	if err != nil || !ok {
+		t.Fatalf("Undelete = %v, %v", ok, err)
+	}
+	if v, err := bc.Get("k"); err != nil || v != "latest" {
+		t.Fatalf("Get after Undelete = %q, %v", v, err)
+	}
+
+	// Live and never-written keys have nothing to restore
+	if ok, err := bc.Undelete("k"); err != nil || ok {
+		t.Fatalf("Undelete of a live key = %v, %v", ok, err)
+	}
+	if ok, err := bc.Undelete("missing"); err != nil || ok {
+		t.Fatalf("Undelete of a missing key = %v, %v", ok, err)
+	}
+}
+
+func TestUndeleteAcrossFiles(t *testing.T) {
+	bc := openTestDB(t)
+
+	bc.Put("k", "sealed")
+	bc.Mu.Lock()
+	bc.RollNewFile()
+	bc.Mu.Unlock()
+	bc.Delete("k")
+
+	if ok, err := bc.Undelete("k"); err != nil || !ok {
+		t.Fatalf("Undelete = %v, %v", ok, err)
+	}
+	if v, err := bc.Get("k"); err != nil || v != "sealed" {
+		t.Fatalf("Get after Undelete = %q, %v", v, err)
+	}
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Every write of a key bumps its version by one. Deletes count as writes,
+// and a key that is not in KeyDir starts above the version floor, the
+// highest version any deleted key reached, so a version is never reused: a
+// client holding an old version can't overwrite a key that was deleted and
+// recreated since. The floor is one number rather than a version per
+// deleted key, so new keys start at 1 only until the first delete. A missing
+// or expired key reports version 0. Only FlushDB starts versions over.
+
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// PutWithVersion writes key only if its current version is expectedVersion
+// (0 for "must not exist"), and returns the new version. Otherwise it fails
+// with ErrVersionMismatch and writes nothing.
+func (bc *BitCask) PutWithVersion(key string, value string, expectedVersion uint64) (uint64, error) {
+	bc.Mu.Lock()
+	defer bc.Mu.Unlock()
+
+	var current uint64
+	if cur, ok := bc.lookup(key); ok && !cur.expired(time.Now()) {
+		current = cur.Version
+	}
+	if current != expectedVersion {
+		return current, fmt.Errorf("%w: key %q is at version %d, expected %d",
+			ErrVersionMismatch, key, current, expectedVersion)
+	}
+
+	if err := bc.put(key, value); err != nil {
+		return current, err
+	}
+	return bc.KeyDir[key].Version, nil
+}
+
+// GetWithVersion is Get that also returns the version of the value read.
+func (bc *BitCask) GetWithVersion(key string) (string, uint64, error) {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	value, vp, err := bc.get(key)
+	if err != nil {
+		return "", 0, err
+	}
+	bc.touchFreq(key)
+	return value, vp.Version, nil
+}
+
+// Version returns the current version of key, or false if it is missing or
+// expired.
+func (bc *BitCask) Version(key string) (uint64, bool) {
+	bc.Mu.RLock()
+	defer bc.Mu.RUnlock()
+
+	vp, ok := bc.lookup(key)
+	if !ok || vp.expired(time.Now()) {
+		return 0, false
+	}
+	return vp.Version, true
+}
+
+// lastVersion returns the version the next write of key continues from: the
+// version of its latest write if it is in KeyDir, and otherwise the version
+// floor, so a key that is created or recreated gets a version above that of
+// every deleted key. Callers hold bc.Mu.
+func (bc *BitCask) lastVersion(key string) uint64 {
+	vp, ok := bc.lookup(key)
+	if ok {
+		return vp.Version
+	}
+	// A miss in the lazy files may still carry the version of a tombstone
+	return max(vp.Version, bc.versionFloor)
+}
+
+// raiseVersionFloor records that a key at version was deleted, by a
+// tombstone, expiry or retention. Callers hold bc.Mu for writing.
+func (bc *BitCask) raiseVersionFloor(version uint64) {
+	bc.versionFloor = max(bc.versionFloor, version)
+}
+
+// saveVersionFloor persists the version floor in the manifest, if it rose
+// since it was last saved. Recovery rebuilds the floor from the tombstones
+// and expired entries it finds, so it must be saved before a merge or
+// retention removes any of them. Callers hold bc.Mu for writing.
+func (bc *BitCask) saveVersionFloor() error {
+	if bc.versionFloor <= bc.savedVersionFloor {
+		return nil
+	}
+	m, err := loadManifest(bc.dir)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+	m.VersionFloor = bc.versionFloor
+	if err := m.save(bc.dir); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	bc.savedVersionFloor = bc.versionFloor
+	return nil
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPutWithVersion(t *testing.T) {
+	bc := openTestDB(t)
+
+	v, err := bc.PutWithVersion("k", "a", 0)
+	if err != nil || v != 1 {
+		t.Fatalf("create: got version %d, %v", v, err)
+	}
+
+	if _, err := bc.PutWithVersion("k", "b", 0); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expected ErrVersionMismatch for stale create, got %v", err)
+	}
+
+	if err := bc.Put("k", "b"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := bc.PutWithVersion("k", "c", 1); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expected ErrVersionMismatch after concurrent Put, got %v", err)
+	}
+
+	v, err = bc.PutWithVersion("k", "c", 2)
+	if err != nil || v != 3 {
+		t.Fatalf("update: got version %d, %v", v, err)
+	}
+
+	value, version, err := bc.GetWithVersion("k")
+	if err != nil || value != "c" || version != 3 {
+		t.Fatalf("GetWithVersion = %q, %d, %v", value, version, err)
+	}
+}
+
+func TestVersionSurvivesRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	for _, v := range []string{"1", "2", "3"} {
+		if err := bc.Put("k", v); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	bc.Put("gone", "x")
+	bc.Delete("gone")
+	bc.Close()
+
+	bc, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+
+	if v, ok := bc.Version("k"); !ok || v != 3 {
+		t.Fatalf("expected version 3 after recovery, got %d, %v", v, ok)
+	}
+	if v, ok := bc.Version("gone"); ok || v != 0 {
+		t.Fatalf("expected deleted key to have no version, got %d, %v", v, ok)
+	}
+}
+
+func TestVersionIsNotReusedAfterDelete(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	// A client reads version 1, then the key is deleted and recreated
+	if _, err := bc.PutWithVersion("k", "a", 0); err != nil {
+		t.Fatalf("PutWithVersion failed: %v", err)
+	}
+	bc.Delete("k")
+	v, err := bc.PutWithVersion("k", "b", 0)
+	if err != nil || v != 3 {
+		t.Fatalf("recreate: got version %d, %v, want 3", v, err)
+	}
+	if _, err := bc.PutWithVersion("k", "stale", 1); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("stale write after recreate: got %v, want ErrVersionMismatch", err)
+	}
+
+	// The tombstone's version survives a merge of its file and a reopen
+	bc.Delete("k")
+	bc.Roll()
+	if _, err := bc.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	bc.Close()
+	if bc, err = Open(dir); err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	if v, err := bc.PutWithVersion("k", "c", 0); err != nil || v != 5 {
+		t.Fatalf("recreate after reopen: got version %d, %v, want 5", v, err)
+	}
+
+	// An expired key counts as absent
+	bc.Mu.Lock()
+	bc.putExpiring("e", "v", time.Now().Add(-time.Second).UnixNano())
+	bc.Mu.Unlock()
+	if _, ok := bc.Version("e"); ok {
+		t.Fatalf("expired key reports a version")
+	}
+	expired := bc.KeyDir["e"].Version
+	if v, err := bc.PutWithVersion("e", "fresh", 0); err != nil || v != expired+1 {
+		t.Fatalf("PutWithVersion over an expired key: got version %d, %v, want %d", v, err, expired+1)
+	}
+}
+
+func TestMergeDropsTombstonesButKeepsVersionFloor(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	// Short-lived keys, each written and deleted once
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("session:%d", i)
+		bc.Put(key, "v")
+		bc.Delete(key)
+	}
+	bc.Roll()
+	if _, err := bc.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	// No older file can hold the keys, so their tombstones are gone
+	for _, id := range bc.sortedFileIds() {
+		bc.scanFile(id, func(entry *LogEntry, offset, size int64) error {
+			t.Errorf("file %d still holds %q", id, entry.Key)
+			return nil
+		})
+	}
+	bc.Close()
+
+	if bc, err = Open(dir); err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer bc.Close()
+	if v, err := bc.PutWithVersion("session:0", "again", 0); err != nil || v <= 2 {
+		t.Fatalf("recreate after merge: got version %d, %v, want above 2", v, err)
+	}
+}
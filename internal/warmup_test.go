@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWarmUp(t *testing.T) {
+	bc := openTestDB(t)
+	for i := 0; i < 100; i++ {
+		if err := bc.Put(fmt.Sprintf("key_%d", i), "value"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	if err := bc.WarmUp(context.Background()); err != nil {
+		t.Fatalf("WarmUp failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bc.WarmUp(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/iscoreyagain/GoCask/internal"
 )
@@ -16,7 +17,11 @@ func MustGet(db *internal.BitCask, key string) string {
 
 func main() {
 	fmt.Println("=== TESTING WITH RECOVERY ===")
-	db := internal.Init() // <-- loadFiles() được gọi trong Init()
+	db, err := internal.Open("./data") // <-- loadFiles() được gọi trong Open()
+	if err != nil {
+		log.Fatalf("Failed to open: %v", err)
+	}
+	defer db.Close()
 
 	fmt.Println("GET name =", MustGet(db, "name"))
 	fmt.Println("GET city =", MustGet(db, "city"))